@@ -0,0 +1,179 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/engine"
+	"github.com/benyaa/virtual-printer-process-engine/repo"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// authenticate only lets requests with the admin bearer token through.
+func (s *Server) authenticate(next http.HandlerFunc) http.Handler {
+	expected := []byte("Bearer " + s.conf.API.AdminToken)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		next(w, r)
+	})
+}
+
+// listSessions lists the sessions in the job store, filtered by the `status` query parameter,
+// which is a job status or `active` for the queued and processing sessions.
+func (s *Server) listSessions(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	jobs := []repo.Job{}
+	for _, job := range s.jobStore.List() {
+		switch {
+		case status == "":
+		case status == "active" && !job.IsDone():
+		case repo.JobStatus(status) == job.Status:
+		default:
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+type sessionDetails struct {
+	Job *repo.Job `json:"job,omitempty"`
+	// WAL are the session's WAL entries, which hold the flow object each handler got
+	WAL []repo.LogEntry `json:"wal"`
+}
+
+func (s *Server) inspectSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := getSessionID(w, r)
+	if !ok {
+		return
+	}
+	entries, err := s.writeAheadLogger.ReadEntries()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("failed to read WAL: %w", err))
+		return
+	}
+
+	details := sessionDetails{WAL: []repo.LogEntry{}}
+	for _, entry := range entries {
+		if entry.SessionID == sessionID {
+			details.WAL = append(details.WAL, entry)
+		}
+	}
+	if job, ok := s.jobStore.Get(sessionID); ok {
+		details.Job = &job
+	}
+	if details.Job == nil && len(details.WAL) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("session %s not found", sessionID))
+		return
+	}
+	writeJSON(w, http.StatusOK, details)
+}
+
+type retryRequest struct {
+	// HandlerID is the handler to retry from, the failed handler if it's empty, or `__init__` to start over
+	HandlerID string `json:"handler_id"`
+}
+
+func (s *Server) retrySession(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := getSessionID(w, r)
+	if !ok {
+		return
+	}
+	var request retryRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid retry request: %w", err))
+		return
+	}
+
+	log.Infof("admin API retrying session %s from handler %s", sessionID, request.HandlerID)
+	err = s.engine.RetrySession(sessionID, strings.TrimSpace(request.HandlerID))
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"session_id": sessionID.String()})
+}
+
+func (s *Server) cancelSession(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := getSessionID(w, r)
+	if !ok {
+		return
+	}
+	log.Infof("admin API canceling session %s", sessionID)
+	err := s.engine.CancelSession(sessionID)
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"session_id": sessionID.String()})
+}
+
+// downloadArtifact returns the file the handler in the `handler_id` query parameter got in the session,
+// or the one the failed handler got if it's empty.
+func (s *Server) downloadArtifact(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := getSessionID(w, r)
+	if !ok {
+		return
+	}
+	handlerID := r.URL.Query().Get("handler_id")
+	artifact, err := s.engine.GetArtifact(sessionID, handlerID)
+	if err != nil {
+		writeEngineError(w, err)
+		return
+	}
+	if handlerID == "" {
+		handlerID = "failed"
+	}
+	filename := fmt.Sprintf("%s_%s%s", sessionID.String()[0:8], handlerID, filepath.Ext(artifact))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	http.ServeFile(w, r, artifact)
+}
+
+func (s *Server) getIntake(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": s.engine.IsIntakePaused()})
+}
+
+func (s *Server) pauseIntake(w http.ResponseWriter, r *http.Request) {
+	log.Infof("admin API pausing intake")
+	s.engine.PauseIntake()
+	s.getIntake(w, r)
+}
+
+func (s *Server) resumeIntake(w http.ResponseWriter, r *http.Request) {
+	log.Infof("admin API resuming intake")
+	s.engine.ResumeIntake()
+	s.getIntake(w, r)
+}
+
+func getSessionID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid session ID: %w", err))
+		return uuid.Nil, false
+	}
+	return sessionID, true
+}
+
+func writeEngineError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, engine.ErrSessionNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, engine.ErrSessionActive), errors.Is(err, engine.ErrSessionNotActive), errors.Is(err, engine.ErrCannotRetry),
+		errors.Is(err, engine.ErrInputUnavailable):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/engine"
+	"github.com/benyaa/virtual-printer-process-engine/repo"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeEngine struct {
+	paused       bool
+	retryHandler string
+	retryErr     error
+	cancelErr    error
+	artifact     string
+	queueDepth   int
+	pipelines    map[string][]engine.PipelineHandler
+}
+
+func (e *fakeEngine) RetrySession(sessionID uuid.UUID, handlerID string) error {
+	e.retryHandler = handlerID
+	return e.retryErr
+}
+
+func (e *fakeEngine) CancelSession(sessionID uuid.UUID) error {
+	return e.cancelErr
+}
+
+func (e *fakeEngine) GetArtifact(sessionID uuid.UUID, handlerID string) (string, error) {
+	if e.artifact == "" {
+		return "", engine.ErrInputUnavailable
+	}
+	return e.artifact, nil
+}
+
+func (e *fakeEngine) PauseIntake() {
+	e.paused = true
+}
+
+func (e *fakeEngine) ResumeIntake() {
+	e.paused = false
+}
+
+func (e *fakeEngine) IsIntakePaused() bool {
+	return e.paused
+}
+
+func (e *fakeEngine) QueueDepth() int {
+	return e.queueDepth
+}
+
+func (e *fakeEngine) GetPipelines() map[string][]engine.PipelineHandler {
+	return e.pipelines
+}
+
+func newTestAdminServer(t *testing.T, e Engine, wal repo.WriteAheadLogger) (*Server, repo.JobStore) {
+	conf := config.Config{}
+	conf.API.AdminToken = "secret"
+	jobStore := repo.NewMemoryJobStore(0)
+	return NewServer(conf, t.TempDir(), nil, e, jobStore, wal), jobStore
+}
+
+func sendAdminRequest(s *Server, method string, target string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set("Authorization", "Bearer secret")
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestAdmin_Unauthorized(t *testing.T) {
+	s, _ := newTestAdminServer(t, &fakeEngine{}, &fakeWriteAheadLogger{})
+	request := httptest.NewRequest(http.MethodGet, "/api/admin/sessions", nil)
+	request.Header.Set("Authorization", "Bearer wrong")
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	disabled, _ := newTestServer(t, nil, &fakeWriteAheadLogger{})
+	recorder = httptest.NewRecorder()
+	disabled.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/admin/sessions", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestAdmin_Sessions(t *testing.T) {
+	failed, running := uuid.New(), uuid.New()
+	wal := &fakeWriteAheadLogger{entries: []repo.LogEntry{
+		{SessionID: failed, HandlerName: "__init__", HandlerID: "__init__"},
+		{SessionID: failed, HandlerName: "UploadHTTP", HandlerID: "UploadHTTP_0"},
+		{SessionID: running, HandlerName: "__init__", HandlerID: "__init__"},
+	}}
+	s, jobStore := newTestAdminServer(t, &fakeEngine{}, wal)
+	jobStore.Update(failed, func(job *repo.Job) { job.Status = repo.JobFailed })
+	jobStore.Update(running, func(job *repo.Job) { job.Status = repo.JobProcessing })
+
+	var jobs []repo.Job
+	recorder := sendAdminRequest(s, http.MethodGet, "/api/admin/sessions?status=active", "")
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &jobs))
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, running, jobs[0].SessionID)
+
+	var details sessionDetails
+	recorder = sendAdminRequest(s, http.MethodGet, "/api/admin/sessions/"+failed.String(), "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &details))
+	assert.Equal(t, repo.JobFailed, details.Job.Status)
+	assert.Len(t, details.WAL, 2)
+
+	recorder = sendAdminRequest(s, http.MethodGet, "/api/admin/sessions/"+uuid.NewString(), "")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestAdmin_Actions(t *testing.T) {
+	e := &fakeEngine{}
+	s, _ := newTestAdminServer(t, e, &fakeWriteAheadLogger{})
+	sessionID := uuid.NewString()
+
+	recorder := sendAdminRequest(s, http.MethodPost, "/api/admin/sessions/"+sessionID+"/retry", `{"handler_id": "UploadHTTP_0"}`)
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	assert.Equal(t, "UploadHTTP_0", e.retryHandler)
+
+	e.retryErr = engine.ErrCannotRetry
+	recorder = sendAdminRequest(s, http.MethodPost, "/api/admin/sessions/"+sessionID+"/retry", "")
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+
+	e.cancelErr = engine.ErrSessionNotFound
+	recorder = sendAdminRequest(s, http.MethodPost, "/api/admin/sessions/"+sessionID+"/cancel", "")
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = sendAdminRequest(s, http.MethodGet, "/api/admin/sessions/"+sessionID+"/artifact", "")
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	e.artifact = filepath.Join(t.TempDir(), "input.pdf")
+	assert.NoError(t, os.WriteFile(e.artifact, []byte("%PDF-1.7"), 0644))
+	recorder = sendAdminRequest(s, http.MethodGet, "/api/admin/sessions/"+sessionID+"/artifact?handler_id=UploadHTTP_0", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "%PDF-1.7", recorder.Body.String())
+	assert.Equal(t, `attachment; filename=`+sessionID[0:8]+`_UploadHTTP_0.pdf`, recorder.Header().Get("Content-Disposition"))
+
+	recorder = sendAdminRequest(s, http.MethodPost, "/api/admin/intake/pause", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.JSONEq(t, `{"paused": true}`, recorder.Body.String())
+	assert.True(t, e.paused)
+	sendAdminRequest(s, http.MethodPost, "/api/admin/intake/resume", "")
+	assert.False(t, e.paused)
+}
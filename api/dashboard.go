@@ -0,0 +1,97 @@
+package api
+
+import (
+	"embed"
+	"github.com/benyaa/virtual-printer-process-engine/engine"
+	"github.com/benyaa/virtual-printer-process-engine/repo"
+	"io/fs"
+	"net/http"
+	"sort"
+)
+
+//go:embed dashboard
+var embeddedDashboard embed.FS
+
+var dashboardFiles, _ = fs.Sub(embeddedDashboard, "dashboard")
+
+// maxDashboardJobs is the number of recent jobs the dashboard shows.
+const maxDashboardJobs = 100
+
+type dashboardState struct {
+	Jobs         []repo.Job                          `json:"jobs"`
+	QueueDepth   int                                 `json:"queue_depth"`
+	IntakePaused bool                                `json:"intake_paused"`
+	AdminEnabled bool                                `json:"admin_enabled"`
+	Pipelines    map[string][]engine.PipelineHandler `json:"pipelines"`
+	Handlers     []handlerStats                      `json:"handlers"`
+}
+
+// handlerStats are the durations and failures of a pipeline's handler over the jobs in the job store.
+type handlerStats struct {
+	Pipeline          string `json:"pipeline"`
+	HandlerID         string `json:"handler_id"`
+	HandlerName       string `json:"handler_name"`
+	Runs              int    `json:"runs"`
+	Failures          int    `json:"failures"`
+	AverageDurationMs int64  `json:"average_duration_ms"`
+	MaxDurationMs     int64  `json:"max_duration_ms"`
+}
+
+func (s *Server) getDashboard(w http.ResponseWriter, r *http.Request) {
+	jobs := s.jobStore.List()
+	recentJobs := make([]repo.Job, 0, min(len(jobs), maxDashboardJobs))
+	for _, job := range jobs[:min(len(jobs), maxDashboardJobs)] {
+		// the metadata can hold the documents' contents, and the dashboard doesn't show it
+		job.Metadata = nil
+		recentJobs = append(recentJobs, job)
+	}
+	state := dashboardState{
+		Jobs:         recentJobs,
+		QueueDepth:   s.engine.QueueDepth(),
+		IntakePaused: s.engine.IsIntakePaused(),
+		AdminEnabled: s.conf.API.AdminToken != "",
+		Pipelines:    s.engine.GetPipelines(),
+		Handlers:     getHandlerStats(jobs),
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+// getHandlerStats sums up the finished handler runs of the jobs.
+func getHandlerStats(jobs []repo.Job) []handlerStats {
+	type key struct{ pipeline, handlerID string }
+	statsByHandler := map[key]*handlerStats{}
+	totalDurations := map[key]int64{}
+	for _, job := range jobs {
+		for _, run := range job.Handlers {
+			if run.FinishedAt.IsZero() {
+				continue
+			}
+			k := key{job.Pipeline, run.HandlerID}
+			stats, ok := statsByHandler[k]
+			if !ok {
+				stats = &handlerStats{Pipeline: job.Pipeline, HandlerID: run.HandlerID, HandlerName: run.HandlerName}
+				statsByHandler[k] = stats
+			}
+			duration := run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+			stats.Runs++
+			stats.MaxDurationMs = max(stats.MaxDurationMs, duration)
+			totalDurations[k] += duration
+			if run.Error != "" {
+				stats.Failures++
+			}
+		}
+	}
+
+	handlers := []handlerStats{}
+	for k, stats := range statsByHandler {
+		stats.AverageDurationMs = totalDurations[k] / int64(stats.Runs)
+		handlers = append(handlers, *stats)
+	}
+	sort.Slice(handlers, func(i, j int) bool {
+		if handlers[i].Pipeline != handlers[j].Pipeline {
+			return handlers[i].Pipeline < handlers[j].Pipeline
+		}
+		return handlers[i].HandlerID < handlers[j].HandlerID
+	})
+	return handlers
+}
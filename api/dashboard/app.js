@@ -0,0 +1,191 @@
+"use strict";
+
+const refreshIntervalMs = 3000;
+
+// tokenDeclined stops asking for the admin token on every refresh once it wasn't entered
+let tokenDeclined = false;
+
+// the admin token is asked for once, when it's required, and kept for the browser session
+function getAdminToken() {
+    let token = sessionStorage.getItem("adminToken");
+    if (!token) {
+        token = prompt("Admin token");
+        if (token) {
+            sessionStorage.setItem("adminToken", token);
+        }
+    }
+    return token;
+}
+
+async function adminRequest(method, url, body) {
+    const token = getAdminToken();
+    if (!token) {
+        return null;
+    }
+    const response = await fetch(url, {
+        method: method,
+        headers: {"Authorization": "Bearer " + token},
+        body: body,
+    });
+    if (response.status === 401) {
+        sessionStorage.removeItem("adminToken");
+    }
+    if (!response.ok) {
+        const error = await response.json().catch(() => ({error: response.statusText}));
+        alert("Failed: " + error.error);
+        return null;
+    }
+    return response;
+}
+
+async function retry(sessionID) {
+    const response = await adminRequest("POST", `/api/admin/sessions/${sessionID}/retry`, "{}");
+    if (response) {
+        refresh();
+    }
+}
+
+async function download(sessionID) {
+    const response = await adminRequest("GET", `/api/admin/sessions/${sessionID}/artifact`);
+    if (!response) {
+        return;
+    }
+    const disposition = response.headers.get("Content-Disposition") || "";
+    const match = disposition.match(/filename="?([^"]+)"?/);
+    const link = document.createElement("a");
+    link.href = URL.createObjectURL(await response.blob());
+    link.download = match ? match[1] : sessionID;
+    link.click();
+    URL.revokeObjectURL(link.href);
+}
+
+function element(tag, text, className) {
+    const e = document.createElement(tag);
+    if (text !== undefined) {
+        e.textContent = text;
+    }
+    if (className) {
+        e.className = className;
+    }
+    return e;
+}
+
+function row(...cells) {
+    const tr = document.createElement("tr");
+    for (const cell of cells) {
+        tr.appendChild(cell instanceof Node ? cell : element("td", cell));
+    }
+    return tr;
+}
+
+function formatDuration(ms) {
+    if (ms < 1000) {
+        return ms + " ms";
+    }
+    return (ms / 1000).toFixed(1) + " s";
+}
+
+function formatTime(time) {
+    return new Date(time).toLocaleString();
+}
+
+function jobDuration(job) {
+    if (!job.handlers || job.handlers.length === 0) {
+        return "";
+    }
+    const last = job.handlers[job.handlers.length - 1];
+    const end = last.finished_at && !last.finished_at.startsWith("0001") ? new Date(last.finished_at) : new Date();
+    return formatDuration(end - new Date(job.handlers[0].started_at));
+}
+
+function renderPipelines(pipelines) {
+    const container = document.getElementById("pipelines");
+    container.replaceChildren();
+    for (const name of Object.keys(pipelines).sort()) {
+        const pipeline = element("div", undefined, "pipeline");
+        pipeline.appendChild(element("span", name, "name"));
+        pipelines[name].forEach((handler, i) => {
+            if (i > 0) {
+                pipeline.appendChild(element("span", "→", "arrow"));
+            }
+            const box = element("span", handler.id, "handler" + (handler.checkpoint ? " checkpoint" : ""));
+            box.title = `${handler.name}, namespace ${handler.namespace}, ${handler.max_retries} retries`;
+            box.appendChild(element("small", handler.name + (handler.checkpoint ? " (checkpoint)" : "")));
+            pipeline.appendChild(box);
+        });
+        container.appendChild(pipeline);
+    }
+}
+
+function renderFailures(jobs, adminEnabled) {
+    const failures = document.getElementById("failures");
+    failures.replaceChildren();
+    for (const job of jobs.filter(job => job.status === "failed")) {
+        const actions = element("td");
+        if (adminEnabled) {
+            const retryButton = element("button", "Retry");
+            retryButton.onclick = () => retry(job.session_id);
+            const downloadButton = element("button", "Download input");
+            downloadButton.title = "Download the file the failed handler got";
+            downloadButton.onclick = () => download(job.session_id);
+            actions.append(retryButton, downloadButton);
+        }
+        failures.appendChild(row(formatTime(job.created_at), job.session_id, job.pipeline, job.handler_id || "",
+            element("td", job.error, "error"), actions));
+    }
+}
+
+function renderJobs(jobs) {
+    const rows = document.getElementById("jobs");
+    rows.replaceChildren();
+    for (const job of jobs) {
+        const status = element("td");
+        status.appendChild(element("span", job.status, "status " + job.status));
+        rows.appendChild(row(formatTime(job.created_at), job.session_id, job.pipeline, status, job.handler_id || "", jobDuration(job)));
+    }
+}
+
+function renderHandlers(handlers) {
+    const rows = document.getElementById("handlers");
+    rows.replaceChildren();
+    for (const handler of handlers) {
+        rows.appendChild(row(handler.pipeline, handler.handler_id, String(handler.runs), String(handler.failures),
+            formatDuration(handler.average_duration_ms), formatDuration(handler.max_duration_ms)));
+    }
+}
+
+// the state requires the admin token when the admin API is enabled
+async function fetchState() {
+    let token = sessionStorage.getItem("adminToken");
+    let response = await fetch("/api/dashboard", {headers: token ? {"Authorization": "Bearer " + token} : {}});
+    if (response.status === 401 && !tokenDeclined) {
+        sessionStorage.removeItem("adminToken");
+        token = getAdminToken();
+        tokenDeclined = !token;
+        if (token) {
+            response = await fetch("/api/dashboard", {headers: {"Authorization": "Bearer " + token}});
+        }
+    }
+    if (!response.ok) {
+        throw new Error(response.status === 401 ? "the admin token is required" : response.statusText);
+    }
+    return response.json();
+}
+
+async function refresh() {
+    try {
+        const state = await fetchState();
+        document.getElementById("queue-depth").textContent = state.queue_depth;
+        document.getElementById("intake").textContent = state.intake_paused ? "Intake paused" : "";
+        document.getElementById("updated").textContent = "Updated " + new Date().toLocaleTimeString();
+        renderPipelines(state.pipelines);
+        renderFailures(state.jobs, state.admin_enabled);
+        renderJobs(state.jobs);
+        renderHandlers(state.handlers);
+    } catch (e) {
+        document.getElementById("updated").textContent = "Failed to update: " + e;
+    }
+}
+
+refresh();
+setInterval(refresh, refreshIntervalMs);
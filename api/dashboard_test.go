@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/engine"
+	"github.com/benyaa/virtual-printer-process-engine/repo"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDashboard(t *testing.T) {
+	conf := config.Config{}
+	conf.API.Dashboard = true
+	jobStore := repo.NewMemoryJobStore(0)
+	e := &fakeEngine{
+		queueDepth: 3,
+		pipelines:  map[string][]engine.PipelineHandler{config.DefaultPipeline: {{ID: "WriteFile_0", Name: "WriteFile"}}},
+	}
+	s := NewServer(conf, t.TempDir(), nil, e, jobStore, &fakeWriteAheadLogger{})
+
+	start := time.Now()
+	for i, duration := range []time.Duration{100 * time.Millisecond, 300 * time.Millisecond} {
+		jobStore.Update(uuid.New(), func(job *repo.Job) {
+			job.Pipeline = config.DefaultPipeline
+			job.Status = repo.JobCompleted
+			run := repo.HandlerRun{HandlerName: "WriteFile", HandlerID: "WriteFile_0", StartedAt: start, FinishedAt: start.Add(duration)}
+			if i == 1 {
+				job.Status = repo.JobFailed
+				run.Error = "disk full"
+			}
+			job.Handlers = append(job.Handlers, run)
+			job.Metadata = map[string]interface{}{"Job.Title": "invoice"}
+		})
+	}
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/dashboard", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var state dashboardState
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &state))
+	assert.Len(t, state.Jobs, 2)
+	assert.NotContains(t, recorder.Body.String(), "metadata")
+	assert.Equal(t, 3, state.QueueDepth)
+	assert.False(t, state.AdminEnabled)
+	assert.Equal(t, e.pipelines, state.Pipelines)
+	assert.Equal(t, []handlerStats{{
+		Pipeline:          config.DefaultPipeline,
+		HandlerID:         "WriteFile_0",
+		HandlerName:       "WriteFile",
+		Runs:              2,
+		Failures:          1,
+		AverageDurationMs: 200,
+		MaxDurationMs:     300,
+	}}, state.Handlers)
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/dashboard/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "app.js")
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusFound, recorder.Code)
+	assert.Equal(t, "/dashboard/", recorder.Header().Get("Location"))
+}
+
+func TestDashboard_RequiresAdminToken(t *testing.T) {
+	conf := config.Config{}
+	conf.API.Dashboard = true
+	conf.API.AdminToken = "secret"
+	s := NewServer(conf, t.TempDir(), nil, &fakeEngine{}, repo.NewMemoryJobStore(0), &fakeWriteAheadLogger{})
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/dashboard", nil))
+	assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+
+	recorder = sendAdminRequest(s, http.MethodGet, "/api/dashboard", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var state dashboardState
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &state))
+	assert.True(t, state.AdminEnabled)
+}
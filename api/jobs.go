@@ -0,0 +1,263 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/repo"
+	"github.com/benyaa/virtual-printer-process-engine/utils"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var errUploadTooLarge = errors.New("the upload is too large")
+
+// upload is a document submitted to the API, with its job attributes.
+type upload struct {
+	document io.Reader
+	filename string
+	pipeline string
+	metadata string
+}
+
+// submitJob accepts a document as a multipart upload(fields `file`, `pipeline` and `metadata`)
+// or as the raw request body(query parameters `filename`, `pipeline` and `metadata`), and submits it to the engine.
+func (s *Server) submitJob(w http.ResponseWriter, r *http.Request) {
+	maxSize := int64(s.conf.API.MaxUploadSizeMB) * 1024 * 1024
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+
+	u, err := getUpload(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !s.conf.HasPipeline(u.pipeline) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown pipeline %s", u.pipeline))
+		return
+	}
+	attributes, err := parseMetadata(u.metadata)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	outputPath := filepath.Join(s.jobsDir, fmt.Sprintf("api_%s", uuid.New().String()[0:8]))
+	printInfo, err := s.spool(u.document, outputPath)
+	if err != nil {
+		os.Remove(outputPath)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, errUploadTooLarge)
+			return
+		}
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	for key, value := range attributes {
+		printInfo.Attributes[key] = value
+	}
+	printInfo.SessionID = uuid.New()
+	printInfo.Pipeline = u.pipeline
+	printInfo.Source = "api"
+	printInfo.Title = strings.TrimSuffix(u.filename, filepath.Ext(u.filename))
+	printInfo.Host = host
+	printInfo.Copies = 1
+	printInfo.SubmittedAt = time.Now()
+	printInfo.OriginalFilename = u.filename
+
+	s.jobStore.Update(printInfo.SessionID, func(job *repo.Job) {
+		job.Pipeline = u.pipeline
+		job.Status = repo.JobQueued
+	})
+	select {
+	case s.channel <- printInfo:
+		log.Infof("submitted %s from %s as session %s", printInfo.Filepath, host, printInfo.SessionID)
+		writeJSON(w, http.StatusAccepted, map[string]string{"session_id": printInfo.SessionID.String()})
+	case <-r.Context().Done():
+		os.Remove(printInfo.Filepath)
+		s.jobStore.Update(printInfo.SessionID, func(job *repo.Job) {
+			job.Status = repo.JobFailed
+			job.Error = "the request was canceled before the engine accepted the job"
+		})
+	}
+}
+
+func getUpload(r *http.Request) (upload, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		query := r.URL.Query()
+		return upload{
+			document: r.Body,
+			filename: query.Get("filename"),
+			pipeline: query.Get("pipeline"),
+			metadata: query.Get("metadata"),
+		}, nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return upload{}, err
+	}
+	u := upload{}
+	// the fields are read until the file, so they must come before it
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return upload{}, errors.New("the upload has no file field")
+		}
+		if err != nil {
+			return upload{}, err
+		}
+		switch part.FormName() {
+		case "file":
+			u.document = part
+			u.filename = part.FileName()
+			return u, nil
+		case "pipeline", "metadata":
+			value, err := io.ReadAll(io.LimitReader(part, 64*1024))
+			if err != nil {
+				return upload{}, err
+			}
+			if part.FormName() == "pipeline" {
+				u.pipeline = string(value)
+			} else {
+				u.metadata = string(value)
+			}
+		}
+	}
+}
+
+// parseMetadata parses the metadata JSON object into job attributes.
+func parseMetadata(metadata string) (map[string]string, error) {
+	attributes := map[string]string{}
+	if metadata == "" {
+		return attributes, nil
+	}
+	var values map[string]interface{}
+	err := json.Unmarshal([]byte(metadata), &values)
+	if err != nil {
+		return nil, fmt.Errorf("metadata must be a JSON object: %w", err)
+	}
+	for key, value := range values {
+		if str, ok := value.(string); ok {
+			attributes[key] = str
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		attributes[key] = string(encoded)
+	}
+	return attributes, nil
+}
+
+// spool writes the document to outputPath, with the extension of its type.
+func (s *Server) spool(document io.Reader, outputPath string) (definitions.PrintInfo, error) {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return definitions.PrintInfo{}, fmt.Errorf("failed to create job file: %w", err)
+	}
+	_, err = io.Copy(file, document)
+	file.Close()
+	if err != nil {
+		return definitions.PrintInfo{}, err
+	}
+
+	documentType, err := utils.DetectFileDocumentType(outputPath)
+	if err != nil {
+		return definitions.PrintInfo{}, fmt.Errorf("failed to detect document type: %w", err)
+	}
+	if documentType == utils.DocumentUnknown {
+		return definitions.PrintInfo{}, errors.New("unsupported document type")
+	}
+
+	typedPath := outputPath + documentType.Extension()
+	err = os.Rename(outputPath, typedPath)
+	if err != nil {
+		return definitions.PrintInfo{}, fmt.Errorf("failed to rename job file: %w", err)
+	}
+	pages, err := utils.CountPages(typedPath, documentType)
+	if err != nil {
+		os.Remove(typedPath)
+		return definitions.PrintInfo{}, fmt.Errorf("failed to count pages: %w", err)
+	}
+	return definitions.PrintInfo{
+		Filepath: typedPath,
+		Pages:    pages,
+		Attributes: map[string]string{
+			"DocumentType": string(documentType),
+		},
+	}, nil
+}
+
+// getJob returns the status of a session from the job store, or from the WAL for sessions from before a restart.
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := getSessionID(w, r)
+	if !ok {
+		return
+	}
+
+	job, ok := s.jobStore.Get(sessionID)
+	if !ok {
+		var err error
+		job, ok, err = s.getJobFromWAL(sessionID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("session %s not found", sessionID))
+		return
+	}
+	// the endpoint isn't authenticated, and the metadata can hold the documents' contents
+	job.Metadata = nil
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (s *Server) getJobFromWAL(sessionID uuid.UUID) (repo.Job, bool, error) {
+	entries, err := s.writeAheadLogger.ReadEntries()
+	if err != nil {
+		return repo.Job{}, false, fmt.Errorf("failed to read WAL: %w", err)
+	}
+
+	var job *repo.Job
+	for _, entry := range entries {
+		if entry.SessionID != sessionID {
+			continue
+		}
+		if job == nil {
+			job = &repo.Job{SessionID: sessionID}
+		}
+		job.Pipeline = entry.Pipeline
+		if entry.HandlerName == "__end__" {
+			job.Status = repo.JobCompleted
+			continue
+		}
+		// the session didn't end before the restart, so it's resumed by the recovery
+		job.Status = repo.JobProcessing
+		if entry.HandlerName != "__init__" {
+			job.HandlerName = entry.HandlerName
+			job.HandlerID = entry.HandlerID
+		}
+	}
+	if job == nil {
+		return repo.Job{}, false, nil
+	}
+	return *job, true, nil
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/repo"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeWriteAheadLogger struct {
+	entries []repo.LogEntry
+}
+
+func (l *fakeWriteAheadLogger) WriteEntry(entry repo.LogEntry) {
+	l.entries = append(l.entries, entry)
+}
+
+func (l *fakeWriteAheadLogger) ReadEntries() ([]repo.LogEntry, error) {
+	return l.entries, nil
+}
+
+func newTestServer(t *testing.T, channel chan definitions.PrintInfo, wal repo.WriteAheadLogger) (*Server, repo.JobStore) {
+	conf := config.Config{}
+	conf.Engine.Pipelines = map[string]config.PipelineConfig{"reports": {}}
+	conf.API.MaxUploadSizeMB = 1
+	jobStore := repo.NewMemoryJobStore(0)
+	return NewServer(conf, t.TempDir(), channel, nil, jobStore, wal), jobStore
+}
+
+func TestSubmitJob_Multipart(t *testing.T) {
+	channel := make(chan definitions.PrintInfo, 1)
+	s, jobStore := newTestServer(t, channel, &fakeWriteAheadLogger{})
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	assert.NoError(t, writer.WriteField("pipeline", "reports"))
+	assert.NoError(t, writer.WriteField("metadata", `{"Customer": "ACME", "Priority": 2}`))
+	part, err := writer.CreateFormFile("file", "report.txt")
+	assert.NoError(t, err)
+	part.Write([]byte("hello world\n"))
+	assert.NoError(t, writer.Close())
+
+	request := httptest.NewRequest(http.MethodPost, "/api/jobs", body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, request)
+
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	var response map[string]string
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+
+	printInfo := <-channel
+	assert.Equal(t, response["session_id"], printInfo.SessionID.String())
+	assert.Equal(t, "reports", printInfo.Pipeline)
+	assert.Equal(t, "api", printInfo.Source)
+	assert.Equal(t, "report", printInfo.Title)
+	assert.Equal(t, "report.txt", printInfo.OriginalFilename)
+	assert.Equal(t, "ACME", printInfo.Attributes["Customer"])
+	assert.Equal(t, "2", printInfo.Attributes["Priority"])
+	contents, err := os.ReadFile(printInfo.Filepath)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world\n", string(contents))
+
+	job, ok := jobStore.Get(printInfo.SessionID)
+	assert.True(t, ok)
+	assert.Equal(t, repo.JobQueued, job.Status)
+}
+
+func TestSubmitJob_Raw(t *testing.T) {
+	channel := make(chan definitions.PrintInfo, 1)
+	s, _ := newTestServer(t, channel, &fakeWriteAheadLogger{})
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/jobs?filename=doc.ps", strings.NewReader("%!PS-Adobe-3.0\n")))
+	assert.Equal(t, http.StatusAccepted, recorder.Code)
+	printInfo := <-channel
+	assert.Equal(t, "", printInfo.Pipeline)
+	assert.Equal(t, "postscript", printInfo.Attributes["DocumentType"])
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/jobs?pipeline=unknown", strings.NewReader("hello")))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/jobs", strings.NewReader("\x00\x01\x02")))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/api/jobs", strings.NewReader(strings.Repeat("a", 1024*1024+1))))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+}
+
+func TestGetJob(t *testing.T) {
+	walSession := uuid.New()
+	wal := &fakeWriteAheadLogger{entries: []repo.LogEntry{
+		{SessionID: walSession, HandlerName: "__init__", HandlerID: "__init__", Pipeline: "reports"},
+		{SessionID: walSession, HandlerName: "WriteFile", HandlerID: "WriteFile_0", Pipeline: "reports",
+			FlowObject: definitions.EngineFlowObject{Metadata: map[string]interface{}{"Job.User": "alice"}}},
+	}}
+	s, jobStore := newTestServer(t, nil, wal)
+	storeSession := uuid.New()
+	jobStore.Update(storeSession, func(job *repo.Job) {
+		job.Status = repo.JobFailed
+		job.Error = "boom"
+		job.Metadata = map[string]interface{}{"Job.User": "alice"}
+	})
+
+	tests := map[string]struct {
+		status  int
+		session string
+		job     repo.JobStatus
+		handler string
+	}{
+		"job store":  {status: http.StatusOK, session: storeSession.String(), job: repo.JobFailed},
+		"WAL":        {status: http.StatusOK, session: walSession.String(), job: repo.JobProcessing, handler: "WriteFile"},
+		"not found":  {status: http.StatusNotFound, session: uuid.NewString()},
+		"invalid id": {status: http.StatusBadRequest, session: "nope"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/jobs/"+test.session, nil))
+			assert.Equal(t, test.status, recorder.Code)
+			if test.status != http.StatusOK {
+				return
+			}
+			var job repo.Job
+			assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &job))
+			assert.Equal(t, test.job, job.Status)
+			assert.Equal(t, test.handler, job.HandlerName)
+			assert.NotContains(t, recorder.Body.String(), "alice")
+		})
+	}
+}
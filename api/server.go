@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/engine"
+	"github.com/benyaa/virtual-printer-process-engine/repo"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+)
+
+// Engine is what the admin API and the dashboard manage.
+type Engine interface {
+	RetrySession(sessionID uuid.UUID, handlerID string) error
+	CancelSession(sessionID uuid.UUID) error
+	GetArtifact(sessionID uuid.UUID, handlerID string) (string, error)
+	PauseIntake()
+	ResumeIntake()
+	IsIntakePaused() bool
+	QueueDepth() int
+	GetPipelines() map[string][]engine.PipelineHandler
+}
+
+// Server is the local HTTP API of the engine.
+type Server struct {
+	conf             config.Config
+	jobsDir          string
+	channel          chan definitions.PrintInfo
+	engine           Engine
+	jobStore         repo.JobStore
+	writeAheadLogger repo.WriteAheadLogger
+	mux              *http.ServeMux
+}
+
+func NewServer(conf config.Config, jobsDir string, channel chan definitions.PrintInfo, engine Engine, jobStore repo.JobStore, writeAheadLogger repo.WriteAheadLogger) *Server {
+	if conf.API.Address == "" {
+		conf.API.Address = "127.0.0.1:8632"
+	}
+	if conf.API.MaxUploadSizeMB == 0 {
+		conf.API.MaxUploadSizeMB = 100
+	}
+
+	s := &Server{
+		conf:             conf,
+		jobsDir:          jobsDir,
+		channel:          channel,
+		engine:           engine,
+		jobStore:         jobStore,
+		writeAheadLogger: writeAheadLogger,
+		mux:              http.NewServeMux(),
+	}
+	s.mux.HandleFunc("POST /api/jobs", s.submitJob)
+	s.mux.HandleFunc("GET /api/jobs/{sessionID}", s.getJob)
+	if conf.API.AdminToken != "" {
+		s.mux.Handle("GET /api/admin/sessions", s.authenticate(s.listSessions))
+		s.mux.Handle("GET /api/admin/sessions/{sessionID}", s.authenticate(s.inspectSession))
+		s.mux.Handle("POST /api/admin/sessions/{sessionID}/retry", s.authenticate(s.retrySession))
+		s.mux.Handle("POST /api/admin/sessions/{sessionID}/cancel", s.authenticate(s.cancelSession))
+		s.mux.Handle("GET /api/admin/sessions/{sessionID}/artifact", s.authenticate(s.downloadArtifact))
+		s.mux.Handle("GET /api/admin/intake", s.authenticate(s.getIntake))
+		s.mux.Handle("POST /api/admin/intake/pause", s.authenticate(s.pauseIntake))
+		s.mux.Handle("POST /api/admin/intake/resume", s.authenticate(s.resumeIntake))
+	} else {
+		log.Infof("admin API is disabled, set api.admin_token to enable it")
+	}
+	if conf.API.Dashboard {
+		s.mux.Handle("GET /dashboard/", http.StripPrefix("/dashboard/", http.FileServerFS(dashboardFiles)))
+		s.mux.Handle("GET /{$}", http.RedirectHandler("/dashboard/", http.StatusFound))
+		if conf.API.AdminToken != "" {
+			// the dashboard shows the failures of every session, so it's as private as the admin API
+			s.mux.Handle("GET /api/dashboard", s.authenticate(s.getDashboard))
+		} else {
+			s.mux.HandleFunc("GET /api/dashboard", s.getDashboard)
+		}
+	}
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Run serves the API until ctx is done.
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.conf.API.Address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.conf.API.Address, err)
+	}
+	log.Infof("API listening on %s", listener.Addr())
+
+	server := &http.Server{Handler: s}
+	go func() {
+		<-ctx.Done()
+		log.Infof("context canceled, stopping API")
+		server.Shutdown(context.Background())
+	}()
+
+	err = server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(body)
+	if err != nil {
+		log.WithError(err).Errorf("failed to write API response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,150 @@
+package audit
+
+import (
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+const (
+	HandlerSucceeded = "success"
+	HandlerFailed    = "error"
+)
+
+// Record is the audit record of a session, written when it finishes.
+type Record struct {
+	Time        time.Time `json:"time"`
+	SessionID   uuid.UUID `json:"session_id"`
+	Source      string    `json:"source"`
+	User        string    `json:"user"`
+	Host        string    `json:"host"`
+	Title       string    `json:"title"`
+	Pages       int       `json:"pages"`
+	Pipeline    string    `json:"pipeline"`
+	ContentHash string    `json:"content_hash,omitempty"`
+	// Status is the final status of the session, completed, failed or canceled
+	Status   string          `json:"status"`
+	Error    string          `json:"error,omitempty"`
+	Handlers []HandlerResult `json:"handlers"`
+	// Destinations are where the document was sent, e.g. the files it was written to and the URLs it was uploaded to
+	Destinations []string `json:"destinations"`
+}
+
+type HandlerResult struct {
+	HandlerID   string `json:"handler_id"`
+	HandlerName string `json:"handler_name"`
+	Result      string `json:"result"`
+	DurationMs  int64  `json:"duration_ms"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Sink is where the audit records are written.
+type Sink interface {
+	Write(record Record) error
+	Close() error
+}
+
+// bufferSize is how many records can wait for the sinks before Log blocks.
+const bufferSize = 1000
+
+// Logger writes the audit records to all the configured sinks, in the background so slow sinks don't hold up
+// the sessions.
+type Logger struct {
+	sinks   []Sink
+	mutex   sync.RWMutex
+	closed  bool
+	records chan Record
+	done    chan struct{}
+}
+
+// New creates a logger with the sinks in the config. A logger without sinks discards the records.
+func New(conf config.AuditConfig) (*Logger, error) {
+	var sinks []Sink
+	for _, sinkConf := range conf.Sinks {
+		sink, err := newSink(sinkConf)
+		if err != nil {
+			for _, sink := range sinks {
+				sink.Close()
+			}
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	return newLogger(sinks), nil
+}
+
+func newLogger(sinks []Sink) *Logger {
+	l := &Logger{
+		sinks:   sinks,
+		records: make(chan Record, bufferSize),
+		done:    make(chan struct{}),
+	}
+	go l.write()
+	return l
+}
+
+func newSink(conf config.AuditSinkConfig) (Sink, error) {
+	switch conf.Type {
+	case config.AuditSinkFile:
+		return newFileSink(conf)
+	case config.AuditSinkSyslog:
+		return newSyslogSink(conf)
+	case config.AuditSinkHTTP:
+		return newHTTPSink(conf)
+	default:
+		return nil, fmt.Errorf("unknown audit sink type %s", conf.Type)
+	}
+}
+
+// Log queues the record to be written to the sinks, and only blocks when bufferSize records are already waiting.
+func (l *Logger) Log(record Record) {
+	if l == nil || len(l.sinks) == 0 {
+		return
+	}
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if l.closed {
+		log.Warnf("audit log is closed, dropping the record of session %s", record.SessionID)
+		return
+	}
+	l.records <- record
+}
+
+// write writes the queued records to every sink, a failing sink doesn't stop the others.
+func (l *Logger) write() {
+	defer close(l.done)
+	for record := range l.records {
+		for _, sink := range l.sinks {
+			err := sink.Write(record)
+			if err != nil {
+				log.WithError(err).Errorf("failed to write audit record of session %s", record.SessionID)
+			}
+		}
+	}
+}
+
+// Close writes the queued records and closes the sinks.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mutex.Lock()
+	if l.closed {
+		l.mutex.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.records)
+	l.mutex.Unlock()
+	<-l.done
+
+	var errs []error
+	for _, sink := range l.sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
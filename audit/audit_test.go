@@ -0,0 +1,120 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogger_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l, err := New(config.AuditConfig{Sinks: []config.AuditSinkConfig{{Type: config.AuditSinkFile, Path: path}}})
+	assert.NoError(t, err)
+
+	records := []Record{
+		{SessionID: uuid.New(), Status: "completed", Destinations: []string{"/tmp/out.pdf"}},
+		{SessionID: uuid.New(), Status: "failed", Error: "boom"},
+	}
+	for _, record := range records {
+		l.Log(record)
+	}
+	assert.NoError(t, l.Close())
+
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for _, expected := range records {
+		assert.True(t, scanner.Scan())
+		var record Record
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		assert.Equal(t, expected.SessionID, record.SessionID)
+		assert.Equal(t, expected.Status, record.Status)
+		assert.Equal(t, expected.Error, record.Error)
+	}
+	assert.False(t, scanner.Scan())
+}
+
+func TestLogger_HTTP(t *testing.T) {
+	received := make(chan Record, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		body, _ := io.ReadAll(r.Body)
+		var record Record
+		assert.NoError(t, json.Unmarshal(body, &record))
+		received <- record
+	}))
+	defer server.Close()
+
+	l, err := New(config.AuditConfig{Sinks: []config.AuditSinkConfig{{
+		Type:    config.AuditSinkHTTP,
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	}}})
+	assert.NoError(t, err)
+	sessionID := uuid.New()
+	l.Log(Record{SessionID: sessionID, Pages: 2})
+	record := <-received
+	assert.Equal(t, sessionID, record.SessionID)
+	assert.Equal(t, 2, record.Pages)
+}
+
+// blockingSink waits for release before it writes a record.
+type blockingSink struct {
+	release chan struct{}
+	records []Record
+}
+
+func (s *blockingSink) Write(record Record) error {
+	<-s.release
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *blockingSink) Close() error {
+	return nil
+}
+
+func TestLogger_SlowSinkDoesNotBlock(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	l := newLogger([]Sink{sink})
+
+	logged := make(chan struct{})
+	go func() {
+		l.Log(Record{SessionID: uuid.New()})
+		l.Log(Record{SessionID: uuid.New()})
+		close(logged)
+	}()
+	select {
+	case <-logged:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Log blocked on the sink")
+	}
+
+	// the queued records are written before Close returns
+	close(sink.release)
+	assert.NoError(t, l.Close())
+	assert.Len(t, sink.records, 2)
+	l.Log(Record{SessionID: uuid.New()})
+	assert.Len(t, sink.records, 2)
+}
+
+func TestNew_Invalid(t *testing.T) {
+	_, err := New(config.AuditConfig{Sinks: []config.AuditSinkConfig{{Type: "kafka"}}})
+	assert.Error(t, err)
+	_, err = New(config.AuditConfig{Sinks: []config.AuditSinkConfig{{Type: config.AuditSinkFile}}})
+	assert.Error(t, err)
+
+	var l *Logger
+	l.Log(Record{})
+}
@@ -0,0 +1,46 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"sync"
+)
+
+// fileSink appends the records to a JSONL file, which is rotated like the logs.
+type fileSink struct {
+	mutex  sync.Mutex
+	writer *lumberjack.Logger
+}
+
+func newFileSink(conf config.AuditSinkConfig) (*fileSink, error) {
+	if conf.Path == "" {
+		return nil, errors.New("the file audit sink requires a path")
+	}
+	return &fileSink{
+		writer: &lumberjack.Logger{
+			Filename:   conf.Path,
+			MaxSize:    conf.MaxSizeMB,
+			MaxBackups: conf.MaxBackups,
+			MaxAge:     conf.MaxAgeDays,
+			Compress:   true,
+		},
+	}, nil
+}
+
+func (s *fileSink) Write(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, err = s.writer.Write(append(line, '\n'))
+	return err
+}
+
+func (s *fileSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/utils"
+	"io"
+	"net/http"
+	"time"
+)
+
+// httpSink posts each record as JSON to an endpoint.
+type httpSink struct {
+	url     string
+	headers map[string]string
+	client  utils.HTTPClient
+}
+
+func newHTTPSink(conf config.AuditSinkConfig) (*httpSink, error) {
+	if conf.URL == "" {
+		return nil, errors.New("the HTTP audit sink requires a URL")
+	}
+	timeout := conf.TimeoutMs
+	if timeout == 0 {
+		timeout = 5000
+	}
+	return &httpSink{
+		url:     conf.URL,
+		headers: conf.Headers,
+		client:  &utils.DefaultClient{Client: &http.Client{Timeout: time.Duration(timeout) * time.Millisecond}},
+	}, nil
+}
+
+func (s *httpSink) Write(record Record) error {
+	body, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create audit request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send audit record: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("audit endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	return nil
+}
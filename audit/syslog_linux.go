@@ -0,0 +1,37 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"log/syslog"
+)
+
+// syslogSink sends each record as a JSON message to syslog, the local one if the address is empty.
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+func newSyslogSink(conf config.AuditSinkConfig) (*syslogSink, error) {
+	tag := conf.Tag
+	if tag == "" {
+		tag = "virtual-printer-process-engine"
+	}
+	writer, err := syslog.Dial(conf.Network, conf.Address, syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return &syslogSink{writer: writer}, nil
+}
+
+func (s *syslogSink) Write(record Record) error {
+	message, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	return s.writer.Info(string(message))
+}
+
+func (s *syslogSink) Close() error {
+	return s.writer.Close()
+}
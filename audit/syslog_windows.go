@@ -0,0 +1,10 @@
+package audit
+
+import (
+	"errors"
+	"github.com/benyaa/virtual-printer-process-engine/config"
+)
+
+func newSyslogSink(conf config.AuditSinkConfig) (Sink, error) {
+	return nil, errors.New("the syslog audit sink isn't supported on Windows")
+}
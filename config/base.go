@@ -1,5 +1,24 @@
 package config
 
+const DefaultPipeline = "default"
+
+const (
+	PrinterModeCUPSPDF = "cups-pdf"
+	PrinterModeBackend = "backend"
+)
+
+const (
+	AuditSinkFile   = "file"
+	AuditSinkSyslog = "syslog"
+	AuditSinkHTTP   = "http"
+)
+
+const (
+	TracingExporterOTLP   = "otlp"
+	TracingExporterStdout = "stdout"
+	TracingExporterFile   = "file"
+)
+
 type BaseLogsConfig struct {
 	Level      string `yaml:"level"`
 	MaxSizeMB  int    `yaml:"max_size_mb"`
@@ -21,25 +40,174 @@ type Config struct {
 	WriteAheadLogging WriteAheadLogging `yaml:"write_ahead_logging"`
 
 	Printer struct {
-		Name            string `yaml:"name"`
-		MonitorInterval int    `yaml:"monitor_interval_ms"`
+		Name               string `yaml:"name"`
+		MonitorInterval    int    `yaml:"monitor_interval_ms"`
+		OutputDir          string `yaml:"output_dir,omitempty"`
+		UsePolling         bool   `yaml:"use_polling,omitempty"`
+		StableForMs        int    `yaml:"stable_for_ms,omitempty"`
+		QuarantineDir      string `yaml:"quarantine_dir,omitempty"`
+		Mode               string `yaml:"mode,omitempty"` // how jobs get from CUPS to the engine on Linux, cups-pdf(default) or backend
+		BackendSocket      string `yaml:"backend_socket,omitempty"`
+		BackendSocketGroup string `yaml:"backend_socket_group,omitempty"`
+		BackendDir         string `yaml:"backend_dir,omitempty"`
 	} `yaml:"printer"`
 
 	Engine struct {
-		Handlers             []HandlerConfig `yaml:"handlers"`
-		IgnoreRecoveryErrors bool            `yaml:"ignore_recovery_errors"`
-		MaxWorkers           int             `yaml:"max_workers"`
+		Handlers             []HandlerConfig           `yaml:"handlers"`
+		Pipelines            map[string]PipelineConfig `yaml:"pipelines,omitempty"`
+		IgnoreRecoveryErrors bool                      `yaml:"ignore_recovery_errors"`
+		MaxWorkers           int                       `yaml:"max_workers"`
+		MemoryFastPath       MemoryFastPath            `yaml:"memory_fast_path"`
 	} `yaml:"engine"`
+
+	Sources struct {
+		Folders []FolderSourceConfig `yaml:"folders,omitempty"`
+		IPP     []IPPSourceConfig    `yaml:"ipp,omitempty"`
+		Raw     []RawSourceConfig    `yaml:"raw,omitempty"`
+		LPD     []LPDSourceConfig    `yaml:"lpd,omitempty"`
+	} `yaml:"sources"`
+
+	API APIConfig `yaml:"api"`
+
+	Metrics MetricsConfig `yaml:"metrics"`
+
+	Tracing TracingConfig `yaml:"tracing"`
+
+	Audit AuditConfig `yaml:"audit"`
+
 	Workdir string `yaml:"workdir"`
 }
 
+// GetPipelines returns all the configured pipelines, where `engine.handlers` is the default pipeline.
+func (c Config) GetPipelines() map[string][]HandlerConfig {
+	pipelines := map[string][]HandlerConfig{}
+	for name, pipeline := range c.Engine.Pipelines {
+		pipelines[name] = pipeline.Handlers
+	}
+	if len(c.Engine.Handlers) > 0 || pipelines[DefaultPipeline] == nil {
+		pipelines[DefaultPipeline] = c.Engine.Handlers
+	}
+	return pipelines
+}
+
+func (c Config) HasPipeline(name string) bool {
+	if name == "" {
+		return true
+	}
+	_, ok := c.GetPipelines()[name]
+	return ok
+}
+
+type PipelineConfig struct {
+	Handlers []HandlerConfig `yaml:"handlers"`
+}
+
+type FolderSourceConfig struct {
+	Name           string   `yaml:"name"`
+	Dirs           []string `yaml:"dirs"`
+	Include        []string `yaml:"include,omitempty"`
+	Exclude        []string `yaml:"exclude,omitempty"`
+	Pipeline       string   `yaml:"pipeline,omitempty"`
+	StableForMs    int      `yaml:"stable_for_ms,omitempty"`
+	PollIntervalMs int      `yaml:"poll_interval_ms,omitempty"`
+	UsePolling     bool     `yaml:"use_polling,omitempty"`
+	QuarantineDir  string   `yaml:"quarantine_dir,omitempty"`
+}
+
+type MemoryFastPath struct {
+	Enabled   bool `yaml:"enabled"`
+	MaxSizeKB int  `yaml:"max_size_kb"`
+}
+
 type HandlerConfig struct {
-	Name   string                 `yaml:"name"`
-	Retry  HandlerRetryMechanism  `yaml:"retry,omitempty"`
-	Config map[string]interface{} `yaml:"config,omitempty"`
+	Name       string                 `yaml:"name"`
+	Alias      string                 `yaml:"alias,omitempty"`
+	Checkpoint bool                   `yaml:"checkpoint,omitempty"`
+	Retry      HandlerRetryMechanism  `yaml:"retry,omitempty"`
+	Config     map[string]interface{} `yaml:"config,omitempty"`
 }
 
 type HandlerRetryMechanism struct {
 	MaxRetries      int `yaml:"max_retries"`
 	BackOffInterval int `yaml:"backoff_interval"`
 }
+
+type IPPSourceConfig struct {
+	Name         string `yaml:"name"`
+	Address      string `yaml:"address,omitempty"`
+	Path         string `yaml:"path,omitempty"`
+	Pipeline     string `yaml:"pipeline,omitempty"`
+	Advertise    bool   `yaml:"advertise,omitempty"`
+	MakeAndModel string `yaml:"make_and_model,omitempty"`
+	Location     string `yaml:"location,omitempty"`
+	Info         string `yaml:"info,omitempty"`
+	MaxJobSizeMB int    `yaml:"max_job_size_mb,omitempty"`
+}
+
+type RawSourceConfig struct {
+	Name          string `yaml:"name"`
+	Address       string `yaml:"address,omitempty"`
+	Pipeline      string `yaml:"pipeline,omitempty"`
+	IdleTimeoutMs int    `yaml:"idle_timeout_ms,omitempty"`
+	MaxJobSizeMB  int    `yaml:"max_job_size_mb,omitempty"`
+}
+
+type LPDSourceConfig struct {
+	Name    string `yaml:"name"`
+	Address string `yaml:"address,omitempty"`
+	// Pipeline is used for the queues without a pipeline in Queues
+	Pipeline string `yaml:"pipeline,omitempty"`
+	// Queues maps the queue names to the pipelines to process their jobs with
+	Queues        map[string]string `yaml:"queues,omitempty"`
+	IdleTimeoutMs int               `yaml:"idle_timeout_ms,omitempty"`
+	MaxJobSizeMB  int               `yaml:"max_job_size_mb,omitempty"`
+}
+
+type APIConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	Address         string `yaml:"address,omitempty"`
+	MaxUploadSizeMB int    `yaml:"max_upload_size_mb,omitempty"`
+	// AdminToken is the bearer token of the admin API, which is disabled if it's empty
+	AdminToken string `yaml:"admin_token,omitempty"`
+	// Dashboard serves the web dashboard at /dashboard/
+	Dashboard bool `yaml:"dashboard,omitempty"`
+}
+
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Address string `yaml:"address,omitempty"`
+}
+
+type TracingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Exporter is where the spans are sent, otlp(default), stdout or file
+	Exporter string `yaml:"exporter,omitempty"`
+	// Endpoint is the host:port of the OTLP HTTP receiver
+	Endpoint    string            `yaml:"endpoint,omitempty"`
+	Insecure    bool              `yaml:"insecure,omitempty"`
+	Headers     map[string]string `yaml:"headers,omitempty"`
+	File        string            `yaml:"file,omitempty"`
+	ServiceName string            `yaml:"service_name,omitempty"`
+}
+
+type AuditConfig struct {
+	Sinks []AuditSinkConfig `yaml:"sinks,omitempty"`
+}
+
+type AuditSinkConfig struct {
+	// Type is file, syslog or http
+	Type string `yaml:"type"`
+	// Path, MaxSizeMB, MaxBackups and MaxAgeDays are of the file sink
+	Path       string `yaml:"path,omitempty"`
+	MaxSizeMB  int    `yaml:"max_size_mb,omitempty"`
+	MaxBackups int    `yaml:"max_backups,omitempty"`
+	MaxAgeDays int    `yaml:"max_age_days,omitempty"`
+	// Network, Address and Tag are of the syslog sink, the local syslog is used if Address is empty
+	Network string `yaml:"network,omitempty"`
+	Address string `yaml:"address,omitempty"`
+	Tag     string `yaml:"tag,omitempty"`
+	// URL, Headers and TimeoutMs are of the HTTP sink
+	URL       string            `yaml:"url,omitempty"`
+	Headers   map[string]string `yaml:"headers,omitempty"`
+	TimeoutMs int               `yaml:"timeout_ms,omitempty"`
+}
@@ -1,6 +1,7 @@
 package definitions
 
 import (
+	"context"
 	"github.com/benyaa/virtual-printer-process-engine/utils"
 	"github.com/mitchellh/mapstructure"
 	"io"
@@ -9,6 +10,20 @@ import (
 type EngineFlowObject struct {
 	Pages    int                    `json:"pages"`
 	Metadata map[string]interface{} `json:"metadata"`
+	// ctx is the context of the handler attempt, it isn't copied or written to the WAL
+	ctx context.Context
+}
+
+// Context returns the context of the handler attempt, which carries its trace span.
+func (e *EngineFlowObject) Context() context.Context {
+	if e.ctx == nil {
+		return context.Background()
+	}
+	return e.ctx
+}
+
+func (e *EngineFlowObject) SetContext(ctx context.Context) {
+	e.ctx = ctx
 }
 
 func (e *EngineFlowObject) EvaluateExpression(input string) (string, error) {
@@ -33,6 +48,18 @@ type Handler interface {
 	Handle(info *EngineFlowObject, fileHandler EngineFileHandler) (*EngineFlowObject, error)
 }
 
+// OutputDeclarer is implemented by handlers that declare the metadata keys they write.
+// The keys are relative to the handler's namespace, e.g. `OutputPath` for `WriteFile.OutputPath`.
+type OutputDeclarer interface {
+	Outputs() []string
+}
+
+// DestinationDeclarer is implemented by handlers that send the document out of the engine.
+// The keys are of the outputs that hold where it was sent, e.g. `OutputPath` for `WriteFile.OutputPath`.
+type DestinationDeclarer interface {
+	Destinations() []string
+}
+
 type EngineFileHandler interface {
 	Read() (io.Reader, error)
 	Write() (io.Writer, error)
@@ -1,6 +1,55 @@
 package definitions
 
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+const JobMetadataNamespace = "Job"
+
 type PrintInfo struct {
 	Filepath string
 	Pages    int
+	// Pipeline is the name of the pipeline to process the job with, the default pipeline if it's empty
+	Pipeline string
+	// SessionID is the engine session of the job, a new one is created if it's empty
+	SessionID uuid.UUID
+
+	// Job attributes, filled by the source where they are available
+	Source           string
+	Title            string
+	User             string
+	Host             string
+	Copies           int
+	SubmittedAt      time.Time
+	OriginalFilename string
+	// Attributes holds any other source specific job attributes
+	Attributes map[string]string
+}
+
+// JobMetadata returns the job attributes as the initial flow metadata, under the `Job.` namespace.
+func (p PrintInfo) JobMetadata() map[string]interface{} {
+	submittedAt := ""
+	if !p.SubmittedAt.IsZero() {
+		submittedAt = p.SubmittedAt.Format(time.RFC3339)
+	}
+	copies := p.Copies
+	if copies == 0 {
+		copies = 1
+	}
+
+	metadata := map[string]interface{}{}
+	for key, value := range p.Attributes {
+		metadata[JobMetadataNamespace+"."+key] = value
+	}
+	metadata[JobMetadataNamespace+".Source"] = p.Source
+	metadata[JobMetadataNamespace+".Title"] = p.Title
+	metadata[JobMetadataNamespace+".User"] = p.User
+	metadata[JobMetadataNamespace+".Host"] = p.Host
+	metadata[JobMetadataNamespace+".Copies"] = copies
+	metadata[JobMetadataNamespace+".SubmittedAt"] = submittedAt
+	metadata[JobMetadataNamespace+".OriginalFilename"] = p.OriginalFilename
+	metadata[JobMetadataNamespace+".Pages"] = p.Pages
+	metadata[JobMetadataNamespace+".Pipeline"] = p.Pipeline
+	return metadata
 }
@@ -0,0 +1,215 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/repo"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"os"
+)
+
+var (
+	ErrSessionNotFound  = errors.New("session not found")
+	ErrSessionActive    = errors.New("session is still active")
+	ErrSessionNotActive = errors.New("session is not active")
+	ErrCannotRetry      = errors.New("session can't be retried from the handler")
+	ErrInputUnavailable = errors.New("handler input is not available")
+)
+
+// PauseIntake stops taking new jobs from the sources, the jobs in progress keep running.
+func (e *Engine) PauseIntake() {
+	e.setIntakePaused(true)
+}
+
+func (e *Engine) ResumeIntake() {
+	e.setIntakePaused(false)
+}
+
+func (e *Engine) IsIntakePaused() bool {
+	return e.intakePaused.Load()
+}
+
+func (e *Engine) setIntakePaused(paused bool) {
+	if e.intakePaused.Swap(paused) == paused {
+		return
+	}
+	log.Infof("intake paused: %t", paused)
+	select {
+	case e.intakeChanged <- struct{}{}:
+	default:
+	}
+}
+
+// CancelSession stops a queued or processing session before its next handler.
+func (e *Engine) CancelSession(sessionID uuid.UUID) error {
+	job, ok := e.jobStore.Get(sessionID)
+	if !ok {
+		return ErrSessionNotFound
+	}
+	if job.IsDone() {
+		return ErrSessionNotActive
+	}
+	log.Infof("canceling session %s", sessionID)
+	e.canceledSessions.Store(sessionID, struct{}{})
+	return nil
+}
+
+func (e *Engine) isCanceled(sessionID uuid.UUID) bool {
+	_, canceled := e.canceledSessions.LoadAndDelete(sessionID)
+	return canceled
+}
+
+// RetrySession processes a finished session again, starting from the handler.
+// The session's failed handler is used if handlerID is empty, and `__init__` starts it over.
+func (e *Engine) RetrySession(sessionID uuid.UUID, handlerID string) error {
+	entries, err := e.writeAheadLogger.ReadEntries()
+	if err != nil {
+		return fmt.Errorf("failed to read WAL: %w", err)
+	}
+	entry, err := findSessionEntry(entries, sessionID, handlerID)
+	if errors.Is(err, ErrInputUnavailable) {
+		return fmt.Errorf("%w: %w", ErrCannotRetry, err)
+	}
+	if err != nil {
+		return err
+	}
+	pipeline := getPipeline(entry)
+	// the session is queued before its inputs are touched, so a concurrent retry or the recovery can't start it too
+	if !e.jobStore.TryQueue(sessionID, pipeline) {
+		return ErrSessionActive
+	}
+
+	fileHandler, flow, err := e.getProcessHandlerForSession(sessionID, entry, nil)
+	if err != nil {
+		err = fmt.Errorf("failed to restore session %s: %w", sessionID, err)
+		e.failJob(sessionID, err)
+		return err
+	}
+	fileHandler.previousInputs = getSessionInputs(entries, sessionID, fileHandler.input)
+
+	log.Infof("retrying session %s from handler %s", sessionID, entry.HandlerID)
+	e.workerPool.Submit(func() {
+		err := e.processHandlers(flow, fileHandler, pipeline, getStartHandlerID(entry), sessionID)
+		if err != nil {
+			log.WithError(err).Errorf("failed to retry session %s", sessionID)
+		}
+	})
+	return nil
+}
+
+// getSessionEntry returns the session's last WAL entry of the handler, or its last entry if handlerID is empty.
+// The handler's input must still be on disk.
+func (e *Engine) getSessionEntry(sessionID uuid.UUID, handlerID string) (repo.LogEntry, error) {
+	entries, err := e.writeAheadLogger.ReadEntries()
+	if err != nil {
+		return repo.LogEntry{}, fmt.Errorf("failed to read WAL: %w", err)
+	}
+	return findSessionEntry(entries, sessionID, handlerID)
+}
+
+func findSessionEntry(entries []repo.LogEntry, sessionID uuid.UUID, handlerID string) (repo.LogEntry, error) {
+	var entry *repo.LogEntry
+	found := false
+	for i := range entries {
+		if entries[i].SessionID != sessionID {
+			continue
+		}
+		found = true
+		if entries[i].HandlerName == "__end__" {
+			continue
+		}
+		if handlerID == "" || entries[i].HandlerID == handlerID {
+			entry = &entries[i]
+		}
+	}
+	if !found {
+		return repo.LogEntry{}, ErrSessionNotFound
+	}
+	if entry == nil {
+		return repo.LogEntry{}, fmt.Errorf("%w: %s didn't run in the session", ErrInputUnavailable, handlerID)
+	}
+	if entry.InMemory {
+		return repo.LogEntry{}, fmt.Errorf("%w: the input of %s was only kept in memory", ErrInputUnavailable, entry.HandlerID)
+	}
+	if _, err := os.Stat(entry.InputFile); err != nil {
+		return repo.LogEntry{}, fmt.Errorf("%w: the input of %s was removed", ErrInputUnavailable, entry.HandlerID)
+	}
+	return *entry, nil
+}
+
+// getSessionInputs returns the inputs of the session's handlers on disk other than input, which are removed
+// once the session ends.
+func getSessionInputs(entries []repo.LogEntry, sessionID uuid.UUID, input string) []string {
+	var inputs []string
+	seen := map[string]bool{input: true}
+	for _, entry := range entries {
+		if entry.SessionID != sessionID || entry.InMemory || entry.HandlerName == "__init__" || entry.HandlerName == "__end__" {
+			continue
+		}
+		if !seen[entry.InputFile] {
+			seen[entry.InputFile] = true
+			inputs = append(inputs, entry.InputFile)
+		}
+	}
+	return inputs
+}
+
+// getStartHandlerID returns the handler to resume the session from after the entry.
+func getStartHandlerID(entry repo.LogEntry) string {
+	if entry.HandlerID == "__init__" {
+		return ""
+	}
+	return entry.HandlerID
+}
+
+// PipelineHandler describes a handler of a pipeline.
+type PipelineHandler struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+	Checkpoint bool   `json:"checkpoint,omitempty"`
+	MaxRetries int    `json:"max_retries"`
+}
+
+// GetPipelines returns the handlers of each pipeline, in order.
+func (e *Engine) GetPipelines() map[string][]PipelineHandler {
+	pipelines := map[string][]PipelineHandler{}
+	for name, handlers := range e.Pipelines {
+		pipelines[name] = []PipelineHandler{}
+		for _, h := range handlers {
+			pipelines[name] = append(pipelines[name], PipelineHandler{
+				ID:         h.handler.GetID(),
+				Name:       h.handler.Name(),
+				Namespace:  h.namespace,
+				Checkpoint: h.checkpoint,
+				MaxRetries: h.retryMechanism.MaxRetries,
+			})
+		}
+	}
+	return pipelines
+}
+
+// QueueDepth returns the number of jobs that were taken by the engine and are waiting for a worker.
+func (e *Engine) QueueDepth() int {
+	return e.jobStore.Count(repo.JobQueued)
+}
+
+// BusyWorkers returns the number of workers that are running a job.
+func (e *Engine) BusyWorkers() int {
+	return e.workerPool.RunningWorkers() - e.workerPool.IdleWorkers()
+}
+
+func (e *Engine) MaxWorkers() int {
+	return e.workerPool.MaxWorkers()
+}
+
+// GetArtifact returns the path of the file the handler got in the session, which is the
+// input of the session's failed handler if handlerID is empty.
+func (e *Engine) GetArtifact(sessionID uuid.UUID, handlerID string) (string, error) {
+	entry, err := e.getSessionEntry(sessionID, handlerID)
+	if err != nil {
+		return "", err
+	}
+	return entry.InputFile, nil
+}
@@ -0,0 +1,273 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alitto/pond"
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/repo"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryWriteAheadLogger struct {
+	mutex   sync.Mutex
+	entries []repo.LogEntry
+}
+
+func (l *memoryWriteAheadLogger) WriteEntry(entry repo.LogEntry) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.entries = append(l.entries, entry)
+}
+
+func (l *memoryWriteAheadLogger) ReadEntries() ([]repo.LogEntry, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]repo.LogEntry(nil), l.entries...), nil
+}
+
+// copyHandler copies its input to its output, and fails while fail is set.
+type copyHandler struct {
+	definitions.BaseHandler
+	fail bool
+}
+
+func (h *copyHandler) Name() string {
+	return "Copy"
+}
+
+func (h *copyHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	if h.fail {
+		return nil, errors.New("copy failed")
+	}
+	reader, err := fileHandler.Read()
+	if err != nil {
+		return nil, err
+	}
+	writer, err := fileHandler.Write()
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(writer, reader)
+	return info, err
+}
+
+func newTestEngine(t *testing.T, handlers ...definitions.Handler) *Engine {
+	var handlerContexts []handlerContext
+	for _, h := range handlers {
+		handlerContexts = append(handlerContexts, handlerContext{handler: h, retryMechanism: config.HandlerRetryMechanism{MaxRetries: 1}})
+	}
+	workerPool := pond.New(1, 1)
+	t.Cleanup(workerPool.StopAndWait)
+	return &Engine{
+		Pipelines:        map[string][]handlerContext{config.DefaultPipeline: handlerContexts},
+		contentsDir:      t.TempDir(),
+		writeAheadLogger: &memoryWriteAheadLogger{},
+		jobStore:         repo.NewMemoryJobStore(0),
+		workerPool:       workerPool,
+		intakeChanged:    make(chan struct{}, 1),
+	}
+}
+
+func newTestPrintInfo(t *testing.T) definitions.PrintInfo {
+	path := filepath.Join(t.TempDir(), "job.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("hello"), 0644))
+	return definitions.PrintInfo{Filepath: path, SessionID: uuid.New(), Pipeline: config.DefaultPipeline}
+}
+
+func TestRetrySession(t *testing.T) {
+	first := &copyHandler{BaseHandler: definitions.BaseHandler{ID: "Copy_0"}}
+	second := &copyHandler{BaseHandler: definitions.BaseHandler{ID: "Copy_1"}, fail: true}
+	e := newTestEngine(t, first, second)
+	printInfo := newTestPrintInfo(t)
+
+	e.handleFile(printInfo)
+	job, _ := e.jobStore.Get(printInfo.SessionID)
+	assert.Equal(t, repo.JobFailed, job.Status)
+	assert.Equal(t, "Copy_1", job.HandlerID)
+	assert.Len(t, job.Handlers, 2)
+	assert.Equal(t, "copy failed", job.Handlers[1].Error)
+
+	artifact, err := e.GetArtifact(printInfo.SessionID, "")
+	assert.NoError(t, err)
+	contents, _ := os.ReadFile(artifact)
+	assert.Equal(t, "hello", string(contents))
+	assert.ErrorIs(t, e.RetrySession(uuid.New(), ""), ErrSessionNotFound)
+
+	second.fail = false
+	assert.NoError(t, e.RetrySession(printInfo.SessionID, ""))
+	assert.Eventually(t, func() bool {
+		job, _ := e.jobStore.Get(printInfo.SessionID)
+		return job.Status == repo.JobCompleted
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// starting over runs every handler again
+	assert.NoError(t, e.RetrySession(printInfo.SessionID, "__init__"))
+	assert.Eventually(t, func() bool {
+		job, _ := e.jobStore.Get(printInfo.SessionID)
+		return job.Status == repo.JobCompleted && len(job.Handlers) == 5
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRetrySession_FromEarlierHandler(t *testing.T) {
+	first := &copyHandler{BaseHandler: definitions.BaseHandler{ID: "Copy_0"}}
+	second := &copyHandler{BaseHandler: definitions.BaseHandler{ID: "Copy_1"}}
+	third := &copyHandler{BaseHandler: definitions.BaseHandler{ID: "Copy_2"}, fail: true}
+	e := newTestEngine(t, first, second, third)
+	printInfo := newTestPrintInfo(t)
+
+	e.handleFile(printInfo)
+	job, _ := e.jobStore.Get(printInfo.SessionID)
+	assert.Equal(t, repo.JobFailed, job.Status)
+	artifact, err := e.GetArtifact(printInfo.SessionID, "Copy_0")
+	assert.NoError(t, err)
+	contents, _ := os.ReadFile(artifact)
+	assert.Equal(t, "hello", string(contents))
+
+	third.fail = false
+	assert.NoError(t, e.RetrySession(printInfo.SessionID, "Copy_0"))
+	assert.Eventually(t, func() bool {
+		job, _ := e.jobStore.Get(printInfo.SessionID)
+		return job.Status == repo.JobCompleted && len(job.Handlers) == 6
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the inputs of both runs are removed once the session ends
+	files, err := os.ReadDir(e.contentsDir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestRetrySession_Concurrently(t *testing.T) {
+	h := &copyHandler{BaseHandler: definitions.BaseHandler{ID: "Copy_0"}, fail: true}
+	e := newTestEngine(t, h)
+	printInfo := newTestPrintInfo(t)
+	e.handleFile(printInfo)
+	h.fail = false
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- e.RetrySession(printInfo.SessionID, "")
+		}()
+	}
+	first, second := <-errs, <-errs
+	if first != nil {
+		first, second = second, first
+	}
+	assert.NoError(t, first)
+	assert.ErrorIs(t, second, ErrSessionActive)
+	assert.Eventually(t, func() bool {
+		job, _ := e.jobStore.Get(printInfo.SessionID)
+		return job.Status == repo.JobCompleted && len(job.Handlers) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRetrySession_DuringRecovery(t *testing.T) {
+	h := &blockingHandler{BaseHandler: definitions.BaseHandler{ID: "Blocking_0"}, started: make(chan struct{}, 2), release: make(chan struct{})}
+	e := newTestEngine(t, h)
+	var sessionIDs []uuid.UUID
+	for i := 0; i < 2; i++ {
+		printInfo := newTestPrintInfo(t)
+		sessionIDs = append(sessionIDs, printInfo.SessionID)
+		e.writeAheadLogger.WriteEntry(repo.LogEntry{
+			SessionID:   printInfo.SessionID,
+			HandlerName: "__init__",
+			HandlerID:   "__init__",
+			InputFile:   printInfo.Filepath,
+			OutputFile:  filepath.Join(e.contentsDir, uuid.NewString()),
+			FlowObject:  definitions.EngineFlowObject{Metadata: map[string]interface{}{}},
+		})
+	}
+	recovered := make(chan error)
+	go func() {
+		recovered <- e.Recover()
+	}()
+
+	// both sessions are queued before the first one is recovered, so neither can be retried
+	<-h.started
+	for _, sessionID := range sessionIDs {
+		assert.ErrorIs(t, e.RetrySession(sessionID, "__init__"), ErrSessionActive)
+	}
+	close(h.release)
+	assert.NoError(t, <-recovered)
+	for _, sessionID := range sessionIDs {
+		job, _ := e.jobStore.Get(sessionID)
+		assert.Equal(t, repo.JobCompleted, job.Status)
+		assert.Len(t, job.Handlers, 1)
+	}
+}
+
+// blockingHandler waits for release before it handles a session.
+type blockingHandler struct {
+	definitions.BaseHandler
+	started chan struct{}
+	release chan struct{}
+}
+
+func (h *blockingHandler) Name() string {
+	return "Blocking"
+}
+
+func (h *blockingHandler) Handle(info *definitions.EngineFlowObject, _ definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	h.started <- struct{}{}
+	<-h.release
+	return info, nil
+}
+
+func TestQueueDepth(t *testing.T) {
+	h := &blockingHandler{BaseHandler: definitions.BaseHandler{ID: "Blocking_0"}, started: make(chan struct{}, 2), release: make(chan struct{})}
+	e := newTestEngine(t, h)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e.ctx = ctx
+	e.filesChannel = make(chan definitions.PrintInfo)
+	go e.Run()
+
+	e.filesChannel <- newTestPrintInfo(t)
+	<-h.started
+	e.filesChannel <- newTestPrintInfo(t)
+	assert.Eventually(t, func() bool {
+		return e.QueueDepth() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	close(h.release)
+	assert.Eventually(t, func() bool {
+		return e.QueueDepth() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestCancelSession(t *testing.T) {
+	e := newTestEngine(t, &copyHandler{BaseHandler: definitions.BaseHandler{ID: "Copy_0"}})
+	printInfo := newTestPrintInfo(t)
+
+	assert.ErrorIs(t, e.CancelSession(printInfo.SessionID), ErrSessionNotFound)
+	e.jobStore.Update(printInfo.SessionID, func(job *repo.Job) {})
+	assert.NoError(t, e.CancelSession(printInfo.SessionID))
+
+	e.handleFile(printInfo)
+	job, _ := e.jobStore.Get(printInfo.SessionID)
+	assert.Equal(t, repo.JobCanceled, job.Status)
+	assert.Empty(t, job.Handlers)
+	assert.ErrorIs(t, e.CancelSession(printInfo.SessionID), ErrSessionNotActive)
+
+	entries, _ := e.writeAheadLogger.ReadEntries()
+	assert.Equal(t, "__end__", entries[len(entries)-1].HandlerName)
+}
+
+func TestPauseIntake(t *testing.T) {
+	e := newTestEngine(t)
+	assert.False(t, e.IsIntakePaused())
+	e.PauseIntake()
+	assert.True(t, e.IsIntakePaused())
+	e.ResumeIntake()
+	assert.False(t, e.IsIntakePaused())
+}
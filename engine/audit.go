@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/audit"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/google/uuid"
+	"time"
+)
+
+// auditSession writes the audit record of the finished session, from its job and its job metadata.
+func (e *Engine) auditSession(sessionID uuid.UUID, metadata map[string]interface{}) {
+	job, ok := e.jobStore.Get(sessionID)
+	if !ok {
+		return
+	}
+
+	record := audit.Record{
+		Time:         time.Now(),
+		SessionID:    sessionID,
+		Source:       getJobString(metadata, "Source"),
+		User:         getJobString(metadata, "User"),
+		Host:         getJobString(metadata, "Host"),
+		Title:        getJobString(metadata, "Title"),
+		Pages:        getJobInt(metadata, "Pages"),
+		Pipeline:     job.Pipeline,
+		ContentHash:  getJobString(metadata, "ContentHash"),
+		Status:       string(job.Status),
+		Error:        job.Error,
+		Handlers:     []audit.HandlerResult{},
+		Destinations: []string{},
+	}
+	for _, run := range job.Handlers {
+		result := audit.HandlerResult{
+			HandlerID:   run.HandlerID,
+			HandlerName: run.HandlerName,
+			Result:      audit.HandlerSucceeded,
+			Error:       run.Error,
+		}
+		if !run.FinishedAt.IsZero() {
+			result.DurationMs = run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+		}
+		if run.Error != "" {
+			result.Result = audit.HandlerFailed
+		}
+		record.Handlers = append(record.Handlers, result)
+		record.Destinations = append(record.Destinations, run.Destinations...)
+	}
+	e.auditLogger.Log(record)
+}
+
+func getJobString(metadata map[string]interface{}, key string) string {
+	value, ok := metadata[definitions.JobMetadataNamespace+"."+key]
+	if !ok || value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// getJobInt returns the number, which is a float64 if the metadata was read from the WAL.
+func getJobInt(metadata map[string]interface{}, key string) int {
+	switch value := metadata[definitions.JobMetadataNamespace+"."+key].(type) {
+	case int:
+		return value
+	case float64:
+		return int(value)
+	default:
+		return 0
+	}
+}
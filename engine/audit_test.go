@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/benyaa/virtual-printer-process-engine/audit"
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/handler"
+	"github.com/benyaa/virtual-printer-process-engine/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditSession(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLogger, err := audit.New(config.AuditConfig{Sinks: []config.AuditSinkConfig{{Type: config.AuditSinkFile, Path: auditPath}}})
+	assert.NoError(t, err)
+
+	outputPath := filepath.Join(t.TempDir(), "out.txt")
+	writeFile, err := handler.GetHandler(config.HandlerConfig{Name: "WriteFile", Config: map[string]interface{}{"output": outputPath}}, "")
+	assert.NoError(t, err)
+	e := newTestEngine(t, writeFile)
+	e.auditLogger = auditLogger
+	printInfo := newTestPrintInfo(t)
+	printInfo.Source = "api"
+	printInfo.User = "alice"
+	printInfo.Title = "report"
+	printInfo.Pages = 2
+
+	e.handleFile(printInfo)
+	assert.NoError(t, auditLogger.Close())
+
+	contents, err := os.ReadFile(auditPath)
+	assert.NoError(t, err)
+	var record audit.Record
+	assert.NoError(t, json.Unmarshal(contents, &record))
+	hash, _ := utils.HashFile(printInfo.Filepath)
+	assert.Equal(t, printInfo.SessionID, record.SessionID)
+	assert.Equal(t, "api", record.Source)
+	assert.Equal(t, "alice", record.User)
+	assert.Equal(t, "report", record.Title)
+	assert.Equal(t, 2, record.Pages)
+	assert.Equal(t, config.DefaultPipeline, record.Pipeline)
+	assert.Equal(t, hash, record.ContentHash)
+	assert.Equal(t, "completed", record.Status)
+	assert.Equal(t, []string{outputPath}, record.Destinations)
+	assert.Len(t, record.Handlers, 1)
+	assert.Equal(t, "WriteFile", record.Handlers[0].HandlerName)
+	assert.Equal(t, audit.HandlerSucceeded, record.Handlers[0].Result)
+}
+
+func TestAuditSession_Failed(t *testing.T) {
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLogger, err := audit.New(config.AuditConfig{Sinks: []config.AuditSinkConfig{{Type: config.AuditSinkFile, Path: auditPath}}})
+	assert.NoError(t, err)
+	e := newTestEngine(t, &copyHandler{BaseHandler: definitions.BaseHandler{ID: "Copy_0"}, fail: true})
+	e.auditLogger = auditLogger
+
+	e.handleFile(newTestPrintInfo(t))
+	assert.NoError(t, auditLogger.Close())
+
+	contents, err := os.ReadFile(auditPath)
+	assert.NoError(t, err)
+	var record audit.Record
+	assert.NoError(t, json.Unmarshal(contents, &record))
+	assert.Equal(t, "failed", record.Status)
+	assert.Equal(t, "copy failed", record.Error)
+	assert.Equal(t, audit.HandlerFailed, record.Handlers[0].Result)
+	assert.Empty(t, record.Destinations)
+}
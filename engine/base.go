@@ -2,42 +2,70 @@ package engine
 
 import (
 	"context"
+	"fmt"
 	"github.com/alitto/pond"
+	"github.com/benyaa/virtual-printer-process-engine/audit"
 	"github.com/benyaa/virtual-printer-process-engine/config"
 	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/metrics"
 	"github.com/benyaa/virtual-printer-process-engine/repo"
 	"github.com/benyaa/virtual-printer-process-engine/utils"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
+	"os"
 	"path"
+	"sync"
+	"sync/atomic"
 )
 
 type Engine struct {
-	Handlers             []handlerContext
+	Pipelines            map[string][]handlerContext
 	ctx                  context.Context
 	filesChannel         chan definitions.PrintInfo
 	contentsDir          string
 	writeAheadLogger     repo.WriteAheadLogger
+	jobStore             repo.JobStore
 	IgnoreRecoveryErrors bool
 	workerPool           *pond.WorkerPool
+	memoryFastPath       config.MemoryFastPath
+	intakePaused         atomic.Bool
+	intakeChanged        chan struct{}
+	canceledSessions     sync.Map
+	auditLogger          *audit.Logger
 }
 
 type handlerContext struct {
-	handler        definitions.Handler
-	retryMechanism config.HandlerRetryMechanism
+	handler         definitions.Handler
+	retryMechanism  config.HandlerRetryMechanism
+	checkpoint      bool
+	namespace       string
+	outputs         []string
+	declaresOutputs bool
 }
 
-func New(ctx context.Context, config config.Config, files chan definitions.PrintInfo, writeAheadLogger repo.WriteAheadLogger) *Engine {
-	handlers := getHandlers(config)
+func New(ctx context.Context, config config.Config, files chan definitions.PrintInfo, writeAheadLogger repo.WriteAheadLogger, jobStore repo.JobStore, auditLogger *audit.Logger) *Engine {
+	pipelines := getPipelines(config)
+	memoryFastPath := config.Engine.MemoryFastPath
+	initMemoryFastPathDefaults(&memoryFastPath)
 
 	return &Engine{
-		Handlers:             handlers,
+		Pipelines:            pipelines,
 		ctx:                  ctx,
 		filesChannel:         files,
 		contentsDir:          path.Join(config.Workdir, "contents"),
 		writeAheadLogger:     writeAheadLogger,
+		jobStore:             jobStore,
 		IgnoreRecoveryErrors: config.Engine.IgnoreRecoveryErrors,
 		workerPool:           pond.New(config.Engine.MaxWorkers, config.Engine.MaxWorkers),
+		memoryFastPath:       memoryFastPath,
+		intakeChanged:        make(chan struct{}, 1),
+		auditLogger:          auditLogger,
+	}
+}
+
+func initMemoryFastPathDefaults(memoryFastPath *config.MemoryFastPath) {
+	if memoryFastPath.MaxSizeKB == 0 {
+		memoryFastPath.MaxSizeKB = 1024
 	}
 }
 
@@ -48,13 +76,31 @@ func (e *Engine) Run() {
 		panic(err)
 	}
 	for {
+		files := e.filesChannel
+		if e.IsIntakePaused() {
+			// a nil channel blocks, so no jobs are taken until the intake is resumed
+			files = nil
+		}
 		select {
 		case <-e.ctx.Done():
 			log.Infof("stopping engine")
 			e.workerPool.Stop()
 			return
-		case i := <-e.filesChannel:
+		case <-e.intakeChanged:
+			continue
+		case i := <-files:
 			log.Debugf("received file %s", i.Filepath)
+			if i.SessionID == uuid.Nil {
+				i.SessionID = uuid.New()
+			}
+			if i.Pipeline == "" {
+				i.Pipeline = config.DefaultPipeline
+			}
+			e.jobStore.Update(i.SessionID, func(job *repo.Job) {
+				job.Pipeline = i.Pipeline
+				job.Status = repo.JobQueued
+			})
+			metrics.JobsReceived.WithLabelValues(i.Pipeline).Inc()
 			e.workerPool.Submit(func() {
 				e.handleFile(i)
 			})
@@ -63,39 +109,91 @@ func (e *Engine) Run() {
 }
 
 func (e *Engine) handleFile(i definitions.PrintInfo) {
-	var err error
-	sessionID := uuid.New()
-	log.Debugf("handling file %s with sessionID %s", i.Filepath, sessionID)
+	sessionID := i.SessionID
+	pipeline := i.Pipeline
 	flow := &definitions.EngineFlowObject{
 		Pages:    i.Pages,
-		Metadata: map[string]interface{}{},
+		Metadata: i.JobMetadata(),
+	}
+	if _, ok := e.Pipelines[pipeline]; !ok {
+		log.Errorf("unknown pipeline %s for file %s, skipping it", pipeline, i.Filepath)
+		e.failJob(sessionID, fmt.Errorf("unknown pipeline %s", pipeline))
+		e.auditSession(sessionID, flow.Metadata)
+		return
+	}
+	log.Debugf("handling file %s with sessionID %s in pipeline %s", i.Filepath, sessionID, pipeline)
+	contentHash, err := utils.HashFile(i.Filepath)
+	if err != nil {
+		log.WithError(err).Errorf("failed to hash file %s", i.Filepath)
+		e.failJob(sessionID, err)
+		e.auditSession(sessionID, flow.Metadata)
+		return
 	}
+	flow.Metadata[definitions.JobMetadataNamespace+".ContentHash"] = contentHash
 	input := path.Join(e.contentsDir, uuid.NewString())
 
 	walEntry := repo.LogEntry{
 		SessionID:   sessionID,
 		HandlerName: "__init__",
 		HandlerID:   "__init__",
+		Pipeline:    pipeline,
 		InputFile:   i.Filepath,
 		OutputFile:  input,
 		FlowObject:  *flow,
 	}
 	log.Debugf("writing WAL entry for handler __init__")
 	e.writeAheadLogger.WriteEntry(walEntry)
-	log.Debugf("copying file %s to contents folder", i.Filepath)
-	err = utils.CopyFile(i.Filepath, input)
+
+	fileHandler, err := e.getInitialFileHandler(i.Filepath, input)
 	if err != nil {
-		log.WithError(err).Errorf("failed to copy file %s to contents folder", i.Filepath)
+		log.WithError(err).Errorf("failed to load file %s", i.Filepath)
+		e.failJob(sessionID, err)
+		e.auditSession(sessionID, flow.Metadata)
 		return
 	}
-	log.Debugf("copied file %s to contents folder", i.Filepath)
-
-	fileHandler := NewDefaultEngineFileHandler(input)
 
 	log.Debugf("processing handlers")
-	err = e.processHandlers(flow, fileHandler, "", sessionID)
+	err = e.processHandlers(flow, fileHandler, pipeline, "", sessionID)
 	if err != nil {
 		log.WithError(err).Error("failed to process handlers")
 		return
 	}
 }
+
+func (e *Engine) failJob(sessionID uuid.UUID, err error) {
+	pipeline := ""
+	e.jobStore.Update(sessionID, func(job *repo.Job) {
+		job.Status = repo.JobFailed
+		job.Error = err.Error()
+		pipeline = job.Pipeline
+	})
+	metrics.JobsFailed.WithLabelValues(pipeline).Inc()
+}
+
+func (e *Engine) getInitialFileHandler(source string, input string) (sessionFileHandler, error) {
+	maxSize := e.memoryFastPath.MaxSizeKB * 1024
+	if e.memoryFastPath.Enabled {
+		stat, err := os.Stat(source)
+		if err != nil {
+			return nil, err
+		}
+		if stat.Size() <= int64(maxSize) {
+			log.Debugf("loading file %s to memory", source)
+			contents, err := os.ReadFile(source)
+			if err != nil {
+				return nil, err
+			}
+			return NewMemoryEngineFileHandler(contents, e.contentsDir, maxSize), nil
+		}
+		log.Debugf("file %s is larger than %d bytes, not loading it to memory", source, maxSize)
+	}
+
+	log.Debugf("copying file %s to contents folder", source)
+	err := utils.CopyFile(source, input)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("copied file %s to contents folder", source)
+
+	return NewDefaultEngineFileHandler(input), nil
+}
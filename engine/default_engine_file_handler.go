@@ -1,17 +1,36 @@
 package engine
 
 import (
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
 	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
 	"io"
 	"os"
 	"path"
 )
 
+// sessionFileHandler is what the engine needs from a session's file handler on top of what the handlers get.
+type sessionFileHandler interface {
+	definitions.EngineFileHandler
+	getInput() string
+	getOutput() string
+	isPersisted() bool
+	checkpoint() error
+	remove() error
+	// release removes the files that only the previous handler's WAL entry refers to, once the next entry is written
+	release()
+	getNewFileHandler() sessionFileHandler
+}
+
 type DefaultEngineFileHandler struct {
 	input  string
 	output string
-	reader *os.File
-	writer *os.File
+	// stale is a checkpoint of the in-memory contents that this file replaced
+	stale string
+	// previousInputs are the inputs of the session's earlier handlers, kept until the session ends to retry from them
+	previousInputs []string
+	reader         *os.File
+	writer         *os.File
 }
 
 func (d *DefaultEngineFileHandler) Read() (io.Reader, error) {
@@ -49,18 +68,58 @@ func (d *DefaultEngineFileHandler) Close() {
 	}
 }
 
-func (d *DefaultEngineFileHandler) getNewFileHandler() *DefaultEngineFileHandler {
+func (d *DefaultEngineFileHandler) getInput() string {
+	return d.input
+}
+
+func (d *DefaultEngineFileHandler) getOutput() string {
+	return d.output
+}
+
+func (d *DefaultEngineFileHandler) isPersisted() bool {
+	return true
+}
+
+func (d *DefaultEngineFileHandler) checkpoint() error {
+	return nil
+}
+
+// remove removes the input, along with the inputs of the session's earlier handlers.
+func (d *DefaultEngineFileHandler) remove() error {
+	for _, previousInput := range d.previousInputs {
+		err := os.Remove(previousInput)
+		if err != nil && !os.IsNotExist(err) {
+			log.WithError(err).Warnf("failed to remove input file %s", previousInput)
+		}
+	}
+	return os.Remove(d.input)
+}
+
+func (d *DefaultEngineFileHandler) release() {
+	if d.stale == "" {
+		return
+	}
+	err := os.Remove(d.stale)
+	if err != nil {
+		log.WithError(err).Warnf("failed to remove checkpoint %s", d.stale)
+	}
+	d.stale = ""
+}
+
+func (d *DefaultEngineFileHandler) getNewFileHandler() sessionFileHandler {
 	input := d.input
+	previousInputs := d.previousInputs
 	if d.writer != nil {
 		input = d.output
-		defer os.Remove(d.input)
+		previousInputs = append(previousInputs, d.input)
 	}
 
 	d.Close()
 
 	return &DefaultEngineFileHandler{
-		input:  input,
-		output: generateNewOutputFilePath(input),
+		input:          input,
+		output:         generateNewOutputFilePath(input),
+		previousInputs: previousInputs,
 	}
 }
 
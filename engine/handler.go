@@ -1,22 +1,39 @@
 package engine
 
 import (
+	"context"
+	"fmt"
 	"github.com/benyaa/virtual-printer-process-engine/config"
 	"github.com/benyaa/virtual-printer-process-engine/definitions"
 	"github.com/benyaa/virtual-printer-process-engine/handler"
+	"github.com/benyaa/virtual-printer-process-engine/metrics"
 	"github.com/benyaa/virtual-printer-process-engine/repo"
 	"github.com/benyaa/virtual-printer-process-engine/utils"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
-	"os"
 	"time"
 )
 
-func getHandlers(config config.Config) []handlerContext {
+func getPipelines(conf config.Config) map[string][]handlerContext {
+	if _, ok := conf.Engine.Pipelines[config.DefaultPipeline]; ok && len(conf.Engine.Handlers) > 0 {
+		err := fmt.Errorf("pipeline %s is configured both in engine.handlers and in engine.pipelines", config.DefaultPipeline)
+		log.WithError(err).Errorf("invalid pipelines")
+		panic(err)
+	}
+
+	pipelines := map[string][]handlerContext{}
+	for name, handlerConfigs := range conf.GetPipelines() {
+		log.Debugf("getting handlers for pipeline %s", name)
+		pipelines[name] = getHandlers(handlerConfigs)
+	}
+	return pipelines
+}
+
+func getHandlers(handlerConfigs []config.HandlerConfig) []handlerContext {
 	var handlers []handlerContext
 	previousID := ""
 	log.Debugf("getting handlers")
-	for _, currentHandler := range config.Engine.Handlers {
+	for _, currentHandler := range handlerConfigs {
 		log.Debugf("getting handler %s", currentHandler.Name)
 		h, err := handler.GetHandler(currentHandler, previousID)
 		if err != nil {
@@ -27,12 +44,29 @@ func getHandlers(config config.Config) []handlerContext {
 		retry := currentHandler.Retry
 		log.Debugf("initializing retry defaults for handler %s", h.Name())
 		initRetryDefaults(&retry)
+		outputs, declaresOutputs := getOutputs(h)
 		log.Debugf("adding handler %s to engine", h.Name())
 		handlers = append(handlers, handlerContext{
-			handler:        h,
-			retryMechanism: retry,
+			handler:         h,
+			retryMechanism:  retry,
+			checkpoint:      currentHandler.Checkpoint,
+			namespace:       getNamespace(currentHandler, h),
+			outputs:         outputs,
+			declaresOutputs: declaresOutputs,
 		})
 	}
+
+	log.Debugf("validating handlers metadata")
+	err := validateAliases(handlers)
+	if err != nil {
+		log.WithError(err).Errorf("invalid handler aliases")
+		panic(err)
+	}
+	err = validateMetadataReferences(handlers, handlerConfigs)
+	if err != nil {
+		log.WithError(err).Errorf("invalid handler metadata references")
+		panic(err)
+	}
 	return handlers
 }
 
@@ -42,29 +76,69 @@ func initRetryDefaults(retry *config.HandlerRetryMechanism) {
 	}
 }
 
-func (e *Engine) processHandlers(flow *definitions.EngineFlowObject, fileHandler *DefaultEngineFileHandler, startHandlerID string, sessionID uuid.UUID) error {
+func (e *Engine) processHandlers(flow *definitions.EngineFlowObject, fileHandler sessionFileHandler, pipeline string, startHandlerID string, sessionID uuid.UUID) error {
+	ctx, span := startSessionSpan(sessionID, pipeline, startHandlerID, flow.Pages)
+	err := e.runHandlers(ctx, flow, fileHandler, pipeline, startHandlerID, sessionID)
+	endSpan(span, err)
+	if err != nil {
+		e.failJob(sessionID, err)
+	}
+	e.auditSession(sessionID, flow.Metadata)
+	return err
+}
+
+func (e *Engine) runHandlers(ctx context.Context, flow *definitions.EngineFlowObject, fileHandler sessionFileHandler, pipeline string, startHandlerID string, sessionID uuid.UUID) error {
 	log.Tracef("processing handlers")
 	resume := startHandlerID == ""
 	log.Debugf("resuming from handler %s", startHandlerID)
 
-	for _, hCtx := range e.Handlers {
+	handlers, ok := e.Pipelines[pipeline]
+	if !ok {
+		return fmt.Errorf("unknown pipeline %s", pipeline)
+	}
+
+	canceled := false
+	for _, hCtx := range handlers {
 		h := hCtx.handler
 		handlerID := h.GetID()
 		if handlerID == startHandlerID && !resume {
 			resume = true
 		}
 		if resume {
-			log.Debugf("handling %s with handler %s", fileHandler.input, h.Name())
+			if e.isCanceled(sessionID) {
+				log.Infof("session %s was canceled before handler %s", sessionID, h.Name())
+				canceled = true
+				break
+			}
+			if hCtx.checkpoint {
+				log.Debugf("checkpointing session %s before handler %s", sessionID, h.Name())
+				err := fileHandler.checkpoint()
+				if err != nil {
+					log.WithError(err).Errorf("failed to checkpoint session %s", sessionID)
+					return err
+				}
+			}
+			log.Debugf("handling session %s with handler %s", sessionID, h.Name())
 			logEntry := repo.LogEntry{
 				SessionID:   sessionID,
 				HandlerName: h.Name(),
 				HandlerID:   handlerID,
-				InputFile:   fileHandler.input,
-				OutputFile:  fileHandler.output,
+				Pipeline:    pipeline,
+				InputFile:   fileHandler.getInput(),
+				OutputFile:  fileHandler.getOutput(),
+				InMemory:    !fileHandler.isPersisted(),
 				FlowObject:  *flow,
 			}
 			log.Debugf("writing WAL entry for handler %s (%s)", h.Name(), handlerID)
 			e.writeAheadLogger.WriteEntry(logEntry)
+			fileHandler.release()
+			e.jobStore.Update(sessionID, func(job *repo.Job) {
+				job.Pipeline = pipeline
+				job.Status = repo.JobProcessing
+				job.HandlerName = h.Name()
+				job.HandlerID = handlerID
+				job.Handlers = append(job.Handlers, repo.HandlerRun{HandlerName: h.Name(), HandlerID: handlerID, StartedAt: time.Now()})
+			})
 			log.Debugf("deep copying flow object for handler %s (%s)", h.Name(), handlerID)
 
 			copiedFlow, err := utils.DeepCopy(flow)
@@ -72,27 +146,38 @@ func (e *Engine) processHandlers(flow *definitions.EngineFlowObject, fileHandler
 				log.WithError(err).Error("failed to copy flow object")
 				return err
 			}
+			previousOutputs := clearOutputs(hCtx, copiedFlow)
 
-			log.Debugf("handling %s with handler %s", fileHandler.input, h.Name())
+			log.Debugf("handling session %s with handler %s", sessionID, h.Name())
 
 			retryMechanism := hCtx.retryMechanism
 			for attempts := 1; attempts <= retryMechanism.MaxRetries; attempts++ {
 				log.Debugf("attempt %d/%d", attempts, retryMechanism.MaxRetries)
+				start := time.Now()
+				attemptCtx, attemptSpan := startHandlerSpan(ctx, sessionID, h, flow.Pages, attempts)
+				copiedFlow.SetContext(attemptCtx)
 				newFlow, err := h.Handle(copiedFlow, fileHandler)
+				endSpan(attemptSpan, err)
+				observeHandlerDuration(pipeline, h, start, err)
 				if err != nil {
 					if attempts < retryMechanism.MaxRetries {
 						log.WithError(err).Warnf("retrying handler %s (%d/%d)", h.Name(), attempts+1, retryMechanism.MaxRetries)
+						metrics.HandlerRetries.WithLabelValues(pipeline, handlerID, h.Name()).Inc()
 						time.Sleep(time.Duration(retryMechanism.BackOffInterval) * time.Second)
 					} else {
-						log.WithError(err).Errorf("failed to handle %s with handler %s after %d attempts", fileHandler.input, h.Name(), retryMechanism.MaxRetries)
+						log.WithError(err).Errorf("failed to handle session %s with handler %s after %d attempts", sessionID, h.Name(), retryMechanism.MaxRetries)
+						e.finishHandlerRun(sessionID, err, nil)
 						return err
 					}
 				} else {
 					flow = newFlow
+					destinations := getDestinations(h, flow)
+					namespaceOutputs(hCtx, flow, previousOutputs)
+					e.finishHandlerRun(sessionID, nil, destinations)
 					break
 				}
 			}
-			log.Debugf("handled %s with handler %s", fileHandler.input, h.Name())
+			log.Debugf("handled session %s with handler %s", sessionID, h.Name())
 
 			fileHandler = fileHandler.getNewFileHandler()
 		}
@@ -106,17 +191,55 @@ func (e *Engine) processHandlers(flow *definitions.EngineFlowObject, fileHandler
 		SessionID:   sessionID,
 		HandlerName: "__end__",
 		HandlerID:   "__end__",
-		InputFile:   fileHandler.input,
-		OutputFile:  fileHandler.output,
+		Pipeline:    pipeline,
+		InputFile:   fileHandler.getInput(),
+		OutputFile:  fileHandler.getOutput(),
 		FlowObject:  *flow,
 	}
 	e.writeAheadLogger.WriteEntry(logEntry)
-	err := os.Remove(fileHandler.input)
+	fileHandler.release()
+	// the session could have been canceled while its last handler ran
+	e.canceledSessions.Delete(sessionID)
+	status := repo.JobCompleted
+	if canceled {
+		status = repo.JobCanceled
+		metrics.JobsCanceled.WithLabelValues(pipeline).Inc()
+	} else {
+		metrics.JobsCompleted.WithLabelValues(pipeline).Inc()
+	}
+	e.jobStore.Update(sessionID, func(job *repo.Job) {
+		job.Status = status
+		job.Metadata = flow.Metadata
+	})
+	err := fileHandler.remove()
 	if err != nil {
-		log.WithError(err).Warnf("failed to remove final input file %s", fileHandler.input)
+		log.WithError(err).Warnf("failed to remove final input file %s", fileHandler.getInput())
 	}
 
-	log.Info("finished processing handlers for file %s", fileHandler.input)
+	log.Infof("finished processing handlers for session %s", sessionID)
 
 	return nil
 }
+
+func observeHandlerDuration(pipeline string, h definitions.Handler, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	metrics.HandlerDuration.WithLabelValues(pipeline, h.GetID(), h.Name(), result).Observe(time.Since(start).Seconds())
+}
+
+// finishHandlerRun records the end of the session's running handler.
+func (e *Engine) finishHandlerRun(sessionID uuid.UUID, err error, destinations []string) {
+	e.jobStore.Update(sessionID, func(job *repo.Job) {
+		if len(job.Handlers) == 0 {
+			return
+		}
+		run := &job.Handlers[len(job.Handlers)-1]
+		run.FinishedAt = time.Now()
+		run.Destinations = destinations
+		if err != nil {
+			run.Error = err.Error()
+		}
+	})
+}
@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"bytes"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path"
+)
+
+// MemoryEngineFileHandler keeps the session's contents in memory instead of creating a file per handler.
+// Once the written contents grow beyond maxSize, they are spilled to the output file and the session
+// continues on disk. The contents are only persisted for the WAL when checkpoint is called.
+type MemoryEngineFileHandler struct {
+	input          []byte
+	dir            string
+	output         string
+	maxSize        int
+	checkpointPath string
+	persisted      bool
+	// stale is the previous checkpoint, which is removed once the WAL no longer refers to it
+	stale  string
+	reader *bytes.Reader
+	writer *spillingWriter
+}
+
+func NewMemoryEngineFileHandler(input []byte, dir string, maxSize int) *MemoryEngineFileHandler {
+	return &MemoryEngineFileHandler{
+		input:   input,
+		dir:     dir,
+		output:  path.Join(dir, uuid.NewString()),
+		maxSize: maxSize,
+	}
+}
+
+func (m *MemoryEngineFileHandler) Read() (io.Reader, error) {
+	if m.reader == nil {
+		m.reader = bytes.NewReader(m.input)
+	}
+	return m.reader, nil
+}
+
+func (m *MemoryEngineFileHandler) Write() (io.Writer, error) {
+	if m.writer == nil {
+		m.writer = &spillingWriter{
+			path:    m.output,
+			maxSize: m.maxSize,
+		}
+	}
+	return m.writer, nil
+}
+
+func (m *MemoryEngineFileHandler) Close() {
+	m.reader = nil
+	if m.writer != nil {
+		m.writer.close()
+	}
+}
+
+func (m *MemoryEngineFileHandler) getInput() string {
+	if !m.persisted {
+		return ""
+	}
+	return m.checkpointPath
+}
+
+func (m *MemoryEngineFileHandler) getOutput() string {
+	return m.output
+}
+
+func (m *MemoryEngineFileHandler) isPersisted() bool {
+	return m.persisted
+}
+
+func (m *MemoryEngineFileHandler) checkpoint() error {
+	if m.persisted {
+		return nil
+	}
+	checkpointPath := path.Join(m.dir, uuid.NewString())
+	log.Debugf("checkpointing in-memory contents to %s", checkpointPath)
+	err := os.WriteFile(checkpointPath, m.input, 0600)
+	if err != nil {
+		return err
+	}
+	m.stale = m.checkpointPath
+	m.checkpointPath = checkpointPath
+	m.persisted = true
+	return nil
+}
+
+func (m *MemoryEngineFileHandler) remove() error {
+	if m.checkpointPath == "" {
+		return nil
+	}
+	return os.Remove(m.checkpointPath)
+}
+
+func (m *MemoryEngineFileHandler) release() {
+	if m.stale == "" {
+		return
+	}
+	err := os.Remove(m.stale)
+	if err != nil {
+		log.WithError(err).Warnf("failed to remove checkpoint %s", m.stale)
+	}
+	m.stale = ""
+}
+
+func (m *MemoryEngineFileHandler) getNewFileHandler() sessionFileHandler {
+	m.Close()
+
+	if m.writer == nil {
+		return &MemoryEngineFileHandler{
+			input:          m.input,
+			dir:            m.dir,
+			output:         path.Join(m.dir, uuid.NewString()),
+			maxSize:        m.maxSize,
+			checkpointPath: m.checkpointPath,
+			persisted:      m.persisted,
+		}
+	}
+
+	if m.writer.file != nil {
+		log.Debugf("in-memory contents spilled to %s, continuing on disk", m.output)
+		next := NewDefaultEngineFileHandler(m.output)
+		// the checkpoint is removed after the next handler's WAL entry, which refers to the spilled file
+		next.stale = m.checkpointPath
+		return next
+	}
+
+	return &MemoryEngineFileHandler{
+		input:          m.writer.buffer.Bytes(),
+		dir:            m.dir,
+		output:         path.Join(m.dir, uuid.NewString()),
+		maxSize:        m.maxSize,
+		checkpointPath: m.checkpointPath,
+	}
+}
+
+// spillingWriter writes to memory until maxSize is exceeded, then moves everything to a file at path.
+type spillingWriter struct {
+	buffer  bytes.Buffer
+	path    string
+	maxSize int
+	file    *os.File
+}
+
+func (w *spillingWriter) Write(p []byte) (int, error) {
+	if w.file == nil && w.buffer.Len()+len(p) > w.maxSize {
+		log.Debugf("in-memory contents exceeded %d bytes, spilling to %s", w.maxSize, w.path)
+		file, err := os.Create(w.path)
+		if err != nil {
+			return 0, err
+		}
+		_, err = file.Write(w.buffer.Bytes())
+		if err != nil {
+			file.Close()
+			return 0, err
+		}
+		w.buffer.Reset()
+		w.file = file
+	}
+	if w.file != nil {
+		return w.file.Write(p)
+	}
+	return w.buffer.Write(p)
+}
+
+func (w *spillingWriter) close() {
+	if w.file != nil {
+		w.file.Close()
+	}
+}
@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryEngineFileHandler_WriteStaysInMemory(t *testing.T) {
+	dir := t.TempDir()
+	fileHandler := NewMemoryEngineFileHandler([]byte("input"), dir, 16)
+
+	writer, err := fileHandler.Write()
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte("output"))
+	assert.NoError(t, err)
+
+	next := fileHandler.getNewFileHandler()
+	assert.IsType(t, &MemoryEngineFileHandler{}, next)
+	assert.False(t, next.isPersisted())
+
+	reader, err := next.Read()
+	assert.NoError(t, err)
+	contents, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "output", string(contents))
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestMemoryEngineFileHandler_SpillsToDisk(t *testing.T) {
+	dir := t.TempDir()
+	fileHandler := NewMemoryEngineFileHandler([]byte("input"), dir, 8)
+
+	writer, err := fileHandler.Write()
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte("12345"))
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte("67890"))
+	assert.NoError(t, err)
+	assert.NoError(t, fileHandler.checkpoint())
+	checkpointPath := fileHandler.getInput()
+
+	next := fileHandler.getNewFileHandler()
+	assert.IsType(t, &DefaultEngineFileHandler{}, next)
+	assert.True(t, next.isPersisted())
+
+	contents, err := os.ReadFile(next.getInput())
+	assert.NoError(t, err)
+	assert.Equal(t, "1234567890", string(contents))
+
+	// the checkpoint stays until the next WAL entry, which refers to the spilled file, is written
+	assert.FileExists(t, checkpointPath)
+	next.release()
+	assert.NoFileExists(t, checkpointPath)
+}
+
+func TestMemoryEngineFileHandler_Checkpoint(t *testing.T) {
+	dir := t.TempDir()
+	fileHandler := NewMemoryEngineFileHandler([]byte("input"), dir, 16)
+	assert.Equal(t, "", fileHandler.getInput())
+
+	err := fileHandler.checkpoint()
+	assert.NoError(t, err)
+	assert.True(t, fileHandler.isPersisted())
+	checkpointPath := fileHandler.getInput()
+	contents, err := os.ReadFile(checkpointPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "input", string(contents))
+
+	// reading doesn't change the contents, so the checkpoint is still valid
+	next := fileHandler.getNewFileHandler()
+	assert.True(t, next.isPersisted())
+	assert.Equal(t, checkpointPath, next.getInput())
+
+	// writing invalidates the checkpoint, but keeps it on disk for recovery
+	writer, err := next.Write()
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte("output"))
+	assert.NoError(t, err)
+	next = next.getNewFileHandler()
+	assert.False(t, next.isPersisted())
+	assert.FileExists(t, checkpointPath)
+
+	// the previous checkpoint is removed once the next WAL entry is written
+	err = next.checkpoint()
+	assert.NoError(t, err)
+	assert.FileExists(t, checkpointPath)
+	next.release()
+	assert.NoFileExists(t, checkpointPath)
+
+	info, err := os.Stat(next.getInput())
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	err = next.remove()
+	assert.NoError(t, err)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
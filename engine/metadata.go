@@ -0,0 +1,187 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	log "github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+)
+
+var metadataReferenceRegex = regexp.MustCompile(`\$env\[\s*["']([^"']+)["']\s*\]`)
+
+func getNamespace(c config.HandlerConfig, h definitions.Handler) string {
+	if c.Alias != "" {
+		return c.Alias
+	}
+	return h.Name()
+}
+
+func getOutputs(h definitions.Handler) ([]string, bool) {
+	declarer, ok := h.(definitions.OutputDeclarer)
+	if !ok {
+		return nil, false
+	}
+	return declarer.Outputs(), true
+}
+
+// getDestinations returns where the handler sent the document, from the outputs it wrote under its name.
+func getDestinations(h definitions.Handler, flow *definitions.EngineFlowObject) []string {
+	declarer, ok := h.(definitions.DestinationDeclarer)
+	if !ok {
+		return nil
+	}
+	var destinations []string
+	for _, key := range declarer.Destinations() {
+		var values []interface{}
+		switch value := flow.Metadata[h.Name()+"."+key].(type) {
+		case []string:
+			for _, v := range value {
+				values = append(values, v)
+			}
+		case []interface{}:
+			values = value
+		default:
+			values = []interface{}{value}
+		}
+		for _, value := range values {
+			if value != nil && fmt.Sprint(value) != "" {
+				destinations = append(destinations, fmt.Sprint(value))
+			}
+		}
+	}
+	return destinations
+}
+
+// clearOutputs removes the declared outputs under the name of an aliased handler before it runs, so only the ones
+// it writes are namespaced, and returns their values.
+func clearOutputs(hCtx handlerContext, flow *definitions.EngineFlowObject) map[string]interface{} {
+	name := hCtx.handler.Name()
+	if hCtx.namespace == name {
+		return nil
+	}
+	previous := map[string]interface{}{}
+	for _, output := range hCtx.outputs {
+		value, ok := flow.Metadata[name+"."+output]
+		if !ok {
+			continue
+		}
+		previous[name+"."+output] = value
+		delete(flow.Metadata, name+"."+output)
+	}
+	return previous
+}
+
+// namespaceOutputs copies the declared outputs that the handler wrote under its name to its alias,
+// so steps of the same type don't overwrite each other's values. The outputs it didn't write get back
+// their previous values from clearOutputs.
+func namespaceOutputs(hCtx handlerContext, flow *definitions.EngineFlowObject, previous map[string]interface{}) {
+	name := hCtx.handler.Name()
+	if hCtx.namespace == name {
+		return
+	}
+	for _, output := range hCtx.outputs {
+		value, ok := flow.Metadata[name+"."+output]
+		if !ok {
+			if value, ok := previous[name+"."+output]; ok {
+				flow.Metadata[name+"."+output] = value
+			}
+			continue
+		}
+		log.Debugf("namespacing metadata %s.%s as %s.%s", name, output, hCtx.namespace, output)
+		flow.Metadata[hCtx.namespace+"."+output] = value
+	}
+}
+
+// validateAliases checks the aliases, and that handlers used by more than one step all have one,
+// since they write their outputs under the same name.
+func validateAliases(handlers []handlerContext) error {
+	names := map[string]int{}
+	for _, hCtx := range handlers {
+		names[hCtx.handler.Name()]++
+	}
+	for _, hCtx := range handlers {
+		if hCtx.namespace == hCtx.handler.Name() && names[hCtx.handler.Name()] > 1 {
+			return fmt.Errorf("handler %s is used by more than one step, each of them needs an alias", hCtx.handler.Name())
+		}
+	}
+
+	aliases := map[string]bool{}
+	for _, hCtx := range handlers {
+		if hCtx.namespace == hCtx.handler.Name() {
+			continue
+		}
+		if strings.Contains(hCtx.namespace, ".") {
+			return fmt.Errorf("alias %s of handler %s must not contain '.'", hCtx.namespace, hCtx.handler.Name())
+		}
+		if hCtx.namespace == definitions.JobMetadataNamespace {
+			return fmt.Errorf("alias %s of handler %s is reserved for the job metadata", hCtx.namespace, hCtx.handler.Name())
+		}
+		if names[hCtx.namespace] > 0 {
+			return fmt.Errorf("alias %s of handler %s collides with a handler name", hCtx.namespace, hCtx.handler.Name())
+		}
+		if aliases[hCtx.namespace] {
+			return fmt.Errorf("alias %s is used by more than one handler", hCtx.namespace)
+		}
+		aliases[hCtx.namespace] = true
+	}
+	return nil
+}
+
+// validateMetadataReferences checks that every `$env["Namespace.Key"]` expression in a handler's config
+// refers to a key that an earlier step declares. Keys outside the pipeline's namespaces are not checked,
+// since they may be seeded by the job source.
+func validateMetadataReferences(handlers []handlerContext, configs []config.HandlerConfig) error {
+	namespaces := map[string]bool{}
+	for _, hCtx := range handlers {
+		namespaces[hCtx.handler.Name()] = true
+		namespaces[hCtx.namespace] = true
+	}
+
+	produced := map[string]bool{}
+	for i, hCtx := range handlers {
+		for _, reference := range getMetadataReferences(configs[i].Config) {
+			namespace, _, found := strings.Cut(reference, ".")
+			if !found || !namespaces[namespace] || produced[reference] {
+				continue
+			}
+			return fmt.Errorf("handler %s (%s) references metadata %s which no earlier step produces", hCtx.handler.Name(), hCtx.namespace, reference)
+		}
+
+		for _, output := range hCtx.outputs {
+			produced[hCtx.handler.Name()+"."+output] = true
+			produced[hCtx.namespace+"."+output] = true
+		}
+		if !hCtx.declaresOutputs {
+			log.Warnf("handler %s does not declare its outputs, skipping metadata validation for the rest of the pipeline", hCtx.handler.Name())
+			return nil
+		}
+	}
+	return nil
+}
+
+func getMetadataReferences(value interface{}) []string {
+	var references []string
+	switch v := value.(type) {
+	case string:
+		for _, match := range metadataReferenceRegex.FindAllStringSubmatch(v, -1) {
+			references = append(references, match[1])
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			references = append(references, getMetadataReferences(key)...)
+			references = append(references, getMetadataReferences(item)...)
+		}
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			references = append(references, getMetadataReferences(key)...)
+			references = append(references, getMetadataReferences(item)...)
+		}
+	case []interface{}:
+		for _, item := range v {
+			references = append(references, getMetadataReferences(item)...)
+		}
+	}
+	return references
+}
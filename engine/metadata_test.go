@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/handler"
+	"github.com/benyaa/virtual-printer-process-engine/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestHandlerContexts(t *testing.T, configs []config.HandlerConfig) []handlerContext {
+	var handlers []handlerContext
+	previousID := ""
+	for _, c := range configs {
+		h, err := handler.GetHandler(c, previousID)
+		assert.NoError(t, err)
+		previousID = h.GetID()
+		outputs, declaresOutputs := getOutputs(h)
+		handlers = append(handlers, handlerContext{
+			handler:         h,
+			namespace:       getNamespace(c, h),
+			outputs:         outputs,
+			declaresOutputs: declaresOutputs,
+		})
+	}
+	return handlers
+}
+
+func TestValidateMetadataReferences_ProducedByEarlierStep(t *testing.T) {
+	configs := []config.HandlerConfig{
+		{Name: "WriteFile", Alias: "first", Config: map[string]interface{}{"output": "/tmp/a"}},
+		{Name: "ReadFile", Config: map[string]interface{}{"input": `${$env["first.OutputPath"]}`}},
+		{Name: "WriteFile", Alias: "copy", Config: map[string]interface{}{"output": `${$env["WriteFile.OutputPath"]}.copy`}},
+	}
+	handlers := newTestHandlerContexts(t, configs)
+
+	assert.NoError(t, validateAliases(handlers))
+	assert.NoError(t, validateMetadataReferences(handlers, configs))
+}
+
+func TestValidateMetadataReferences_ProducedByLaterStep(t *testing.T) {
+	configs := []config.HandlerConfig{
+		{Name: "ReadFile", Config: map[string]interface{}{"input": `${$env["WriteFile.OutputPath"]}`}},
+		{Name: "WriteFile", Config: map[string]interface{}{"output": "/tmp/a"}},
+	}
+	handlers := newTestHandlerContexts(t, configs)
+
+	assert.Error(t, validateMetadataReferences(handlers, configs))
+}
+
+func TestValidateMetadataReferences_UnknownKey(t *testing.T) {
+	configs := []config.HandlerConfig{
+		{Name: "WriteFile", Config: map[string]interface{}{"output": "/tmp/a"}},
+		{Name: "RunExecutable", Config: map[string]interface{}{
+			"executable": "echo",
+			"args":       []interface{}{`${$env['WriteFile.OutputFile']}`},
+		}},
+	}
+	handlers := newTestHandlerContexts(t, configs)
+
+	assert.Error(t, validateMetadataReferences(handlers, configs))
+}
+
+func TestValidateMetadataReferences_IgnoresForeignNamespaces(t *testing.T) {
+	configs := []config.HandlerConfig{
+		{Name: "WriteFile", Config: map[string]interface{}{"output": `/tmp/${$env["Job.Title"]}`}},
+	}
+	handlers := newTestHandlerContexts(t, configs)
+
+	assert.NoError(t, validateMetadataReferences(handlers, configs))
+}
+
+func TestValidateAliases_Duplicate(t *testing.T) {
+	configs := []config.HandlerConfig{
+		{Name: "WriteFile", Alias: "archive", Config: map[string]interface{}{"output": "/tmp/a"}},
+		{Name: "WriteFile", Alias: "archive", Config: map[string]interface{}{"output": "/tmp/b"}},
+	}
+	handlers := newTestHandlerContexts(t, configs)
+
+	assert.Error(t, validateAliases(handlers))
+}
+
+func TestValidateAliases_DuplicateHandlerWithoutAlias(t *testing.T) {
+	configs := []config.HandlerConfig{
+		{Name: "WriteFile", Config: map[string]interface{}{"output": "/tmp/a"}},
+		{Name: "WriteFile", Alias: "archive", Config: map[string]interface{}{"output": "/tmp/b"}},
+	}
+	handlers := newTestHandlerContexts(t, configs)
+
+	assert.Error(t, validateAliases(handlers))
+}
+
+func TestValidateAliases_CollidesWithHandlerName(t *testing.T) {
+	configs := []config.HandlerConfig{
+		{Name: "ReadFile", Config: map[string]interface{}{"input": "/tmp/a"}},
+		{Name: "WriteFile", Alias: "ReadFile", Config: map[string]interface{}{"output": "/tmp/b"}},
+	}
+	handlers := newTestHandlerContexts(t, configs)
+
+	assert.Error(t, validateAliases(handlers))
+}
+
+func TestNamespaceOutputs(t *testing.T) {
+	configs := []config.HandlerConfig{
+		{Name: "WriteFile", Alias: "archive", Config: map[string]interface{}{"output": "/tmp/a"}},
+	}
+	handlers := newTestHandlerContexts(t, configs)
+	flow := &definitions.EngineFlowObject{
+		Metadata: map[string]interface{}{"WriteFile.OutputPath": "/tmp/a"},
+	}
+
+	namespaceOutputs(handlers[0], flow, nil)
+
+	assert.Equal(t, "/tmp/a", flow.Metadata["archive.OutputPath"])
+	assert.Equal(t, "/tmp/a", flow.Metadata["WriteFile.OutputPath"])
+}
+
+// outputHandler copies its input, and writes value to its output unless it's empty.
+type outputHandler struct {
+	copyHandler
+	value string
+}
+
+func (h *outputHandler) Name() string {
+	return "Output"
+}
+
+func (h *outputHandler) Outputs() []string {
+	return []string{"Value"}
+}
+
+func (h *outputHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	if h.value != "" {
+		info.Metadata["Output.Value"] = h.value
+	}
+	return h.copyHandler.Handle(info, fileHandler)
+}
+
+func TestNamespaceOutputs_OnlyWrittenByTheStep(t *testing.T) {
+	e := newTestEngine(t)
+	var handlers []handlerContext
+	for i, alias := range []string{"first", "second"} {
+		h := &outputHandler{copyHandler: copyHandler{BaseHandler: definitions.BaseHandler{ID: fmt.Sprintf("Output_%d", i)}}}
+		if alias == "first" {
+			h.value = "written"
+		}
+		handlers = append(handlers, handlerContext{
+			handler:         h,
+			retryMechanism:  config.HandlerRetryMechanism{MaxRetries: 1},
+			namespace:       alias,
+			outputs:         h.Outputs(),
+			declaresOutputs: true,
+		})
+	}
+	e.Pipelines[config.DefaultPipeline] = handlers
+	printInfo := newTestPrintInfo(t)
+
+	e.handleFile(printInfo)
+	job, _ := e.jobStore.Get(printInfo.SessionID)
+	assert.Equal(t, repo.JobCompleted, job.Status)
+	assert.Equal(t, "written", job.Metadata["first.Value"])
+	assert.NotContains(t, job.Metadata, "second.Value")
+	assert.Equal(t, "written", job.Metadata["Output.Value"])
+}
+
+func TestValidateAliases_ReservedJobNamespace(t *testing.T) {
+	configs := []config.HandlerConfig{
+		{Name: "WriteFile", Alias: "Job", Config: map[string]interface{}{"output": "/tmp/a"}},
+	}
+	handlers := newTestHandlerContexts(t, configs)
+
+	assert.Error(t, validateAliases(handlers))
+}
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"github.com/benyaa/virtual-printer-process-engine/config"
 	"github.com/benyaa/virtual-printer-process-engine/definitions"
 	"github.com/benyaa/virtual-printer-process-engine/repo"
 	"github.com/benyaa/virtual-printer-process-engine/utils"
@@ -24,16 +25,26 @@ func (e *Engine) Recover() error {
 	// Map to track sessions and their last log entry
 	sessionMap := e.createSessionMapForWAL(entries)
 
+	// Every session is queued before any is processed, so retries can't start the ones that weren't reached yet
+	for sessionID, lastEntry := range sessionMap {
+		if !e.jobStore.TryQueue(sessionID, getPipeline(lastEntry)) {
+			log.Infof("session %s was already retried, not recovering it", sessionID)
+			delete(sessionMap, sessionID)
+		}
+	}
+
 	for sessionID, lastEntry := range sessionMap {
 		fileHandler, flow, err := e.getProcessHandlerForSession(sessionID, lastEntry, err)
 		if err != nil {
+			e.failJob(sessionID, err)
 			if !e.IgnoreRecoveryErrors {
 				return err
 			}
 			continue
 		}
+		fileHandler.previousInputs = getSessionInputs(entries, sessionID, fileHandler.input)
 
-		err = e.processHandlers(flow, fileHandler, lastEntry.HandlerID, sessionID)
+		err = e.processHandlers(flow, fileHandler, getPipeline(lastEntry), getStartHandlerID(lastEntry), sessionID)
 		if err != nil && !e.IgnoreRecoveryErrors {
 			log.WithError(err).Errorf("failed to recover session %s", sessionID)
 			return err
@@ -43,6 +54,14 @@ func (e *Engine) Recover() error {
 	return nil
 }
 
+// getPipeline returns the pipeline of the entry's session.
+func getPipeline(entry repo.LogEntry) string {
+	if entry.Pipeline == "" {
+		return config.DefaultPipeline
+	}
+	return entry.Pipeline
+}
+
 func (e *Engine) createSessionMapForWAL(entries []repo.LogEntry) map[uuid.UUID]repo.LogEntry {
 	sessionMap := make(map[uuid.UUID]repo.LogEntry)
 
@@ -52,6 +71,10 @@ func (e *Engine) createSessionMapForWAL(entries []repo.LogEntry) map[uuid.UUID]r
 			delete(sessionMap, entry.SessionID)
 			continue
 		}
+		// In-memory entries can't be recovered, so the session resumes from its last checkpoint
+		if entry.InMemory {
+			continue
+		}
 		sessionMap[entry.SessionID] = entry
 	}
 	return sessionMap
@@ -62,3 +62,19 @@ func TestCreateSessionMapForWAL_MultipleSessionsMixed(t *testing.T) {
 	assert.Contains(t, sessionMap, sessionID2)
 	assert.Equal(t, "handler_1", sessionMap[sessionID2].HandlerName)
 }
+
+func TestCreateSessionMapForWAL_InMemoryEntriesResumeFromCheckpoint(t *testing.T) {
+	engine := Engine{}
+	sessionID := uuid.New()
+	entries := []repo.LogEntry{
+		{SessionID: sessionID, HandlerName: "__init__"},
+		{SessionID: sessionID, HandlerName: "handler_1", InMemory: true},
+		{SessionID: sessionID, HandlerName: "handler_2"},
+		{SessionID: sessionID, HandlerName: "handler_3", InMemory: true},
+	}
+
+	sessionMap := engine.createSessionMapForWAL(entries)
+
+	assert.Len(t, sessionMap, 1)
+	assert.Equal(t, "handler_2", sessionMap[sessionID].HandlerName)
+}
@@ -0,0 +1,40 @@
+package engine
+
+import (
+	"context"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/benyaa/virtual-printer-process-engine/engine")
+
+func startSessionSpan(sessionID uuid.UUID, pipeline string, startHandlerID string, pages int) (context.Context, trace.Span) {
+	return tracer.Start(context.Background(), "session", trace.WithAttributes(
+		attribute.String("session.id", sessionID.String()),
+		attribute.String("pipeline", pipeline),
+		attribute.String("start_handler.id", startHandlerID),
+		attribute.Int("pages", pages),
+	))
+}
+
+func startHandlerSpan(ctx context.Context, sessionID uuid.UUID, h definitions.Handler, pages int, attempt int) (context.Context, trace.Span) {
+	return tracer.Start(ctx, h.Name(), trace.WithAttributes(
+		attribute.String("session.id", sessionID.String()),
+		attribute.String("handler.id", h.GetID()),
+		attribute.String("handler.name", h.Name()),
+		attribute.Int("pages", pages),
+		attribute.Int("attempt", attempt),
+	))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,45 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	failing := &copyHandler{BaseHandler: definitions.BaseHandler{ID: "Copy_1"}, fail: true}
+	e := newTestEngine(t, &copyHandler{BaseHandler: definitions.BaseHandler{ID: "Copy_0"}}, failing)
+	printInfo := newTestPrintInfo(t)
+	printInfo.Pages = 3
+	e.handleFile(printInfo)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 3)
+	session := spans[2]
+	assert.Equal(t, "session", session.Name())
+	assert.Equal(t, codes.Error, session.Status().Code)
+	assert.Contains(t, session.Attributes(), attribute.String("session.id", printInfo.SessionID.String()))
+	assert.Contains(t, session.Attributes(), attribute.Int("pages", 3))
+
+	for i, handlerID := range []string{"Copy_0", "Copy_1"} {
+		span := spans[i]
+		assert.Equal(t, "Copy", span.Name())
+		assert.Equal(t, session.SpanContext().SpanID(), span.Parent().SpanID())
+		assert.Equal(t, session.SpanContext().TraceID(), span.SpanContext().TraceID())
+		assert.Contains(t, span.Attributes(), attribute.String("handler.id", handlerID))
+		assert.Contains(t, span.Attributes(), attribute.String("session.id", printInfo.SessionID.String()))
+		assert.Contains(t, span.Attributes(), attribute.Int("attempt", 1))
+	}
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"github.com/benyaa/virtual-printer-process-engine/config"
 	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/handler/imaging"
+	"github.com/benyaa/virtual-printer-process-engine/handler/pdf"
 	"github.com/benyaa/virtual-printer-process-engine/handler/uploadhttp"
 	log "github.com/sirupsen/logrus"
 )
@@ -24,6 +26,38 @@ func GetHandler(c config.HandlerConfig, idPrefix string) (definitions.Handler, e
 		handler, err = uploadhttp.NewUploadHTTPHandler(idPrefix, c.Config)
 	case "ConvertPNGToJPEG":
 		handler, err = NewConvertPNGToJPEGHandler(idPrefix, c.Config)
+	case "ConvertImage":
+		handler, err = imaging.NewConvertHandler(idPrefix, c.Config)
+	case "ImageTransform":
+		handler, err = imaging.NewTransformHandler(idPrefix, c.Config)
+	case "ComposeImages":
+		handler, err = imaging.NewComposeHandler(idPrefix, c.Config)
+	case "AssembleTIFF":
+		handler, err = imaging.NewAssembleTIFFHandler(idPrefix, c.Config)
+	case "PDFSplit":
+		handler, err = pdf.NewSplitHandler(idPrefix, c.Config)
+	case "PDFExtractPages":
+		handler, err = pdf.NewExtractPagesHandler(idPrefix, c.Config)
+	case "PDFRotate":
+		handler, err = pdf.NewRotateHandler(idPrefix, c.Config)
+	case "PDFMerge":
+		handler, err = pdf.NewMergeHandler(idPrefix, c.Config)
+	case "PDFOptimize":
+		handler, err = pdf.NewOptimizeHandler(idPrefix, c.Config)
+	case "PDFWatermark":
+		handler, err = pdf.NewWatermarkHandler(idPrefix, c.Config)
+	case "PDFEncrypt":
+		handler, err = pdf.NewEncryptHandler(idPrefix, c.Config)
+	case "PDFDecrypt":
+		handler, err = pdf.NewDecryptHandler(idPrefix, c.Config)
+	case "PDFMetadata":
+		handler, err = pdf.NewMetadataHandler(idPrefix, c.Config)
+	case "PDFExtractText":
+		handler, err = pdf.NewExtractTextHandler(idPrefix, c.Config)
+	case "PDFSign":
+		handler, err = pdf.NewSignHandler(idPrefix, c.Config)
+	case "PDFVerifySignature":
+		handler, err = pdf.NewVerifySignatureHandler(idPrefix, c.Config)
 	default:
 		return nil, fmt.Errorf("unknown handler name")
 	}
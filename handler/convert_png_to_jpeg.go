@@ -42,6 +42,10 @@ func (h *ConvertPNGToJPEGHandler) Name() string {
 	return "ConvertPNGToJPEG"
 }
 
+func (h *ConvertPNGToJPEGHandler) Outputs() []string {
+	return []string{"OutputFile"}
+}
+
 func (h *ConvertPNGToJPEGHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
 	log.Debugf("evaluating input file %s", h.config.InputFile)
 	input, err := info.EvaluateExpression(h.config.InputFile)
@@ -92,9 +96,9 @@ func (h *ConvertPNGToJPEGHandler) Handle(info *definitions.EngineFlowObject, fil
 			log.WithError(err).Errorf("failed to close input file %s", h.config.InputFile)
 			return nil, err
 		}
-		err = os.Remove(h.config.InputFile)
+		err = os.Remove(input)
 		if err != nil {
-			log.WithError(err).Errorf("failed to remove original file %s", h.config.InputFile)
+			log.WithError(err).Errorf("failed to remove original file %s", input)
 			return nil, err
 		}
 	}
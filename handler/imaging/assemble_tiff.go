@@ -0,0 +1,142 @@
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	log "github.com/sirupsen/logrus"
+	"image"
+	"os"
+)
+
+// AssembleTIFFHandler assembles page images into one multi-page TIFF,
+// e.g. for document management and fax systems that only accept Group 4 compressed TIFFs.
+type AssembleTIFFHandler struct {
+	definitions.BaseHandler
+	config *assembleTIFFConfig
+}
+
+type assembleTIFFConfig struct {
+	// the pages, the session's contents is the only page when there are none
+	pageFilesConfig `mapstructure:",squash"`
+	// Compression is none, lzw(default), deflate or g4, which is CCITT Group 4 for black and white pages
+	Compression string `mapstructure:"compression,omitempty"`
+	// TIFF pages can't have a color depth of 32, and each page gets the one closest to its own by default
+	rasterConfig `mapstructure:",squash"`
+	// OutputFile is where to write the TIFF, the session's contents by default
+	OutputFile   string `mapstructure:"output_file,omitempty"`
+	RemoveInputs bool   `mapstructure:"remove_inputs,omitempty"`
+}
+
+func NewAssembleTIFFHandler(idPrefix string, c map[string]interface{}) (*AssembleTIFFHandler, error) {
+	h := &AssembleTIFFHandler{
+		BaseHandler: definitions.BaseHandler{
+			ID: idPrefix + "_assemble_tiff",
+		},
+	}
+	err := h.setConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *AssembleTIFFHandler) setConfig(config map[string]interface{}) error {
+	h.config = &assembleTIFFConfig{
+		Compression: "lzw",
+	}
+	err := h.DecodeMap(config, h.config)
+	if err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+	if _, ok := tiffCompressions[h.config.Compression]; !ok {
+		return fmt.Errorf("unknown compression %s, should be none, lzw, deflate or g4", h.config.Compression)
+	}
+	switch h.config.ColorDepth {
+	case 0, 1, 8, 24:
+	default:
+		return fmt.Errorf("invalid color depth %d, should be 1, 8 or 24", h.config.ColorDepth)
+	}
+	if h.config.Compression == "g4" {
+		if h.config.ColorDepth != 0 && h.config.ColorDepth != 1 {
+			return errors.New("g4 compression requires a color depth of 1")
+		}
+		h.config.ColorDepth = 1
+	}
+	if h.config.DPI < 0 {
+		return fmt.Errorf("invalid DPI %d", h.config.DPI)
+	}
+	if h.config.RemoveInputs && !h.config.isSet() {
+		return errors.New("remove_inputs requires files, files_metadata_key or glob")
+	}
+	return nil
+}
+
+func (h *AssembleTIFFHandler) Name() string {
+	return "AssembleTIFF"
+}
+
+func (h *AssembleTIFFHandler) Outputs() []string {
+	return []string{"OutputFile", "PageCount", "Compression"}
+}
+
+func (h *AssembleTIFFHandler) Destinations() []string {
+	return []string{"OutputFile"}
+}
+
+func (h *AssembleTIFFHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	files, err := h.config.getFiles(info)
+	if err != nil {
+		return nil, err
+	}
+	sources := h.config.isSet()
+	if sources && len(files) == 0 {
+		return nil, errors.New("no pages to assemble")
+	}
+	if !sources {
+		// the session's contents
+		files = []string{""}
+	}
+	output, err := info.EvaluateExpression(h.config.OutputFile)
+	if err != nil {
+		log.WithError(err).Errorf("failed to evaluate output file")
+		return nil, fmt.Errorf("failed to evaluate output file: %w", err)
+	}
+
+	var pages []tiffPage
+	for _, file := range files {
+		var img image.Image
+		img, _, err = readImage(file, fileHandler)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, newTIFFPage(img, h.config.ColorDepth, h.config.Dither))
+	}
+	encoded, err := encodeMultipageTIFF(pages, h.config.Compression, h.config.DPI)
+	if err != nil {
+		log.WithError(err).Errorf("failed to encode tiff")
+		return nil, fmt.Errorf("failed to encode tiff: %w", err)
+	}
+	err = writeImage(output, fileHandler, encoded)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("assembled %d pages into a %s compressed tiff", len(pages), h.config.Compression)
+
+	if h.config.RemoveInputs {
+		for _, file := range files {
+			if file == output {
+				continue
+			}
+			err = os.Remove(file)
+			if err != nil {
+				log.WithError(err).Warnf("failed to remove input file %s", file)
+			}
+		}
+	}
+
+	info.Metadata["AssembleTIFF.OutputFile"] = output
+	info.Metadata["AssembleTIFF.PageCount"] = len(pages)
+	info.Metadata["AssembleTIFF.Compression"] = h.config.Compression
+	return info, nil
+}
@@ -0,0 +1,181 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/ccitt"
+	"golang.org/x/image/tiff"
+	"image"
+	"image/color"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tiffIFD is a page's tags, with only the first value of each.
+type tiffIFD map[uint16]uint32
+
+// readIFDs reads the tags of each page of a little endian TIFF.
+func readIFDs(t *testing.T, encoded []byte) []tiffIFD {
+	var ifds []tiffIFD
+	assert.Equal(t, "II*\x00", string(encoded[:4]))
+	offset := binary.LittleEndian.Uint32(encoded[4:])
+	for offset != 0 {
+		assert.Zero(t, offset%2, "IFDs start on a word boundary")
+		ifd := tiffIFD{}
+		entries := int(binary.LittleEndian.Uint16(encoded[offset:]))
+		for i := 0; i < entries; i++ {
+			entry := encoded[int(offset)+2+i*12:]
+			tag, dataType := binary.LittleEndian.Uint16(entry), binary.LittleEndian.Uint16(entry[2:])
+			value := binary.LittleEndian.Uint32(entry[8:])
+			switch {
+			case dataType == tiffShort:
+				value = uint32(binary.LittleEndian.Uint16(entry[8:]))
+			case dataType == tiffRational:
+				value = binary.LittleEndian.Uint32(encoded[value:])
+			}
+			ifd[tag] = value
+		}
+		ifds = append(ifds, ifd)
+		offset = binary.LittleEndian.Uint32(encoded[int(offset)+2+entries*12:])
+	}
+	return ifds
+}
+
+// decodeG4 decodes the page's strip, with 1 for black.
+func decodeG4(t *testing.T, encoded []byte, ifd tiffIFD) []byte {
+	strip := encoded[ifd[tiffStripOffsets] : ifd[tiffStripOffsets]+ifd[tiffStripByteCounts]]
+	reader := ccitt.NewReader(bytes.NewReader(strip), ccitt.MSB, ccitt.Group4, int(ifd[tiffImageWidth]), int(ifd[tiffImageLength]), &ccitt.Options{Invert: true})
+	decoded, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	return decoded
+}
+
+func TestEncodeG4_DecodesToTheSameRows(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	// wide enough for the extended make-up codes, with long runs and short ones
+	width, height := 6000, 40
+	var rows [][]byte
+	packed := make([]byte, 0, (width+7)/8*height)
+	for y := 0; y < height; y++ {
+		row := make([]byte, width)
+		var color byte
+		for x := 0; x < width; {
+			run := random.Intn(8)
+			if random.Intn(4) == 0 {
+				run = random.Intn(3000)
+			}
+			for end := min(width, x+run); x < end; x++ {
+				row[x] = color
+			}
+			color = 1 - color
+		}
+		rows = append(rows, row)
+		packed = append(packed, packBits(row)...)
+	}
+
+	encoded := encodeG4(rows, width)
+	reader := ccitt.NewReader(bytes.NewReader(encoded), ccitt.MSB, ccitt.Group4, width, height, &ccitt.Options{Invert: true})
+	decoded, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, packed, decoded)
+}
+
+func packBits(row []byte) []byte {
+	packed := make([]byte, (len(row)+7)/8)
+	for x, bit := range row {
+		if bit == 1 {
+			packed[x/8] |= 0x80 >> (x % 8)
+		}
+	}
+	return packed
+}
+
+func TestAssembleTIFFHandler_G4(t *testing.T) {
+	dir := t.TempDir()
+	writePage(t, filepath.Join(dir, "page2.png"), 30, 20, color.White)
+	page := image.NewGray(image.Rect(0, 0, 20, 10))
+	for i := range page.Pix {
+		page.Pix[i] = 255
+	}
+	page.SetGray(3, 4, color.Gray{Y: 10})
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "page1.png"), encodePNG(t, page), 0644))
+	output := filepath.Join(dir, "out", "fax.tif")
+
+	_, metadata := handle(t, NewAssembleTIFFHandler, map[string]interface{}{
+		"glob":          filepath.Join(dir, "page*.png"),
+		"compression":   "g4",
+		"dpi":           200,
+		"output_file":   output,
+		"remove_inputs": true,
+	}, nil)
+	assert.Equal(t, output, metadata["AssembleTIFF.OutputFile"])
+	assert.Equal(t, 2, metadata["AssembleTIFF.PageCount"])
+	assert.Equal(t, "g4", metadata["AssembleTIFF.Compression"])
+	assert.NoFileExists(t, filepath.Join(dir, "page1.png"))
+
+	encoded, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	ifds := readIFDs(t, encoded)
+	assert.Len(t, ifds, 2)
+	for i, ifd := range ifds {
+		assert.Equal(t, uint32(4), ifd[tiffCompression])
+		assert.Equal(t, uint32(1), ifd[tiffBitsPerSample])
+		assert.Equal(t, uint32(tiffWhiteIsZero), ifd[tiffPhotometric])
+		assert.Equal(t, uint32(200), ifd[tiffXResolution])
+		assert.Equal(t, uint32(200), ifd[tiffYResolution])
+		assert.Equal(t, uint32(i), ifd[tiffPageNumber])
+	}
+	assert.Equal(t, uint32(20), ifds[0][tiffImageWidth])
+	assert.Equal(t, uint32(30), ifds[1][tiffImageWidth])
+
+	expected := make([]byte, 3*10)
+	expected[4*3] = 0x80 >> 3
+	assert.Equal(t, expected, decodeG4(t, encoded, ifds[0]))
+	assert.Equal(t, make([]byte, 4*20), decodeG4(t, encoded, ifds[1]))
+}
+
+func TestAssembleTIFFHandler_LZW(t *testing.T) {
+	img := createImage(16, 8)
+	encoded, metadata := handle(t, NewAssembleTIFFHandler, map[string]interface{}{}, encodePNG(t, img))
+	assert.Equal(t, "", metadata["AssembleTIFF.OutputFile"])
+	assert.Equal(t, 1, metadata["AssembleTIFF.PageCount"])
+
+	ifds := readIFDs(t, encoded)
+	assert.Len(t, ifds, 1)
+	assert.Equal(t, uint32(5), ifds[0][tiffCompression])
+	assert.Equal(t, uint32(defaultTIFFResolution), ifds[0][tiffXResolution])
+
+	decoded, err := tiff.Decode(bytes.NewReader(encoded))
+	assert.NoError(t, err)
+	// the transparent half is flattened onto white
+	assertColor(t, color.White, decoded, 0, 0)
+	assertColor(t, flatten(img).At(12, 5), decoded, 12, 5)
+}
+
+func TestAssembleTIFFHandler_ColorDepths(t *testing.T) {
+	for _, compression := range []string{"none", "deflate", "lzw"} {
+		for _, colorDepth := range []int{1, 8, 24} {
+			img := createImage(13, 5)
+			encoded, _ := handle(t, NewAssembleTIFFHandler, map[string]interface{}{
+				"compression": compression,
+				"color_depth": colorDepth,
+			}, encodePNG(t, img))
+
+			decoded, err := tiff.Decode(bytes.NewReader(encoded))
+			if !assert.NoError(t, err, "%s %d", compression, colorDepth) {
+				continue
+			}
+			assert.Equal(t, img.Bounds(), decoded.Bounds())
+			expected := convertColorDepth(img, encodeOptions{colorDepth: colorDepth})
+			for y := 0; y < 5; y++ {
+				for x := 0; x < 13; x++ {
+					assertColor(t, expected.At(x, y), decoded, x, y)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/utils"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const defaultJPEGQuality = 90
+
+// formats are the supported formats by their names, including the aliases.
+var formats = map[string]string{
+	"png":  "png",
+	"jpeg": "jpeg",
+	"jpg":  "jpeg",
+	"gif":  "gif",
+	"bmp":  "bmp",
+	"tiff": "tiff",
+	"tif":  "tiff",
+}
+
+// colorDepths are the supported bits per pixel, 0 keeps the image's.
+var colorDepths = map[int]bool{0: true, 1: true, 8: true, 24: true, 32: true}
+
+var blackAndWhite = color.Palette{color.Black, color.White}
+
+// rasterConfig are the options of the handlers that write images, on how their colors are reduced and their resolution.
+type rasterConfig struct {
+	// ColorDepth is the bits per pixel: 1 (black and white), 8 (grayscale), 24 (RGB) or 32 (RGBA), the image's by default
+	ColorDepth int `mapstructure:"color_depth,omitempty"`
+	// Dither dithers the colors that are reduced, instead of using the nearest ones
+	Dither bool `mapstructure:"dither,omitempty"`
+	// DPI is the resolution, it's only written and the images aren't resampled
+	DPI int `mapstructure:"dpi,omitempty"`
+}
+
+// encodeOptions are how to encode an image.
+type encodeOptions struct {
+	format     string
+	quality    int
+	colorDepth int
+	dpi        int
+	dither     bool
+}
+
+// parseFormat returns the format's name, e.g. `jpeg` for `JPG`.
+func parseFormat(name string) (string, error) {
+	format, ok := formats[strings.ToLower(strings.TrimPrefix(name, "."))]
+	if !ok {
+		return "", fmt.Errorf("unsupported image format %s", name)
+	}
+	return format, nil
+}
+
+// validateOptions validates the options that don't depend on the image.
+func validateOptions(options encodeOptions) error {
+	if options.quality < 1 || options.quality > 100 {
+		return fmt.Errorf("invalid quality %d, should be 1-100", options.quality)
+	}
+	if !colorDepths[options.colorDepth] {
+		return fmt.Errorf("invalid color depth %d, should be 1, 8, 24 or 32", options.colorDepth)
+	}
+	if options.dpi < 0 {
+		return fmt.Errorf("invalid DPI %d", options.dpi)
+	}
+	if options.colorDepth == 32 && options.format == "jpeg" {
+		return fmt.Errorf("jpeg doesn't support a color depth of 32, it has no transparency")
+	}
+	return nil
+}
+
+// readImage decodes the file, or the session's contents when path is empty, and returns its format.
+func readImage(path string, fileHandler definitions.EngineFileHandler) (image.Image, string, error) {
+	var reader io.Reader
+	if path == "" {
+		r, err := fileHandler.Read()
+		if err != nil {
+			log.WithError(err).Errorf("failed to read file")
+			return nil, "", fmt.Errorf("failed to read file: %w", err)
+		}
+		reader = r
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			log.WithError(err).Errorf("failed to open %s", path)
+			return nil, "", fmt.Errorf("failed to open %s: %w", path, err)
+		}
+		defer file.Close()
+		reader = file
+	}
+	img, format, err := image.Decode(reader)
+	if err != nil {
+		log.WithError(err).Errorf("failed to decode image")
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+	return img, format, nil
+}
+
+// writeImage writes the encoded image to the file, or to the session's contents when path is empty.
+func writeImage(path string, fileHandler definitions.EngineFileHandler, contents []byte) error {
+	if path == "" {
+		writer, err := fileHandler.Write()
+		if err != nil {
+			log.WithError(err).Errorf("failed to write file")
+			return fmt.Errorf("failed to write file: %w", err)
+		}
+		_, err = writer.Write(contents)
+		if err != nil {
+			log.WithError(err).Errorf("failed to write file")
+			return fmt.Errorf("failed to write file: %w", err)
+		}
+		return nil
+	}
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("failed to create output dir: %w", err)
+	}
+	err = os.WriteFile(path, contents, 0644)
+	if err != nil {
+		log.WithError(err).Errorf("failed to write %s", path)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// encodeImage encodes the image in the options' format, color depth and resolution.
+func encodeImage(img image.Image, options encodeOptions) ([]byte, error) {
+	img = convertColorDepth(img, options)
+	output := &bytes.Buffer{}
+	var err error
+	switch options.format {
+	case "png":
+		err = png.Encode(output, img)
+	case "jpeg":
+		err = jpeg.Encode(output, img, &jpeg.Options{Quality: options.quality})
+	case "gif":
+		err = gif.Encode(output, img, &gif.Options{NumColors: 256, Drawer: getDrawer(options)})
+	case "bmp":
+		err = bmp.Encode(output, img)
+	case "tiff":
+		err = tiff.Encode(output, img, &tiff.Options{Compression: tiff.Deflate})
+	default:
+		err = fmt.Errorf("unsupported image format %s", options.format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if options.dpi == 0 {
+		return output.Bytes(), nil
+	}
+	return setResolution(output.Bytes(), options.format, options.dpi)
+}
+
+// convertColorDepth converts the image to the color depth, and removes the transparency of formats that don't support it.
+func convertColorDepth(img image.Image, options encodeOptions) image.Image {
+	switch options.colorDepth {
+	case 1:
+		paletted := image.NewPaletted(img.Bounds(), blackAndWhite)
+		getDrawer(options).Draw(paletted, img.Bounds(), flatten(img), img.Bounds().Min)
+		return paletted
+	case 8:
+		gray := image.NewGray(img.Bounds())
+		draw.Draw(gray, img.Bounds(), flatten(img), img.Bounds().Min, draw.Src)
+		if options.format == "gif" {
+			// the GIF encoder would use its default palette, which has few grays
+			return toGrayPaletted(gray)
+		}
+		return gray
+	case 24:
+		return flatten(img)
+	case 32:
+		nrgba := image.NewNRGBA(img.Bounds())
+		draw.Draw(nrgba, img.Bounds(), img, img.Bounds().Min, draw.Src)
+		return nrgba
+	}
+	if options.format == "jpeg" {
+		return flatten(img)
+	}
+	return img
+}
+
+// flatten draws the image over a white background, as it would be printed.
+func flatten(img image.Image) image.Image {
+	if isOpaque(img) {
+		return img
+	}
+	flattened := image.NewRGBA(img.Bounds())
+	draw.Draw(flattened, flattened.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flattened, flattened.Bounds(), img, img.Bounds().Min, draw.Over)
+	return flattened
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+func toGrayPaletted(gray *image.Gray) *image.Paletted {
+	palette := make(color.Palette, 256)
+	for i := range palette {
+		palette[i] = color.Gray{Y: uint8(i)}
+	}
+	paletted := image.NewPaletted(gray.Bounds(), palette)
+	for y := gray.Bounds().Min.Y; y < gray.Bounds().Max.Y; y++ {
+		for x := gray.Bounds().Min.X; x < gray.Bounds().Max.X; x++ {
+			paletted.SetColorIndex(x, y, gray.GrayAt(x, y).Y)
+		}
+	}
+	return paletted
+}
+
+func getDrawer(options encodeOptions) draw.Drawer {
+	if options.dither {
+		return draw.FloydSteinberg
+	}
+	return draw.Src
+}
+
+// pageFilesConfig are the options of the handlers that take their pages from files.
+type pageFilesConfig struct {
+	utils.FilesConfig `mapstructure:",squash"`
+	// Glob matches more files, sorted by name with their numbers compared by value, e.g. `page2` before `page10`
+	Glob string `mapstructure:"glob,omitempty"`
+}
+
+func (c pageFilesConfig) isSet() bool {
+	return c.IsSet() || c.Glob != ""
+}
+
+// getFiles returns the configured files and the ones in the metadata key, followed by the glob's matches.
+func (c pageFilesConfig) getFiles(info *definitions.EngineFlowObject) ([]string, error) {
+	files, err := c.GetFiles(info.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	if c.Glob == "" {
+		return files, nil
+	}
+	pattern, err := info.EvaluateExpression(c.Glob)
+	if err != nil {
+		log.WithError(err).Errorf("failed to evaluate glob")
+		return nil, fmt.Errorf("failed to evaluate glob: %w", err)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob %s: %w", pattern, err)
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return naturalLess(matches[i], matches[j])
+	})
+	return append(files, matches...), nil
+}
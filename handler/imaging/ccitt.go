@@ -0,0 +1,154 @@
+package imaging
+
+// The CCITT codes, from ITU-T T.4 and T.6, as bit strings.
+const (
+	g4PassCode       = "0001"
+	g4HorizontalCode = "001"
+	g4EOLCode        = "000000000001"
+)
+
+// g4VerticalCodes are the vertical mode codes, by the offset of a1 from b1 plus 3.
+var g4VerticalCodes = [7]string{"0000010", "000010", "010", "1", "011", "000011", "0000011"}
+
+// whiteRunCodes are the terminating codes of the white runs 0-63, followed by the make-up codes of 64-1728.
+var whiteRunCodes = []string{
+	"00110101", "000111", "0111", "1000", "1011", "1100", "1110", "1111",
+	"10011", "10100", "00111", "01000", "001000", "000011", "110100", "110101",
+	"101010", "101011", "0100111", "0001100", "0001000", "0010111", "0000011", "0000100",
+	"0101000", "0101011", "0010011", "0100100", "0011000", "00000010", "00000011", "00011010",
+	"00011011", "00010010", "00010011", "00010100", "00010101", "00010110", "00010111", "00101000",
+	"00101001", "00101010", "00101011", "00101100", "00101101", "00000100", "00000101", "00001010",
+	"00001011", "01010010", "01010011", "01010100", "01010101", "00100100", "00100101", "01011000",
+	"01011001", "01011010", "01011011", "01001010", "01001011", "00110010", "00110011", "00110100",
+	"11011", "10010", "010111", "0110111", "00110110", "00110111", "01100100", "01100101",
+	"01101000", "01100111", "011001100", "011001101", "011010010", "011010011", "011010100", "011010101",
+	"011010110", "011010111", "011011000", "011011001", "011011010", "011011011", "010011000", "010011001",
+	"010011010", "011000", "010011011",
+}
+
+// blackRunCodes are the terminating codes of the black runs 0-63, followed by the make-up codes of 64-1728.
+var blackRunCodes = []string{
+	"0000110111", "010", "11", "10", "011", "0011", "0010", "00011",
+	"000101", "000100", "0000100", "0000101", "0000111", "00000100", "00000111", "000011000",
+	"0000010111", "0000011000", "0000001000", "00001100111", "00001101000", "00001101100", "00000110111", "00000101000",
+	"00000010111", "00000011000", "000011001010", "000011001011", "000011001100", "000011001101", "000001101000", "000001101001",
+	"000001101010", "000001101011", "000011010010", "000011010011", "000011010100", "000011010101", "000011010110", "000011010111",
+	"000001101100", "000001101101", "000011011010", "000011011011", "000001010100", "000001010101", "000001010110", "000001010111",
+	"000001100100", "000001100101", "000001010010", "000001010011", "000000100100", "000000110111", "000000111000", "000000100111",
+	"000000101000", "000001011000", "000001011001", "000000101011", "000000101100", "000001011010", "000001100110", "000001100111",
+	"0000001111", "000011001000", "000011001001", "000001011011", "000000110011", "000000110100", "000000110101", "0000001101100",
+	"0000001101101", "0000001001010", "0000001001011", "0000001001100", "0000001001101", "0000001110010", "0000001110011", "0000001110100",
+	"0000001110101", "0000001110110", "0000001110111", "0000001010010", "0000001010011", "0000001010100", "0000001010101", "0000001011010",
+	"0000001011011", "0000001100100", "0000001100101",
+}
+
+// extendedMakeUpCodes are the make-up codes of the runs 1792-2560, of both colors.
+var extendedMakeUpCodes = []string{
+	"00000001000", "00000001100", "00000001101", "000000010010", "000000010011", "000000010100", "000000010101",
+	"000000010110", "000000010111", "000000011100", "000000011101", "000000011110", "000000011111",
+}
+
+const (
+	maxMakeUpRun         = 1728
+	maxExtendedMakeUpRun = 2560
+)
+
+// bitWriter writes bits starting from the most significant bit of each byte.
+type bitWriter struct {
+	buf  []byte
+	bits int
+}
+
+func (w *bitWriter) writeCode(code string) {
+	for _, bit := range code {
+		if w.bits%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if bit == '1' {
+			w.buf[len(w.buf)-1] |= 0x80 >> (w.bits % 8)
+		}
+		w.bits++
+	}
+}
+
+// writeRun writes the make-up codes of the run followed by its terminating code.
+func (w *bitWriter) writeRun(run int, codes []string) {
+	for run > maxExtendedMakeUpRun+63 {
+		w.writeCode(extendedMakeUpCodes[len(extendedMakeUpCodes)-1])
+		run -= maxExtendedMakeUpRun
+	}
+	if run > maxMakeUpRun+63 {
+		w.writeCode(extendedMakeUpCodes[run/64-maxMakeUpRun/64-1])
+		run %= 64
+	} else if run >= 64 {
+		w.writeCode(codes[63+run/64])
+		run %= 64
+	}
+	w.writeCode(codes[run])
+}
+
+// encodeG4 encodes bilevel rows, with 1 for black, using CCITT T.6 (Group 4) compression.
+// Each row is coded relative to the previous one, the first to an imaginary white row.
+func encodeG4(rows [][]byte, width int) []byte {
+	w := &bitWriter{}
+	reference := make([]byte, width)
+	for _, row := range rows {
+		encodeG4Row(w, row, reference)
+		reference = row
+	}
+	// the end of facsimile block
+	w.writeCode(g4EOLCode)
+	w.writeCode(g4EOLCode)
+	return w.buf
+}
+
+// encodeG4Row codes the changing elements of the row with the pass, vertical and horizontal modes.
+func encodeG4Row(w *bitWriter, row []byte, reference []byte) {
+	width := len(row)
+	a0 := 0
+	a1 := nextChange(row, 0, 0)
+	b1 := nextChange(reference, 0, 0)
+	for {
+		b2 := nextChange(reference, b1, colorAt(reference, b1))
+		if b2 < a1 {
+			w.writeCode(g4PassCode)
+			a0 = b2
+		} else if d := a1 - b1; d >= -3 && d <= 3 {
+			w.writeCode(g4VerticalCodes[d+3])
+			a0 = a1
+		} else {
+			a2 := nextChange(row, a1, colorAt(row, a1))
+			w.writeCode(g4HorizontalCode)
+			// the first run of a row is white, even when it's empty
+			if a0+a1 == 0 || row[a0] == 0 {
+				w.writeRun(a1-a0, whiteRunCodes)
+				w.writeRun(a2-a1, blackRunCodes)
+			} else {
+				w.writeRun(a1-a0, blackRunCodes)
+				w.writeRun(a2-a1, whiteRunCodes)
+			}
+			a0 = a2
+		}
+		if a0 >= width {
+			return
+		}
+		color := row[a0]
+		a1 = nextChange(row, a0, color)
+		b1 = nextChange(reference, nextChange(reference, a0, 1-color), color)
+	}
+}
+
+// nextChange returns the position of the first pixel from start that isn't of the color, or the width.
+func nextChange(row []byte, start int, color byte) int {
+	for start < len(row) && row[start] == color {
+		start++
+	}
+	return start
+}
+
+func colorAt(row []byte, i int) byte {
+	if i >= len(row) {
+		return 0
+	}
+	return row[i]
+}
@@ -0,0 +1,373 @@
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/utils"
+	log "github.com/sirupsen/logrus"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var hexColorRegex = regexp.MustCompile(`^#([0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+var namedColors = map[string]color.Color{
+	"white":       color.White,
+	"black":       color.Black,
+	"transparent": color.Transparent,
+}
+
+// ComposeHandler composes page images into one image, or several when it's taller than the max height,
+// e.g. the pages an executable rendered.
+type ComposeHandler struct {
+	definitions.BaseHandler
+	config     *composeConfig
+	background color.Color
+}
+
+type composeConfig struct {
+	// the images to compose
+	pageFilesConfig `mapstructure:",squash"`
+	// Layout is vertical(default), horizontal or grid
+	Layout string `mapstructure:"layout,omitempty"`
+	// Columns are the grid's number of columns
+	Columns int `mapstructure:"columns,omitempty"`
+	// Spacing is the pixels between the images
+	Spacing int `mapstructure:"spacing,omitempty"`
+	// Background is the color around and between the images, e.g. `#ffffff` or `transparent`
+	Background string `mapstructure:"background,omitempty"`
+	// Align is where images smaller than their row or column go: start, center(default) or end
+	Align string `mapstructure:"align,omitempty"`
+	// MaxHeight splits the composed image into images of at most this height, between rows when possible
+	MaxHeight int `mapstructure:"max_height,omitempty"`
+	// OutputFile is where to write the image, the session's contents by default
+	OutputFile   string `mapstructure:"output_file,omitempty"`
+	Format       string `mapstructure:"format,omitempty"`
+	Quality      int    `mapstructure:"quality,omitempty"`
+	rasterConfig `mapstructure:",squash"`
+	RemoveInputs bool `mapstructure:"remove_inputs,omitempty"`
+}
+
+// composition is where each image goes on the canvas.
+type composition struct {
+	size      image.Point
+	positions []image.Point
+	// rows are the rows' vertical ranges, where the composed image is split
+	rows [][2]int
+}
+
+func NewComposeHandler(idPrefix string, c map[string]interface{}) (*ComposeHandler, error) {
+	h := &ComposeHandler{
+		BaseHandler: definitions.BaseHandler{
+			ID: idPrefix + "_compose_images",
+		},
+	}
+	err := h.setConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *ComposeHandler) setConfig(config map[string]interface{}) error {
+	h.config = &composeConfig{
+		Layout:     "vertical",
+		Background: "white",
+		Align:      "center",
+		Quality:    defaultJPEGQuality,
+	}
+	err := h.DecodeMap(config, h.config)
+	if err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+	if !h.config.isSet() {
+		return errors.New("files, files_metadata_key or glob is required")
+	}
+	switch h.config.Layout {
+	case "vertical", "horizontal":
+	case "grid":
+		if h.config.Columns < 1 {
+			return errors.New("columns is required for the grid layout")
+		}
+	default:
+		return fmt.Errorf("unknown layout %s", h.config.Layout)
+	}
+	if h.config.Align != "start" && h.config.Align != "center" && h.config.Align != "end" {
+		return fmt.Errorf("unknown align %s", h.config.Align)
+	}
+	if h.config.Spacing < 0 || h.config.MaxHeight < 0 {
+		return errors.New("spacing and max_height can't be negative")
+	}
+	if h.config.MaxHeight > 0 && h.config.OutputFile == "" {
+		return errors.New("max_height requires output_file, since it can write several images")
+	}
+	h.background, err = parseColor(h.config.Background)
+	if err != nil {
+		return err
+	}
+	options := h.getOptions("")
+	if h.config.Format != "" {
+		options.format, err = parseFormat(h.config.Format)
+		if err != nil {
+			return err
+		}
+	}
+	return validateOptions(options)
+}
+
+// parseColor parses a color name, or a hex color with an optional alpha, e.g. `#ffffff80`.
+func parseColor(s string) (color.Color, error) {
+	if c, ok := namedColors[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+	if !hexColorRegex.MatchString(s) {
+		return nil, fmt.Errorf("invalid color %s, should be a name or #rrggbb[aa]", s)
+	}
+	value, _ := strconv.ParseUint(s[1:], 16, 32)
+	if len(s) == 7 {
+		return color.NRGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 255}, nil
+	}
+	return color.NRGBA{R: uint8(value >> 24), G: uint8(value >> 16), B: uint8(value >> 8), A: uint8(value)}, nil
+}
+
+func (h *ComposeHandler) getOptions(format string) encodeOptions {
+	return encodeOptions{
+		format:     format,
+		quality:    h.config.Quality,
+		colorDepth: h.config.ColorDepth,
+		dpi:        h.config.DPI,
+		dither:     h.config.Dither,
+	}
+}
+
+func (h *ComposeHandler) Name() string {
+	return "ComposeImages"
+}
+
+func (h *ComposeHandler) Outputs() []string {
+	return []string{"OutputFiles", "Width", "Height", "PageCount"}
+}
+
+func (h *ComposeHandler) Destinations() []string {
+	return []string{"OutputFiles"}
+}
+
+func (h *ComposeHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	files, err := h.config.getFiles(info)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errors.New("no images to compose")
+	}
+	output, err := info.EvaluateExpression(h.config.OutputFile)
+	if err != nil {
+		log.WithError(err).Errorf("failed to evaluate output file")
+		return nil, fmt.Errorf("failed to evaluate output file: %w", err)
+	}
+
+	var images []image.Image
+	var inputFormat string
+	for _, file := range files {
+		img, format, err := readImage(file, fileHandler)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+		if inputFormat == "" {
+			inputFormat = format
+		}
+	}
+	format, err := h.getFormat(output, inputFormat)
+	if err != nil {
+		return nil, err
+	}
+	options := h.getOptions(format)
+	err = validateOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	c := h.layout(images)
+	canvas := h.draw(images, c)
+	parts := []image.Rectangle{canvas.Bounds()}
+	if h.config.MaxHeight > 0 {
+		parts = splitRows(c, h.config.MaxHeight)
+	}
+
+	var encoded [][]byte
+	for _, part := range parts {
+		partEncoded, err := encodeImage(canvas.SubImage(part), options)
+		if err != nil {
+			log.WithError(err).Errorf("failed to encode %s", format)
+			return nil, fmt.Errorf("failed to encode %s: %w", format, err)
+		}
+		encoded = append(encoded, partEncoded)
+	}
+	outputFiles := []string{}
+	if h.config.MaxHeight > 0 {
+		// the parts are only written once all of them were encoded, and none are left behind if one can't be written
+		for i := range parts {
+			outputFiles = append(outputFiles, getPartPath(output, i+1))
+		}
+		err = utils.WriteFiles(outputFiles, encoded)
+		if err != nil {
+			log.WithError(err).Errorf("failed to write the parts")
+			return nil, err
+		}
+	} else {
+		err = writeImage(output, fileHandler, encoded[0])
+		if err != nil {
+			return nil, err
+		}
+		if output != "" {
+			outputFiles = append(outputFiles, output)
+		}
+	}
+	log.Debugf("composed %d images into %d", len(images), len(parts))
+
+	if h.config.RemoveInputs {
+		for _, file := range files {
+			err = os.Remove(file)
+			if err != nil {
+				log.WithError(err).Warnf("failed to remove input file %s", file)
+			}
+		}
+	}
+
+	info.Metadata["ComposeImages.OutputFiles"] = outputFiles
+	info.Metadata["ComposeImages.Width"] = c.size.X
+	info.Metadata["ComposeImages.Height"] = c.size.Y
+	info.Metadata["ComposeImages.PageCount"] = len(images)
+	return info, nil
+}
+
+// getFormat returns the configured format, the output file's, or the first input's.
+func (h *ComposeHandler) getFormat(output string, inputFormat string) (string, error) {
+	if h.config.Format != "" {
+		return parseFormat(h.config.Format)
+	}
+	if output != "" {
+		return parseFormat(filepath.Ext(output))
+	}
+	return inputFormat, nil
+}
+
+// layout places the images in a grid, whose columns are as wide as their widest image
+// and rows as tall as their tallest one.
+func (h *ComposeHandler) layout(images []image.Image) composition {
+	columns := h.config.Columns
+	switch h.config.Layout {
+	case "vertical":
+		columns = 1
+	case "horizontal":
+		columns = len(images)
+	}
+	rows := (len(images) + columns - 1) / columns
+	widths := make([]int, columns)
+	heights := make([]int, rows)
+	for i, img := range images {
+		widths[i%columns] = max(widths[i%columns], img.Bounds().Dx())
+		heights[i/columns] = max(heights[i/columns], img.Bounds().Dy())
+	}
+
+	xs := getOffsets(widths, h.config.Spacing)
+	ys := getOffsets(heights, h.config.Spacing)
+	c := composition{
+		size: image.Pt(xs[columns-1]+widths[columns-1], ys[rows-1]+heights[rows-1]),
+	}
+	for r := range heights {
+		c.rows = append(c.rows, [2]int{ys[r], ys[r] + heights[r]})
+	}
+	for i, img := range images {
+		column, row := i%columns, i/columns
+		c.positions = append(c.positions, image.Pt(
+			xs[column]+h.align(widths[column]-img.Bounds().Dx()),
+			ys[row]+h.align(heights[row]-img.Bounds().Dy()),
+		))
+	}
+	return c
+}
+
+func getOffsets(sizes []int, spacing int) []int {
+	offsets := make([]int, len(sizes))
+	for i := 1; i < len(sizes); i++ {
+		offsets[i] = offsets[i-1] + sizes[i-1] + spacing
+	}
+	return offsets
+}
+
+// align returns the offset of an image in a cell with the free space around it.
+func (h *ComposeHandler) align(free int) int {
+	switch h.config.Align {
+	case "start":
+		return 0
+	case "end":
+		return free
+	default:
+		return free / 2
+	}
+}
+
+func (h *ComposeHandler) draw(images []image.Image, c composition) *image.NRGBA {
+	canvas := image.NewNRGBA(image.Rectangle{Max: c.size})
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(h.background), image.Point{}, draw.Src)
+	for i, img := range images {
+		draw.Draw(canvas, img.Bounds().Sub(img.Bounds().Min).Add(c.positions[i]), img, img.Bounds().Min, draw.Over)
+	}
+	return canvas
+}
+
+// splitRows splits the composition into parts of at most maxHeight, after the last row that fits,
+// leaving out the spacing between the parts. Rows taller than maxHeight are cut.
+func splitRows(c composition, maxHeight int) []image.Rectangle {
+	var parts []image.Rectangle
+	start := 0
+	for start < c.size.Y {
+		end, next := start+maxHeight, start+maxHeight
+		if end >= c.size.Y {
+			end, next = c.size.Y, c.size.Y
+		} else {
+			for r, row := range c.rows {
+				if row[1] > start && row[1] <= start+maxHeight && r+1 < len(c.rows) {
+					end, next = row[1], c.rows[r+1][0]
+				}
+			}
+		}
+		parts = append(parts, image.Rect(0, start, c.size.X, end))
+		start = next
+	}
+	return parts
+}
+
+// getPartPath returns the path of a part, e.g. `receipt_2.png` for `receipt.png`.
+func getPartPath(path string, part int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(path, ext), part, ext)
+}
+
+var numberRegex = regexp.MustCompile(`\d+|\D+`)
+
+// naturalLess compares strings with their numbers compared by value.
+func naturalLess(a string, b string) bool {
+	aParts, bParts := numberRegex.FindAllString(a, -1), numberRegex.FindAllString(b, -1)
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		if aParts[i] == bParts[i] {
+			continue
+		}
+		aNumber, aErr := strconv.Atoi(aParts[i])
+		bNumber, bErr := strconv.Atoi(bParts[i])
+		if aErr == nil && bErr == nil && aNumber != bNumber {
+			return aNumber < bNumber
+		}
+		return aParts[i] < bParts[i]
+	}
+	return len(aParts) < len(bParts)
+}
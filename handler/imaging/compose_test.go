@@ -0,0 +1,165 @@
+package imaging
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePage writes a page filled with the color as PNG.
+func writePage(t *testing.T, path string, width int, height int, c color.Color) string {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	assert.NoError(t, os.WriteFile(path, encodePNG(t, img), 0644))
+	return path
+}
+
+func decodeImage(t *testing.T, contents []byte) image.Image {
+	img, _, err := image.Decode(bytes.NewReader(contents))
+	assert.NoError(t, err)
+	return img
+}
+
+func assertColor(t *testing.T, expected color.Color, img image.Image, x int, y int) {
+	assert.Equal(t, color.NRGBAModel.Convert(expected), color.NRGBAModel.Convert(img.At(x, y)), "at %d,%d", x, y)
+}
+
+func TestComposeHandler_Vertical(t *testing.T) {
+	dir := t.TempDir()
+	red := color.RGBA{R: 255, A: 255}
+	blue := color.RGBA{B: 255, A: 255}
+	// the glob's matches are sorted by their numbers
+	writePage(t, filepath.Join(dir, "page10.png"), 20, 10, blue)
+	writePage(t, filepath.Join(dir, "page9.png"), 40, 10, red)
+
+	composed, metadata := handle(t, NewComposeHandler, map[string]interface{}{
+		"glob":       filepath.Join(dir, "page*.png"),
+		"spacing":    2,
+		"background": "#00ff00",
+	}, nil)
+	img := decodeImage(t, composed)
+	assert.Equal(t, 40, metadata["ComposeImages.Width"])
+	assert.Equal(t, 22, metadata["ComposeImages.Height"])
+	assert.Equal(t, 2, metadata["ComposeImages.PageCount"])
+	assert.Equal(t, []string{}, metadata["ComposeImages.OutputFiles"])
+
+	assert.Equal(t, image.Rect(0, 0, 40, 22), img.Bounds())
+	assertColor(t, red, img, 0, 0)
+	assertColor(t, color.RGBA{G: 255, A: 255}, img, 20, 11)
+	// the narrower page is centered
+	assertColor(t, color.RGBA{G: 255, A: 255}, img, 5, 15)
+	assertColor(t, blue, img, 10, 15)
+}
+
+func TestComposeHandler_Grid(t *testing.T) {
+	dir := t.TempDir()
+	colors := []color.Color{color.Black, color.RGBA{R: 255, A: 255}, color.RGBA{G: 255, A: 255}}
+	var files []interface{}
+	for i, c := range colors {
+		files = append(files, writePage(t, filepath.Join(dir, string(rune('a'+i))+".png"), 10, 10, c))
+	}
+	output := filepath.Join(dir, "out", "sheet.jpg")
+
+	_, metadata := handle(t, NewComposeHandler, map[string]interface{}{
+		"files":       files,
+		"layout":      "grid",
+		"columns":     2,
+		"quality":     100,
+		"output_file": output,
+	}, nil)
+	assert.Equal(t, []string{output}, metadata["ComposeImages.OutputFiles"])
+	assert.Equal(t, 20, metadata["ComposeImages.Width"])
+	assert.Equal(t, 20, metadata["ComposeImages.Height"])
+
+	contents, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	img, err := jpeg.Decode(bytes.NewReader(contents))
+	assert.NoError(t, err)
+	r, g, _, _ := img.At(15, 5).RGBA()
+	assert.Greater(t, r>>8, uint32(200))
+	assert.Less(t, g>>8, uint32(50))
+	r, g, _, _ = img.At(5, 15).RGBA()
+	assert.Less(t, r>>8, uint32(50))
+	assert.Greater(t, g>>8, uint32(200))
+	// the empty cell is white
+	r, g, _, _ = img.At(15, 15).RGBA()
+	assert.Greater(t, r>>8, uint32(200))
+	assert.Greater(t, g>>8, uint32(200))
+}
+
+func TestComposeHandler_Horizontal(t *testing.T) {
+	dir := t.TempDir()
+	composed, metadata := handle(t, NewComposeHandler, map[string]interface{}{
+		"files": []interface{}{
+			writePage(t, filepath.Join(dir, "1.png"), 10, 30, color.Black),
+			writePage(t, filepath.Join(dir, "2.png"), 10, 10, color.Black),
+		},
+		"layout":     "horizontal",
+		"align":      "end",
+		"background": "transparent",
+	}, nil)
+	img := decodeImage(t, composed)
+	assert.Equal(t, 20, metadata["ComposeImages.Width"])
+	assert.Equal(t, 30, metadata["ComposeImages.Height"])
+	assertColor(t, color.Transparent, img, 15, 5)
+	assertColor(t, color.Black, img, 15, 25)
+}
+
+func TestComposeHandler_MaxHeight(t *testing.T) {
+	dir := t.TempDir()
+	var files []interface{}
+	for i := 0; i < 3; i++ {
+		files = append(files, writePage(t, filepath.Join(dir, string(rune('a'+i))+".png"), 10, 40, color.Black))
+	}
+	output := filepath.Join(dir, "receipt.png")
+
+	_, metadata := handle(t, NewComposeHandler, map[string]interface{}{
+		"files":       files,
+		"spacing":     5,
+		"max_height":  90,
+		"output_file": output,
+	}, nil)
+	assert.Equal(t, 130, metadata["ComposeImages.Height"])
+	outputs := []string{filepath.Join(dir, "receipt_1.png"), filepath.Join(dir, "receipt_2.png")}
+	assert.Equal(t, outputs, metadata["ComposeImages.OutputFiles"])
+
+	// the first part ends after the second page, and the spacing before the third is left out
+	for i, height := range []int{85, 40} {
+		contents, err := os.ReadFile(outputs[i])
+		assert.NoError(t, err)
+		config, _, err := image.DecodeConfig(bytes.NewReader(contents))
+		assert.NoError(t, err)
+		assert.Equal(t, height, config.Height)
+	}
+}
+
+func TestSplitRows_CutsTallRows(t *testing.T) {
+	c := composition{size: image.Pt(10, 250), rows: [][2]int{{0, 250}}}
+	assert.Equal(t, []image.Rectangle{image.Rect(0, 0, 10, 100), image.Rect(0, 100, 10, 200), image.Rect(0, 200, 10, 250)}, splitRows(c, 100))
+}
+
+func TestComposeHandler_MaxHeightWritesAllPartsOrNone(t *testing.T) {
+	dir := t.TempDir()
+	var files []interface{}
+	for i := 0; i < 2; i++ {
+		files = append(files, writePage(t, filepath.Join(dir, string(rune('a'+i))+".png"), 10, 40, color.Black))
+	}
+	// the second part can't be written over a directory
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "receipt_2.png"), 0755))
+
+	h, err := NewComposeHandler("test", map[string]interface{}{
+		"files":       files,
+		"max_height":  50,
+		"output_file": filepath.Join(dir, "receipt.png"),
+	})
+	assert.NoError(t, err)
+	_, err = h.Handle(newFlowObject(), newFileHandler(nil))
+	assert.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, "receipt_1.png"))
+}
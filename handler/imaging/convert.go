@@ -0,0 +1,141 @@
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+)
+
+// ConvertHandler converts an image between PNG, JPEG, GIF, BMP and TIFF,
+// either the session's contents or a file.
+type ConvertHandler struct {
+	definitions.BaseHandler
+	config *convertConfig
+}
+
+type convertConfig struct {
+	// InputFile is the image to convert, the session's contents by default
+	InputFile string `mapstructure:"input_file,omitempty"`
+	// OutputFile is where to write the converted image, the session's contents by default
+	OutputFile string `mapstructure:"output_file,omitempty"`
+	// Format is the output format, the output file's extension by default
+	Format string `mapstructure:"format,omitempty"`
+	// Quality is the JPEG quality, 1-100
+	Quality        int `mapstructure:"quality,omitempty"`
+	rasterConfig   `mapstructure:",squash"`
+	RemoveOriginal bool `mapstructure:"remove_original,omitempty"`
+}
+
+func NewConvertHandler(idPrefix string, c map[string]interface{}) (*ConvertHandler, error) {
+	h := &ConvertHandler{
+		BaseHandler: definitions.BaseHandler{
+			ID: idPrefix + "_convert_image",
+		},
+	}
+	err := h.setConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *ConvertHandler) setConfig(config map[string]interface{}) error {
+	h.config = &convertConfig{
+		Quality: defaultJPEGQuality,
+	}
+	err := h.DecodeMap(config, h.config)
+	if err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+	if h.config.Format == "" && h.config.OutputFile == "" {
+		return errors.New("format is required when there's no output_file")
+	}
+	if h.config.RemoveOriginal && h.config.InputFile == "" {
+		return errors.New("remove_original requires input_file")
+	}
+	options := h.getOptions("")
+	if h.config.Format != "" {
+		options.format, err = parseFormat(h.config.Format)
+		if err != nil {
+			return err
+		}
+	}
+	return validateOptions(options)
+}
+
+func (h *ConvertHandler) getOptions(format string) encodeOptions {
+	return encodeOptions{
+		format:     format,
+		quality:    h.config.Quality,
+		colorDepth: h.config.ColorDepth,
+		dpi:        h.config.DPI,
+		dither:     h.config.Dither,
+	}
+}
+
+func (h *ConvertHandler) Name() string {
+	return "ConvertImage"
+}
+
+func (h *ConvertHandler) Outputs() []string {
+	return []string{"InputFormat", "Format", "Width", "Height", "OutputFile"}
+}
+
+func (h *ConvertHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	input, err := info.EvaluateExpression(h.config.InputFile)
+	if err != nil {
+		log.WithError(err).Errorf("failed to evaluate input file")
+		return nil, fmt.Errorf("failed to evaluate input file: %w", err)
+	}
+	output, err := info.EvaluateExpression(h.config.OutputFile)
+	if err != nil {
+		log.WithError(err).Errorf("failed to evaluate output file")
+		return nil, fmt.Errorf("failed to evaluate output file: %w", err)
+	}
+	format := h.config.Format
+	if format == "" {
+		format = filepath.Ext(output)
+	}
+	format, err = parseFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	options := h.getOptions(format)
+	err = validateOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	img, inputFormat, err := readImage(input, fileHandler)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := encodeImage(img, options)
+	if err != nil {
+		log.WithError(err).Errorf("failed to encode %s", format)
+		return nil, fmt.Errorf("failed to encode %s: %w", format, err)
+	}
+	err = writeImage(output, fileHandler, encoded)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("converted %s image to %s", inputFormat, format)
+
+	if h.config.RemoveOriginal && input != output {
+		err = os.Remove(input)
+		if err != nil {
+			log.WithError(err).Errorf("failed to remove original file %s", input)
+			return nil, fmt.Errorf("failed to remove original file: %w", err)
+		}
+	}
+
+	info.Metadata["ConvertImage.InputFormat"] = inputFormat
+	info.Metadata["ConvertImage.Format"] = format
+	info.Metadata["ConvertImage.Width"] = img.Bounds().Dx()
+	info.Metadata["ConvertImage.Height"] = img.Bounds().Dy()
+	info.Metadata["ConvertImage.OutputFile"] = output
+	return info, nil
+}
@@ -0,0 +1,242 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// MockEngineFileHandler is a mock implementation of EngineFileHandler for testing
+type MockEngineFileHandler struct {
+	reader io.Reader
+	writer *bytes.Buffer
+}
+
+func (m *MockEngineFileHandler) Read() (io.Reader, error) {
+	return m.reader, nil
+}
+
+func (m *MockEngineFileHandler) Write() (io.Writer, error) {
+	return m.writer, nil
+}
+
+func (m *MockEngineFileHandler) Close() {
+
+}
+
+func newFileHandler(contents []byte) *MockEngineFileHandler {
+	return &MockEngineFileHandler{
+		reader: bytes.NewReader(contents),
+		writer: &bytes.Buffer{},
+	}
+}
+
+func newFlowObject() *definitions.EngineFlowObject {
+	return &definitions.EngineFlowObject{
+		Metadata: map[string]interface{}{},
+	}
+}
+
+// createImage creates a half transparent gradient.
+func createImage(width int, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			alpha := uint8(255)
+			if x < width/2 {
+				alpha = 0
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 255 / width), G: uint8(y * 255 / height), B: 128, A: alpha})
+		}
+	}
+	return img
+}
+
+// handle runs a new handler with the config on the contents, and returns what it wrote and the metadata.
+func handle[H definitions.Handler](t *testing.T, newHandler func(string, map[string]interface{}) (H, error), c map[string]interface{}, contents []byte) ([]byte, map[string]interface{}) {
+	h, err := newHandler("test", c)
+	assert.NoError(t, err)
+	fileHandler := newFileHandler(contents)
+	info, err := h.Handle(newFlowObject(), fileHandler)
+	assert.NoError(t, err)
+	return fileHandler.writer.Bytes(), info.Metadata
+}
+
+// validates returns a function that creates the handler with a config, to test which configs are rejected.
+func validates[H definitions.Handler](newHandler func(string, map[string]interface{}) (H, error)) func(map[string]interface{}) error {
+	return func(c map[string]interface{}) error {
+		_, err := newHandler("test", c)
+		return err
+	}
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	encoded := &bytes.Buffer{}
+	assert.NoError(t, png.Encode(encoded, img))
+	return encoded.Bytes()
+}
+
+func TestConvertHandler_Formats(t *testing.T) {
+	input := encodePNG(t, createImage(40, 20))
+	for _, format := range []string{"png", "jpeg", "gif", "bmp", "tiff"} {
+		t.Run(format, func(t *testing.T) {
+			converted, metadata := handle(t, NewConvertHandler, map[string]interface{}{"format": format}, input)
+			img, decodedFormat, err := image.Decode(bytes.NewReader(converted))
+			assert.NoError(t, err)
+			assert.Equal(t, format, decodedFormat)
+			assert.Equal(t, image.Rect(0, 0, 40, 20), img.Bounds())
+			assert.Equal(t, "png", metadata["ConvertImage.InputFormat"])
+			assert.Equal(t, format, metadata["ConvertImage.Format"])
+			assert.Equal(t, 40, metadata["ConvertImage.Width"])
+			assert.Equal(t, 20, metadata["ConvertImage.Height"])
+		})
+	}
+}
+
+func TestConvertHandler_JPEGFlattensTransparency(t *testing.T) {
+	converted, _ := handle(t, NewConvertHandler, map[string]interface{}{"format": "jpg", "quality": 100}, encodePNG(t, createImage(40, 20)))
+	img, err := jpeg.Decode(bytes.NewReader(converted))
+	assert.NoError(t, err)
+	r, g, b, _ := img.At(2, 2).RGBA()
+	assert.Greater(t, r>>8, uint32(240))
+	assert.Greater(t, g>>8, uint32(240))
+	assert.Greater(t, b>>8, uint32(240))
+}
+
+func TestConvertHandler_ColorDepth(t *testing.T) {
+	input := encodePNG(t, createImage(40, 20))
+
+	converted, _ := handle(t, NewConvertHandler, map[string]interface{}{"format": "png", "color_depth": 1}, input)
+	img, err := png.Decode(bytes.NewReader(converted))
+	assert.NoError(t, err)
+	paletted, ok := img.(*image.Paletted)
+	assert.True(t, ok)
+	assert.Len(t, paletted.Palette, 2)
+
+	converted, _ = handle(t, NewConvertHandler, map[string]interface{}{"format": "tiff", "color_depth": 8}, input)
+	img, err = tiff.Decode(bytes.NewReader(converted))
+	assert.NoError(t, err)
+	assert.Equal(t, color.GrayModel, img.ColorModel())
+
+	converted, _ = handle(t, NewConvertHandler, map[string]interface{}{"format": "gif", "color_depth": 8}, input)
+	img, err = gif.Decode(bytes.NewReader(converted))
+	assert.NoError(t, err)
+	for _, c := range img.(*image.Paletted).Palette {
+		r, g, b, _ := c.RGBA()
+		assert.True(t, r == g && g == b, "the palette should be gray")
+	}
+
+	converted, _ = handle(t, NewConvertHandler, map[string]interface{}{"format": "bmp", "color_depth": 24}, input)
+	img, err = bmp.Decode(bytes.NewReader(converted))
+	assert.NoError(t, err)
+	_, _, _, a := img.At(2, 2).RGBA()
+	assert.Equal(t, uint32(0xffff), a)
+}
+
+func TestConvertHandler_DPI(t *testing.T) {
+	input := encodePNG(t, createImage(4, 4))
+
+	converted, _ := handle(t, NewConvertHandler, map[string]interface{}{"format": "png", "dpi": 300}, input)
+	i := bytes.Index(converted, []byte("pHYs"))
+	assert.Greater(t, i, 0)
+	assert.Equal(t, uint32(11811), binary.BigEndian.Uint32(converted[i+4:]))
+	_, err := png.Decode(bytes.NewReader(converted))
+	assert.NoError(t, err)
+
+	converted, _ = handle(t, NewConvertHandler, map[string]interface{}{"format": "jpeg", "dpi": 300}, input)
+	assert.Equal(t, "JFIF", string(converted[6:10]))
+	assert.Equal(t, uint16(300), binary.BigEndian.Uint16(converted[14:]))
+	_, err = jpeg.Decode(bytes.NewReader(converted))
+	assert.NoError(t, err)
+
+	converted, _ = handle(t, NewConvertHandler, map[string]interface{}{"format": "bmp", "dpi": 300}, input)
+	assert.Equal(t, uint32(11811), binary.LittleEndian.Uint32(converted[38:]))
+
+	converted, _ = handle(t, NewConvertHandler, map[string]interface{}{"format": "tiff", "dpi": 300}, input)
+	_, err = tiff.Decode(bytes.NewReader(converted))
+	assert.NoError(t, err)
+	assert.True(t, bytes.Contains(converted, []byte{44, 1, 0, 0, 1, 0, 0, 0}), "the resolution should be 300/1")
+}
+
+func TestConvertHandler_Files(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "page.png")
+	assert.NoError(t, os.WriteFile(input, encodePNG(t, createImage(10, 10)), 0644))
+
+	h, err := NewConvertHandler("test", map[string]interface{}{
+		"input_file":      input,
+		"output_file":     `${"` + filepath.ToSlash(dir) + `/out/page.jpg"}`,
+		"remove_original": true,
+	})
+	assert.NoError(t, err)
+	fileHandler := newFileHandler(nil)
+	info, err := h.Handle(newFlowObject(), fileHandler)
+	assert.NoError(t, err)
+
+	output := filepath.Join(dir, "out", "page.jpg")
+	assert.Equal(t, filepath.ToSlash(output), filepath.ToSlash(info.Metadata["ConvertImage.OutputFile"].(string)))
+	assert.Equal(t, "jpeg", info.Metadata["ConvertImage.Format"])
+	contents, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	_, err = jpeg.Decode(bytes.NewReader(contents))
+	assert.NoError(t, err)
+	assert.NoFileExists(t, input)
+	assert.Zero(t, fileHandler.writer.Len())
+}
+
+func TestHandlers_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		handler    string
+		newHandler func(map[string]interface{}) error
+		configs    []map[string]interface{}
+	}{
+		{"ConvertImage", validates(NewConvertHandler), []map[string]interface{}{
+			{},
+			{"format": "webp"},
+			{"format": "png", "color_depth": 16},
+			{"format": "jpeg", "quality": 101},
+			{"format": "jpeg", "color_depth": 32},
+			{"format": "png", "remove_original": true},
+		}},
+		{"ImageTransform", validates(NewTransformHandler), []map[string]interface{}{
+			{},
+			{"operations": []interface{}{map[string]interface{}{"type": "blur"}}},
+			{"operations": []interface{}{map[string]interface{}{"type": "resize"}}},
+			{"operations": []interface{}{map[string]interface{}{"type": "rotate", "angle": 45}}},
+			{"operations": []interface{}{map[string]interface{}{"type": "threshold", "level": 300}}},
+			{"operations": []interface{}{map[string]interface{}{"type": "contrast", "amount": -150}}},
+		}},
+		{"AssembleTIFF", validates(NewAssembleTIFFHandler), []map[string]interface{}{
+			{"compression": "jpeg"},
+			{"compression": "g4", "color_depth": 8},
+			{"color_depth": 32},
+			{"dpi": -1},
+			{"remove_inputs": true},
+		}},
+		{"ComposeImages", validates(NewComposeHandler), []map[string]interface{}{
+			{},
+			{"glob": "*.png", "layout": "diagonal"},
+			{"glob": "*.png", "layout": "grid"},
+			{"glob": "*.png", "background": "#fff"},
+			{"glob": "*.png", "align": "middle"},
+			{"glob": "*.png", "max_height": 100},
+		}},
+	}
+	for _, test := range tests {
+		for _, c := range test.configs {
+			assert.Error(t, test.newHandler(c), "%s %v", test.handler, c)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package imaging
+
+import (
+	"fmt"
+	xdraw "golang.org/x/image/draw"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+const (
+	defaultThreshold     = 128
+	defaultTrimTolerance = 10
+)
+
+// operation transforms an image, the result can have bounds that don't start at 0,0.
+type operation func(img image.Image) image.Image
+
+type operationConfig struct {
+	// Type is resize, trim, rotate, grayscale, threshold or contrast
+	Type string `mapstructure:"type"`
+	// Width and Height are the size to fit the image in, keeping its aspect ratio, for resize
+	Width  int `mapstructure:"width,omitempty"`
+	Height int `mapstructure:"height,omitempty"`
+	// Upscale enlarges images smaller than the size, for resize
+	Upscale bool `mapstructure:"upscale,omitempty"`
+	// Margin is how many pixels of the white margins to keep, for trim
+	Margin int `mapstructure:"margin,omitempty"`
+	// Tolerance is how far from white, 0-255, a pixel can be and still count as a margin, for trim
+	Tolerance *int `mapstructure:"tolerance,omitempty"`
+	// Angle is the clockwise rotation, a multiple of 90, for rotate
+	Angle int `mapstructure:"angle,omitempty"`
+	// Level is the gray level, 0-255, below which pixels become black, for threshold
+	Level *int `mapstructure:"level,omitempty"`
+	// Amount is the contrast change in percent, -100-100, for contrast
+	Amount int `mapstructure:"amount,omitempty"`
+}
+
+// newOperation validates the operation's configuration, and returns the operation.
+func newOperation(c operationConfig) (operation, error) {
+	switch c.Type {
+	case "resize":
+		if c.Width < 0 || c.Height < 0 || (c.Width == 0 && c.Height == 0) {
+			return nil, fmt.Errorf("resize requires a positive width or height")
+		}
+		return func(img image.Image) image.Image {
+			return resize(img, c.Width, c.Height, c.Upscale)
+		}, nil
+	case "trim":
+		tolerance := defaultTrimTolerance
+		if c.Tolerance != nil {
+			tolerance = *c.Tolerance
+		}
+		if tolerance < 0 || tolerance > 255 || c.Margin < 0 {
+			return nil, fmt.Errorf("invalid trim tolerance %d or margin %d", tolerance, c.Margin)
+		}
+		return func(img image.Image) image.Image {
+			return trim(img, uint8(tolerance), c.Margin)
+		}, nil
+	case "rotate":
+		angle := (c.Angle%360 + 360) % 360
+		if angle%90 != 0 {
+			return nil, fmt.Errorf("invalid angle %d, should be a multiple of 90", c.Angle)
+		}
+		return func(img image.Image) image.Image {
+			return rotate(img, angle)
+		}, nil
+	case "grayscale":
+		return func(img image.Image) image.Image {
+			return toGray(img)
+		}, nil
+	case "threshold":
+		level := defaultThreshold
+		if c.Level != nil {
+			level = *c.Level
+		}
+		if level < 0 || level > 255 {
+			return nil, fmt.Errorf("invalid threshold level %d, should be 0-255", level)
+		}
+		return func(img image.Image) image.Image {
+			return threshold(img, uint8(level))
+		}, nil
+	case "contrast":
+		if c.Amount < -100 || c.Amount > 100 {
+			return nil, fmt.Errorf("invalid contrast amount %d, should be -100-100", c.Amount)
+		}
+		return func(img image.Image) image.Image {
+			return adjustContrast(img, c.Amount)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown operation type %s", c.Type)
+	}
+}
+
+// resize scales the image to fit the width and height, either can be 0 to fit only the other.
+func resize(img image.Image, width int, height int, upscale bool) image.Image {
+	bounds := img.Bounds()
+	scale := math.Inf(1)
+	if width > 0 {
+		scale = float64(width) / float64(bounds.Dx())
+	}
+	if height > 0 {
+		scale = math.Min(scale, float64(height)/float64(bounds.Dy()))
+	}
+	if scale == 1 || (scale > 1 && !upscale) {
+		return img
+	}
+	size := image.Rect(0, 0, max(1, int(math.Round(float64(bounds.Dx())*scale))), max(1, int(math.Round(float64(bounds.Dy())*scale))))
+	var resized draw.Image
+	if _, ok := img.(*image.Gray); ok {
+		resized = image.NewGray(size)
+	} else {
+		resized = image.NewNRGBA(size)
+	}
+	xdraw.CatmullRom.Scale(resized, size, img, bounds, xdraw.Src, nil)
+	return resized
+}
+
+// trim crops the white or transparent margins, keeping the margin, and leaves blank images as they are.
+func trim(img image.Image, tolerance uint8, margin int) image.Image {
+	bounds := img.Bounds()
+	content := image.Rectangle{}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if isBackground(img.At(x, y), tolerance) {
+				continue
+			}
+			content = content.Union(image.Rect(x, y, x+1, y+1))
+		}
+	}
+	if content.Empty() {
+		return img
+	}
+	content = content.Inset(-margin).Intersect(bounds)
+	if sub, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(content)
+	}
+	cropped := image.NewNRGBA(content)
+	draw.Draw(cropped, content, img, content.Min, draw.Src)
+	return cropped
+}
+
+func isBackground(c color.Color, tolerance uint8) bool {
+	r, g, b, a := c.RGBA()
+	if a == 0 {
+		return true
+	}
+	limit := uint32(0xffff) - 0xffff*uint32(tolerance)/255
+	return a == 0xffff && r >= limit && g >= limit && b >= limit
+}
+
+// rotate rotates the image clockwise by 0, 90, 180 or 270 degrees.
+func rotate(img image.Image, angle int) image.Image {
+	if angle == 0 {
+		return img
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	size := image.Rect(0, 0, width, height)
+	if angle != 180 {
+		size = image.Rect(0, 0, height, width)
+	}
+	rotated := newImageLike(img, size)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := img.At(bounds.Min.X+x, bounds.Min.Y+y)
+			switch angle {
+			case 90:
+				rotated.Set(height-1-y, x, c)
+			case 180:
+				rotated.Set(width-1-x, height-1-y, c)
+			case 270:
+				rotated.Set(y, width-1-x, c)
+			}
+		}
+	}
+	return rotated
+}
+
+// newImageLike returns an empty image of the same color model, for the models that are worth keeping.
+func newImageLike(img image.Image, bounds image.Rectangle) draw.Image {
+	switch img := img.(type) {
+	case *image.Gray:
+		return image.NewGray(bounds)
+	case *image.Paletted:
+		return image.NewPaletted(bounds, img.Palette)
+	default:
+		return image.NewNRGBA(bounds)
+	}
+}
+
+// toGray converts the image to grayscale, over a white background.
+func toGray(img image.Image) *image.Gray {
+	if gray, ok := img.(*image.Gray); ok {
+		return gray
+	}
+	gray := image.NewGray(img.Bounds())
+	draw.Draw(gray, gray.Bounds(), flatten(img), img.Bounds().Min, draw.Src)
+	return gray
+}
+
+// threshold converts the image to black and white.
+func threshold(img image.Image, level uint8) *image.Paletted {
+	gray := toGray(img)
+	bw := image.NewPaletted(gray.Bounds(), blackAndWhite)
+	for y := gray.Bounds().Min.Y; y < gray.Bounds().Max.Y; y++ {
+		for x := gray.Bounds().Min.X; x < gray.Bounds().Max.X; x++ {
+			if gray.GrayAt(x, y).Y >= level {
+				// the palette's index of white
+				bw.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return bw
+}
+
+// adjustContrast scales the colors' distance from the middle gray, keeping grayscale images gray.
+func adjustContrast(img image.Image, amount int) image.Image {
+	if amount == 0 {
+		return img
+	}
+	c := float64(amount) * 2.55
+	factor := 259 * (c + 255) / (255 * (259 - c))
+	var table [256]uint8
+	for i := range table {
+		table[i] = uint8(math.Max(0, math.Min(255, math.Round(factor*(float64(i)-128)+128))))
+	}
+
+	if gray, ok := img.(*image.Gray); ok {
+		adjusted := image.NewGray(gray.Bounds())
+		for y := gray.Bounds().Min.Y; y < gray.Bounds().Max.Y; y++ {
+			for x := gray.Bounds().Min.X; x < gray.Bounds().Max.X; x++ {
+				adjusted.SetGray(x, y, color.Gray{Y: table[gray.GrayAt(x, y).Y]})
+			}
+		}
+		return adjusted
+	}
+	adjusted := image.NewNRGBA(img.Bounds())
+	draw.Draw(adjusted, adjusted.Bounds(), img, img.Bounds().Min, draw.Src)
+	for i := 0; i < len(adjusted.Pix); i += 4 {
+		// the alpha is left as it is
+		adjusted.Pix[i] = table[adjusted.Pix[i]]
+		adjusted.Pix[i+1] = table[adjusted.Pix[i+1]]
+		adjusted.Pix[i+2] = table[adjusted.Pix[i+2]]
+	}
+	return adjusted
+}
@@ -0,0 +1,108 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+)
+
+// The encoders don't write a resolution, or write 72 DPI, so it's set in the encoded image.
+const (
+	pngHeaderLength       = 8
+	pngIHDRLength         = 25
+	bmpXPelsPerMeterIndex = 38
+	tiffXResolution       = 282
+	tiffYResolution       = 283
+	tiffRational          = 5
+	inchesPerMeter        = 39.3701
+)
+
+// setResolution sets the DPI of the encoded image, GIFs don't have one.
+func setResolution(encoded []byte, format string, dpi int) ([]byte, error) {
+	switch format {
+	case "png":
+		return setPNGResolution(encoded, dpi), nil
+	case "jpeg":
+		return setJPEGResolution(encoded, dpi), nil
+	case "bmp":
+		return setBMPResolution(encoded, dpi), nil
+	case "tiff":
+		return setTIFFResolution(encoded, dpi)
+	}
+	return encoded, nil
+}
+
+// setPNGResolution adds a pHYs chunk after the IHDR chunk, which must come first.
+func setPNGResolution(encoded []byte, dpi int) []byte {
+	pixelsPerMeter := uint32(math.Round(float64(dpi) * inchesPerMeter))
+	chunk := &bytes.Buffer{}
+	data := binary.BigEndian.AppendUint32(nil, pixelsPerMeter)
+	data = binary.BigEndian.AppendUint32(data, pixelsPerMeter)
+	// the unit is meters
+	data = append(data, 1)
+	_ = binary.Write(chunk, binary.BigEndian, uint32(len(data)))
+	typeAndData := append([]byte("pHYs"), data...)
+	chunk.Write(typeAndData)
+	_ = binary.Write(chunk, binary.BigEndian, crc32.ChecksumIEEE(typeAndData))
+
+	i := pngHeaderLength + pngIHDRLength
+	return append(append(append([]byte{}, encoded[:i]...), chunk.Bytes()...), encoded[i:]...)
+}
+
+// setJPEGResolution adds a JFIF APP0 segment after the start of image marker, the encoder writes none.
+func setJPEGResolution(encoded []byte, dpi int) []byte {
+	segment := []byte{0xff, 0xe0, 0, 16, 'J', 'F', 'I', 'F', 0, 1, 1, 1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(dpi))
+	segment = binary.BigEndian.AppendUint16(segment, uint16(dpi))
+	// no thumbnail
+	segment = append(segment, 0, 0)
+	return append(append(append([]byte{}, encoded[:2]...), segment...), encoded[2:]...)
+}
+
+// setBMPResolution sets the info header's pixels per meter.
+func setBMPResolution(encoded []byte, dpi int) []byte {
+	pixelsPerMeter := uint32(math.Round(float64(dpi) * inchesPerMeter))
+	binary.LittleEndian.PutUint32(encoded[bmpXPelsPerMeterIndex:], pixelsPerMeter)
+	binary.LittleEndian.PutUint32(encoded[bmpXPelsPerMeterIndex+4:], pixelsPerMeter)
+	return encoded
+}
+
+// setTIFFResolution sets the resolution rationals of the first IFD, in the byte order the encoder used.
+func setTIFFResolution(encoded []byte, dpi int) ([]byte, error) {
+	if len(encoded) < 8 {
+		return nil, errors.New("invalid TIFF")
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if string(encoded[:2]) == "MM" {
+		order = binary.BigEndian
+	}
+	ifd := int(order.Uint32(encoded[4:]))
+	if ifd+2 > len(encoded) {
+		return nil, errors.New("invalid TIFF")
+	}
+	entries := int(order.Uint16(encoded[ifd:]))
+	found := 0
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(encoded) {
+			return nil, errors.New("invalid TIFF")
+		}
+		tag := order.Uint16(encoded[entry:])
+		if (tag != tiffXResolution && tag != tiffYResolution) || order.Uint16(encoded[entry+2:]) != tiffRational {
+			continue
+		}
+		value := int(order.Uint32(encoded[entry+8:]))
+		if value+8 > len(encoded) {
+			return nil, errors.New("invalid TIFF")
+		}
+		order.PutUint32(encoded[value:], uint32(dpi))
+		order.PutUint32(encoded[value+4:], 1)
+		found++
+	}
+	if found != 2 {
+		return nil, errors.New("the TIFF has no resolution")
+	}
+	return encoded, nil
+}
@@ -0,0 +1,249 @@
+package imaging
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"github.com/hhrutter/lzw"
+	"image"
+	"image/color"
+	"io"
+)
+
+// The TIFF tags and values that the multi-page writer uses, from the TIFF 6.0 specification.
+const (
+	tiffNewSubfileType  = 254
+	tiffImageWidth      = 256
+	tiffImageLength     = 257
+	tiffBitsPerSample   = 258
+	tiffCompression     = 259
+	tiffPhotometric     = 262
+	tiffStripOffsets    = 273
+	tiffSamplesPerPixel = 277
+	tiffRowsPerStrip    = 278
+	tiffStripByteCounts = 279
+	tiffT6Options       = 293
+	tiffResolutionUnit  = 296
+	tiffPageNumber      = 297
+
+	tiffShort = 3
+	tiffLong  = 4
+
+	tiffSubfilePage       = 2
+	tiffInch              = 2
+	tiffWhiteIsZero       = 0
+	tiffBlackIsZero       = 1
+	tiffRGB               = 2
+	defaultTIFFResolution = 72
+)
+
+// tiffCompressions are the supported compressions by their names, with their TIFF values.
+var tiffCompressions = map[string]uint32{
+	"none":    1,
+	"g4":      4,
+	"lzw":     5,
+	"deflate": 8,
+}
+
+// tiffPage is a page's pixels, with the rows padded to whole bytes.
+type tiffPage struct {
+	width         int
+	height        int
+	samples       int
+	bitsPerSample int
+	photometric   int
+	pixels        []byte
+	// bilevel are the rows of black and white pages, with 1 for black, for the CCITT compression
+	bilevel [][]byte
+}
+
+type tiffEntry struct {
+	tag      uint16
+	dataType uint16
+	values   []uint32
+}
+
+// newTIFFPage converts the image to the color depth, 1, 8 or 24 bits, or 0 for the one closest to the image's.
+func newTIFFPage(img image.Image, colorDepth int, dither bool) tiffPage {
+	if colorDepth == 0 {
+		colorDepth = getTIFFColorDepth(img)
+	}
+	img = convertColorDepth(img, encodeOptions{colorDepth: colorDepth, dither: dither})
+	bounds := img.Bounds()
+	page := tiffPage{width: bounds.Dx(), height: bounds.Dy(), samples: 1, bitsPerSample: 8}
+	switch colorDepth {
+	case 1:
+		paletted := img.(*image.Paletted)
+		page.bitsPerSample = 1
+		page.photometric = tiffWhiteIsZero
+		stride := (page.width + 7) / 8
+		page.pixels = make([]byte, stride*page.height)
+		for y := 0; y < page.height; y++ {
+			row := make([]byte, page.width)
+			for x := 0; x < page.width; x++ {
+				// the palette's index of black
+				if paletted.ColorIndexAt(bounds.Min.X+x, bounds.Min.Y+y) == 0 {
+					row[x] = 1
+					page.pixels[y*stride+x/8] |= 0x80 >> (x % 8)
+				}
+			}
+			page.bilevel = append(page.bilevel, row)
+		}
+	case 8:
+		gray := img.(*image.Gray)
+		page.photometric = tiffBlackIsZero
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			i := gray.PixOffset(bounds.Min.X, y)
+			page.pixels = append(page.pixels, gray.Pix[i:i+page.width]...)
+		}
+	default:
+		page.samples = 3
+		page.photometric = tiffRGB
+		page.pixels = make([]byte, 0, page.width*page.height*3)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r, g, b, _ := img.At(x, y).RGBA()
+				page.pixels = append(page.pixels, uint8(r>>8), uint8(g>>8), uint8(b>>8))
+			}
+		}
+	}
+	return page
+}
+
+// getTIFFColorDepth returns 1 for black and white images, 8 for grayscale ones and 24 for the rest.
+func getTIFFColorDepth(img image.Image) int {
+	switch img := img.(type) {
+	case *image.Gray:
+		return 8
+	case *image.Paletted:
+		if len(img.Palette) > 2 {
+			return 24
+		}
+		for _, c := range img.Palette {
+			if gray := color.GrayModel.Convert(c).(color.Gray); gray.Y != 0 && gray.Y != 255 {
+				return 24
+			}
+		}
+		return 1
+	}
+	return 24
+}
+
+// compress compresses the page's pixels, G4 only supports black and white pages.
+func (p tiffPage) compress(compression string) ([]byte, error) {
+	switch compression {
+	case "none":
+		return p.pixels, nil
+	case "g4":
+		if p.bitsPerSample != 1 {
+			return nil, fmt.Errorf("g4 compression requires black and white pages")
+		}
+		return encodeG4(p.bilevel, p.width), nil
+	}
+	compressed := &bytes.Buffer{}
+	var writer io.WriteCloser
+	if compression == "lzw" {
+		// TIFF's LZW increases the code length one code early
+		writer = lzw.NewWriter(compressed, true)
+	} else {
+		writer = zlib.NewWriter(compressed)
+	}
+	_, err := writer.Write(p.pixels)
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// encodeMultipageTIFF encodes the pages into a little endian TIFF, with a strip and an IFD per page.
+func encodeMultipageTIFF(pages []tiffPage, compression string, dpi int) ([]byte, error) {
+	if dpi == 0 {
+		dpi = defaultTIFFResolution
+	}
+	encoded := []byte("II*\x00")
+	// the offset of the first IFD
+	next := len(encoded)
+	encoded = binary.LittleEndian.AppendUint32(encoded, 0)
+	for i, page := range pages {
+		strip, err := page.compress(compression)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress page %d: %w", i+1, err)
+		}
+		offset := len(encoded)
+		encoded = append(encoded, strip...)
+		if len(encoded)%2 == 1 {
+			// IFDs start on a word boundary
+			encoded = append(encoded, 0)
+		}
+		binary.LittleEndian.PutUint32(encoded[next:], uint32(len(encoded)))
+
+		bitsPerSample := make([]uint32, page.samples)
+		for s := range bitsPerSample {
+			bitsPerSample[s] = uint32(page.bitsPerSample)
+		}
+		entries := []tiffEntry{
+			{tiffNewSubfileType, tiffLong, []uint32{tiffSubfilePage}},
+			{tiffImageWidth, tiffLong, []uint32{uint32(page.width)}},
+			{tiffImageLength, tiffLong, []uint32{uint32(page.height)}},
+			{tiffBitsPerSample, tiffShort, bitsPerSample},
+			{tiffCompression, tiffShort, []uint32{tiffCompressions[compression]}},
+			{tiffPhotometric, tiffShort, []uint32{uint32(page.photometric)}},
+			{tiffStripOffsets, tiffLong, []uint32{uint32(offset)}},
+			{tiffSamplesPerPixel, tiffShort, []uint32{uint32(page.samples)}},
+			{tiffRowsPerStrip, tiffLong, []uint32{uint32(page.height)}},
+			{tiffStripByteCounts, tiffLong, []uint32{uint32(len(strip))}},
+			{tiffXResolution, tiffRational, []uint32{uint32(dpi), 1}},
+			{tiffYResolution, tiffRational, []uint32{uint32(dpi), 1}},
+		}
+		if compression == "g4" {
+			entries = append(entries, tiffEntry{tiffT6Options, tiffLong, []uint32{0}})
+		}
+		entries = append(entries,
+			tiffEntry{tiffResolutionUnit, tiffShort, []uint32{tiffInch}},
+			tiffEntry{tiffPageNumber, tiffShort, []uint32{uint32(i), uint32(len(pages))}},
+		)
+		encoded, next = appendIFD(encoded, entries)
+	}
+	return encoded, nil
+}
+
+// appendIFD appends the IFD, whose entries are sorted by tag, followed by the values that don't fit in the entries.
+// It returns where the offset of the next IFD goes.
+func appendIFD(encoded []byte, entries []tiffEntry) ([]byte, int) {
+	valuesOffset := len(encoded) + 2 + len(entries)*12 + 4
+	var values []byte
+	encoded = binary.LittleEndian.AppendUint16(encoded, uint16(len(entries)))
+	for _, entry := range entries {
+		var value []byte
+		count := len(entry.values)
+		for _, v := range entry.values {
+			if entry.dataType == tiffShort {
+				value = binary.LittleEndian.AppendUint16(value, uint16(v))
+			} else {
+				value = binary.LittleEndian.AppendUint32(value, v)
+			}
+		}
+		if entry.dataType == tiffRational {
+			// a rational is a numerator and a denominator
+			count /= 2
+		}
+		encoded = binary.LittleEndian.AppendUint16(encoded, entry.tag)
+		encoded = binary.LittleEndian.AppendUint16(encoded, entry.dataType)
+		encoded = binary.LittleEndian.AppendUint32(encoded, uint32(count))
+		if len(value) <= 4 {
+			encoded = append(encoded, value...)
+			encoded = append(encoded, make([]byte, 4-len(value))...)
+			continue
+		}
+		encoded = binary.LittleEndian.AppendUint32(encoded, uint32(valuesOffset+len(values)))
+		values = append(values, value...)
+	}
+	next := len(encoded)
+	encoded = binary.LittleEndian.AppendUint32(encoded, 0)
+	return append(encoded, values...), next
+}
@@ -0,0 +1,136 @@
+package imaging
+
+import (
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/utils"
+	log "github.com/sirupsen/logrus"
+	"image"
+)
+
+// TransformHandler applies a chain of operations, e.g. resizing and thresholding, to the session's image,
+// or to each of the files, e.g. the pages rendered by an executable.
+type TransformHandler struct {
+	definitions.BaseHandler
+	config     *transformConfig
+	operations []operation
+}
+
+type transformConfig struct {
+	Operations []operationConfig `mapstructure:"operations"`
+	// the images to transform in place, instead of the session's contents
+	utils.FilesConfig `mapstructure:",squash"`
+	// Quality is the JPEG quality, 1-100, the images keep their format
+	Quality int `mapstructure:"quality,omitempty"`
+	// DPI is the resolution to write into the images
+	DPI int `mapstructure:"dpi,omitempty"`
+}
+
+func NewTransformHandler(idPrefix string, c map[string]interface{}) (*TransformHandler, error) {
+	h := &TransformHandler{
+		BaseHandler: definitions.BaseHandler{
+			ID: idPrefix + "_image_transform",
+		},
+	}
+	err := h.setConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *TransformHandler) setConfig(config map[string]interface{}) error {
+	h.config = &transformConfig{
+		Quality: defaultJPEGQuality,
+	}
+	err := h.DecodeMap(config, h.config)
+	if err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+	if len(h.config.Operations) == 0 {
+		return errors.New("operations are required")
+	}
+	for i, c := range h.config.Operations {
+		o, err := newOperation(c)
+		if err != nil {
+			return fmt.Errorf("invalid operation %d: %w", i+1, err)
+		}
+		h.operations = append(h.operations, o)
+	}
+	return validateOptions(h.getOptions(""))
+}
+
+func (h *TransformHandler) getOptions(format string) encodeOptions {
+	return encodeOptions{
+		format:  format,
+		quality: h.config.Quality,
+		dpi:     h.config.DPI,
+	}
+}
+
+func (h *TransformHandler) Name() string {
+	return "ImageTransform"
+}
+
+func (h *TransformHandler) Outputs() []string {
+	return []string{"Width", "Height", "Files"}
+}
+
+func (h *TransformHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	files, err := h.config.GetFiles(info.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	usesFiles := h.config.IsSet()
+	if !usesFiles {
+		// the session's contents are transformed like a file without a path
+		files = []string{""}
+	}
+
+	// the files are transformed in place, so they're only written once all of them were transformed,
+	// which keeps them as they were for a retry when one of them fails
+	var transformed [][]byte
+	var size image.Point
+	for _, file := range files {
+		var encoded []byte
+		encoded, size, err = h.transform(file, fileHandler)
+		if err != nil {
+			return nil, err
+		}
+		transformed = append(transformed, encoded)
+	}
+	for i, file := range files {
+		err = writeImage(file, fileHandler, transformed[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	log.Debugf("transformed %d images", len(files))
+
+	if !usesFiles {
+		files = []string{}
+	}
+	// the size of the last image, which is the only one when transforming the session's contents
+	info.Metadata["ImageTransform.Width"] = size.X
+	info.Metadata["ImageTransform.Height"] = size.Y
+	info.Metadata["ImageTransform.Files"] = files
+	return info, nil
+}
+
+// transform transforms the file, or the session's contents when path is empty, and returns it encoded and its new size.
+func (h *TransformHandler) transform(path string, fileHandler definitions.EngineFileHandler) ([]byte, image.Point, error) {
+	img, format, err := readImage(path, fileHandler)
+	if err != nil {
+		return nil, image.Point{}, err
+	}
+	for _, o := range h.operations {
+		img = o(img)
+	}
+	encoded, err := encodeImage(img, h.getOptions(format))
+	if err != nil {
+		log.WithError(err).Errorf("failed to encode %s", format)
+		return nil, image.Point{}, fmt.Errorf("failed to encode %s: %w", format, err)
+	}
+	return encoded, img.Bounds().Size(), nil
+}
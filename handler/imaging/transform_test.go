@@ -0,0 +1,143 @@
+package imaging
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// createReceipt creates a white image with a gray block of text at 20,10-60,30.
+func createReceipt(width int, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(20, 10, 60, 30), image.NewUniform(color.Gray{Y: 100}), image.Point{}, draw.Src)
+	return img
+}
+
+func TestTransformHandler_Chain(t *testing.T) {
+	transformed, metadata := handle(t, NewTransformHandler, map[string]interface{}{
+		"operations": []interface{}{
+			map[string]interface{}{"type": "trim", "margin": 5},
+			map[string]interface{}{"type": "grayscale"},
+			map[string]interface{}{"type": "resize", "width": 25},
+			map[string]interface{}{"type": "threshold", "level": 200},
+		},
+	}, encodePNG(t, createReceipt(200, 100)))
+	assert.Equal(t, 25, metadata["ImageTransform.Width"])
+	assert.Equal(t, 15, metadata["ImageTransform.Height"])
+	assert.Equal(t, []string{}, metadata["ImageTransform.Files"])
+
+	img, err := png.Decode(bytes.NewReader(transformed))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 25, 15), img.Bounds())
+	paletted, ok := img.(*image.Paletted)
+	assert.True(t, ok)
+	assert.Equal(t, color.RGBA{A: 255}, color.RGBAModel.Convert(paletted.At(12, 7)))
+	assert.Equal(t, color.RGBA{R: 255, G: 255, B: 255, A: 255}, color.RGBAModel.Convert(paletted.At(0, 0)))
+}
+
+func TestTransformHandler_Rotate(t *testing.T) {
+	transformed, metadata := handle(t, NewTransformHandler, map[string]interface{}{
+		"operations": []interface{}{map[string]interface{}{"type": "rotate", "angle": 90}},
+	}, encodePNG(t, createReceipt(80, 40)))
+	assert.Equal(t, 40, metadata["ImageTransform.Width"])
+	assert.Equal(t, 80, metadata["ImageTransform.Height"])
+
+	img, err := png.Decode(bytes.NewReader(transformed))
+	assert.NoError(t, err)
+	// the block's top left corner at 20,10 is now at its top right
+	r, _, _, _ := img.At(40-1-10, 20).RGBA()
+	assert.Equal(t, uint32(100), r>>8)
+	r, _, _, _ = img.At(40-1-10, 19).RGBA()
+	assert.Equal(t, uint32(255), r>>8)
+}
+
+func TestTransformHandler_Contrast(t *testing.T) {
+	transformed, _ := handle(t, NewTransformHandler, map[string]interface{}{
+		"operations": []interface{}{
+			map[string]interface{}{"type": "grayscale"},
+			map[string]interface{}{"type": "contrast", "amount": 50},
+		},
+	}, encodePNG(t, createReceipt(80, 40)))
+	img, err := png.Decode(bytes.NewReader(transformed))
+	assert.NoError(t, err)
+	assert.Equal(t, color.GrayModel, img.ColorModel())
+	assert.Less(t, img.(*image.Gray).GrayAt(30, 20).Y, uint8(100))
+}
+
+func TestTransformHandler_Files(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for i := 1; i <= 2; i++ {
+		file := filepath.Join(dir, "page"+string(rune('0'+i))+".jpg")
+		encoded := &bytes.Buffer{}
+		assert.NoError(t, jpeg.Encode(encoded, createReceipt(200, 100), nil))
+		assert.NoError(t, os.WriteFile(file, encoded.Bytes(), 0644))
+		files = append(files, file)
+	}
+
+	h, err := NewTransformHandler("test", map[string]interface{}{
+		"operations":         []interface{}{map[string]interface{}{"type": "resize", "height": 50}},
+		"files_metadata_key": "PDFSplit.Files",
+	})
+	assert.NoError(t, err)
+	info := newFlowObject()
+	info.Metadata["PDFSplit.Files"] = files
+	fileHandler := newFileHandler(nil)
+	info, err = h.Handle(info, fileHandler)
+	assert.NoError(t, err)
+	assert.Equal(t, files, info.Metadata["ImageTransform.Files"])
+	assert.Zero(t, fileHandler.writer.Len())
+
+	for _, file := range files {
+		contents, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		config, format, err := image.DecodeConfig(bytes.NewReader(contents))
+		assert.NoError(t, err)
+		assert.Equal(t, "jpeg", format)
+		assert.Equal(t, 100, config.Width)
+		assert.Equal(t, 50, config.Height)
+	}
+}
+
+func TestTransformHandler_FilesAreWrittenOnlyWhenAllAreTransformed(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "page1.png")
+	original := encodePNG(t, createReceipt(200, 100))
+	assert.NoError(t, os.WriteFile(first, original, 0644))
+	second := filepath.Join(dir, "page2.png")
+	assert.NoError(t, os.WriteFile(second, []byte("not an image"), 0644))
+
+	h, err := NewTransformHandler("test", map[string]interface{}{
+		"operations": []interface{}{map[string]interface{}{"type": "resize", "height": 50}},
+		"files":      []string{first, second},
+	})
+	assert.NoError(t, err)
+	_, err = h.Handle(newFlowObject(), newFileHandler(nil))
+	assert.Error(t, err)
+
+	// a retry transforms the first page again, so it must be left as it was
+	contents, err := os.ReadFile(first)
+	assert.NoError(t, err)
+	assert.Equal(t, original, contents)
+}
+
+func TestTransformHandler_NoUpscale(t *testing.T) {
+	_, metadata := handle(t, NewTransformHandler, map[string]interface{}{
+		"operations": []interface{}{map[string]interface{}{"type": "resize", "width": 400}},
+	}, encodePNG(t, createReceipt(80, 40)))
+	assert.Equal(t, 80, metadata["ImageTransform.Width"])
+
+	_, metadata = handle(t, NewTransformHandler, map[string]interface{}{
+		"operations": []interface{}{map[string]interface{}{"type": "resize", "width": 400, "upscale": true}},
+	}, encodePNG(t, createReceipt(80, 40)))
+	assert.Equal(t, 400, metadata["ImageTransform.Width"])
+	assert.Equal(t, 200, metadata["ImageTransform.Height"])
+}
@@ -46,6 +46,10 @@ func (h *MergePNGsHandler) Name() string {
 	return "MergePNGs"
 }
 
+func (h *MergePNGsHandler) Outputs() []string {
+	return []string{"OutputFile"}
+}
+
 func (h *MergePNGsHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
 	numPages := info.Pages
 
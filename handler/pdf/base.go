@@ -0,0 +1,94 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"strings"
+)
+
+func newConfiguration() *model.Configuration {
+	conf := model.NewDefaultConfiguration()
+	// printed PDFs aren't always strictly valid
+	conf.ValidationMode = model.ValidationRelaxed
+	return conf
+}
+
+// readDocument reads the session's PDF, which pdfcpu needs to seek.
+func readDocument(fileHandler definitions.EngineFileHandler) (*bytes.Reader, error) {
+	reader, err := fileHandler.Read()
+	if err != nil {
+		log.WithError(err).Errorf("failed to read file")
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		log.WithError(err).Errorf("failed to read file")
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return bytes.NewReader(contents), nil
+}
+
+// writeDocument replaces the session's contents with the PDF, and returns its page count.
+func writeDocument(fileHandler definitions.EngineFileHandler, document []byte) (int, error) {
+	pages, err := api.PageCount(bytes.NewReader(document), newConfiguration())
+	if err != nil {
+		log.WithError(err).Errorf("failed to count pages")
+		return 0, fmt.Errorf("failed to count pages: %w", err)
+	}
+	return pages, writeContents(fileHandler, document)
+}
+
+// writeContents replaces the session's contents, for PDFs that can't be read without a password.
+func writeContents(fileHandler definitions.EngineFileHandler, contents []byte) error {
+	writer, err := fileHandler.Write()
+	if err != nil {
+		log.WithError(err).Errorf("failed to write file")
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	_, err = writer.Write(contents)
+	if err != nil {
+		log.WithError(err).Errorf("failed to write file")
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
+
+// evaluatePassword evaluates a password, or reads it from a file when passwordFile is set,
+// so passwords can be kept out of the configuration, e.g. in a mounted secret.
+func evaluatePassword(info *definitions.EngineFlowObject, password string, passwordFile string) (string, error) {
+	if passwordFile == "" {
+		return info.EvaluateExpression(password)
+	}
+	path, err := info.EvaluateExpression(passwordFile)
+	if err != nil {
+		return "", err
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(contents), "\r\n"), nil
+}
+
+// evaluatePages evaluates a pdfcpu page selection, e.g. `1-3,5,even`, into its parts.
+func evaluatePages(info *definitions.EngineFlowObject, pages string) ([]string, error) {
+	pages, err := info.EvaluateExpression(pages)
+	if err != nil {
+		log.WithError(err).Errorf("failed to evaluate pages")
+		return nil, fmt.Errorf("failed to evaluate pages: %w", err)
+	}
+	var selection []string
+	for _, part := range strings.Split(pages, ",") {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			selection = append(selection, part)
+		}
+	}
+	return selection, nil
+}
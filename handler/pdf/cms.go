@@ -0,0 +1,197 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"sort"
+)
+
+// The CMS is built here instead of with pkcs7, since pkcs7 always adds the signing-time attribute,
+// which PAdES baseline signatures must not have; the signing time is in the signature dictionary.
+var (
+	oidData                   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningCertificateV2   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+	oidSHA256                 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256        = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	errUnsupportedSigningKeys = errors.New("only RSA and ECDSA keys are supported")
+)
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	// Content is tagged explicitly, which marshalling a RawValue doesn't do
+	Content asn1.RawValue
+}
+
+type encapsulatedContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      encapsulatedContentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      []signerInfo `asn1:"set"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version            int
+	SID                issuerAndSerialNumber
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttributes   asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+type attributeValue struct {
+	oid   asn1.ObjectIdentifier
+	value interface{}
+}
+
+type essCertIDv2 struct {
+	// the hash algorithm is left out, since SHA-256 is its default
+	CertHash     []byte
+	IssuerSerial issuerSerial
+}
+
+type issuerSerial struct {
+	Issuer       []asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// createCMS creates a detached CAdES signature of the content, as PAdES-B-B requires.
+func createCMS(content []byte, certificate *x509.Certificate, chain []*x509.Certificate, key crypto.Signer) ([]byte, error) {
+	signatureAlgorithm, err := getSignatureAlgorithm(key)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(content)
+	certHash := sha256.Sum256(certificate.Raw)
+
+	signingCertificate, err := asn1.Marshal(signingCertificateV2{Certs: []essCertIDv2{{
+		CertHash: certHash[:],
+		IssuerSerial: issuerSerial{
+			// a GeneralName of the directoryName choice
+			Issuer:       []asn1.RawValue{{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true, Bytes: certificate.RawIssuer}},
+			SerialNumber: certificate.SerialNumber,
+		},
+	}}})
+	if err != nil {
+		return nil, err
+	}
+	attributes, err := marshalAttributes([]attributeValue{
+		{oid: oidContentType, value: oidData},
+		{oid: oidMessageDigest, value: digest[:]},
+		{oid: oidSigningCertificateV2, value: asn1.RawValue{FullBytes: signingCertificate}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the signature is over the attributes' DER encoding as a SET, and they're stored tagged implicitly
+	attributesDigest := sha256.Sum256(attributes)
+	signature, err := key.Sign(rand.Reader, attributesDigest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+	signedAttributes := asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attributes[getHeaderLength(attributes):]}
+
+	var certificates []byte
+	for _, c := range append([]*x509.Certificate{certificate}, chain...) {
+		certificates = append(certificates, c.Raw...)
+	}
+	data, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		ContentInfo:      encapsulatedContentInfo{ContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certificates},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			SID: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: certificate.RawIssuer},
+				SerialNumber: certificate.SerialNumber,
+			},
+			DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			SignedAttributes:   signedAttributes,
+			SignatureAlgorithm: signatureAlgorithm,
+			Signature:          signature,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: data},
+	})
+}
+
+func getSignatureAlgorithm(key crypto.Signer) (pkix.AlgorithmIdentifier, error) {
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}, nil
+	case *ecdsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}, nil
+	default:
+		return pkix.AlgorithmIdentifier{}, errUnsupportedSigningKeys
+	}
+}
+
+// marshalAttributes returns the DER encoding of the attributes as a SET, which DER requires to be sorted.
+func marshalAttributes(values []attributeValue) ([]byte, error) {
+	var encoded [][]byte
+	for _, v := range values {
+		valueBytes, err := asn1.Marshal(v.value)
+		if err != nil {
+			return nil, err
+		}
+		a := attribute{
+			Type:   v.oid,
+			Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: valueBytes},
+		}
+		b, err := asn1.Marshal(a)
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, b)
+	}
+	sort.Slice(encoded, func(i, j int) bool {
+		return bytes.Compare(encoded[i], encoded[j]) < 0
+	})
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: bytes.Join(encoded, nil)})
+}
+
+// getHeaderLength returns the length of a DER element's tag and length.
+func getHeaderLength(element []byte) int {
+	if element[1] < 0x80 {
+		return 2
+	}
+	return 2 + int(element[1]&0x7f)
+}
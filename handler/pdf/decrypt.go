@@ -0,0 +1,105 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	log "github.com/sirupsen/logrus"
+	"io"
+)
+
+// DecryptHandler removes the encryption of the session's PDF. Unencrypted PDFs are passed through.
+type DecryptHandler struct {
+	definitions.BaseHandler
+	config *decryptConfig
+}
+
+type decryptConfig struct {
+	// Password is the user or the owner password, whichever is known
+	Password     string `mapstructure:"password,omitempty"`
+	PasswordFile string `mapstructure:"password_file,omitempty"`
+}
+
+func NewDecryptHandler(idPrefix string, c map[string]interface{}) (*DecryptHandler, error) {
+	h := &DecryptHandler{
+		BaseHandler: definitions.BaseHandler{
+			ID: idPrefix + "_pdf_decrypt",
+		},
+	}
+	err := h.setConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *DecryptHandler) setConfig(config map[string]interface{}) error {
+	h.config = &decryptConfig{}
+	err := h.DecodeMap(config, h.config)
+	if err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+	if h.config.Password != "" && h.config.PasswordFile != "" {
+		return errors.New("password and password_file can't be used together")
+	}
+	return nil
+}
+
+func (h *DecryptHandler) Name() string {
+	return "PDFDecrypt"
+}
+
+func (h *DecryptHandler) Outputs() []string {
+	return []string{"Decrypted", "PageCount"}
+}
+
+func (h *DecryptHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	password, err := evaluatePassword(info, h.config.Password, h.config.PasswordFile)
+	if err != nil {
+		log.WithError(err).Errorf("failed to get password")
+		return nil, fmt.Errorf("failed to get password: %w", err)
+	}
+	document, err := readDocument(fileHandler)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := newConfiguration()
+	conf.UserPW = password
+	conf.OwnerPW = password
+	ctx, err := api.ReadContext(document, conf)
+	if err != nil {
+		log.WithError(err).Errorf("failed to read PDF")
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	decrypted := ctx.E != nil
+	contents := &bytes.Buffer{}
+	_, err = document.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if decrypted {
+		err = api.Decrypt(document, contents, conf)
+		if err != nil {
+			log.WithError(err).Errorf("failed to decrypt PDF")
+			return nil, fmt.Errorf("failed to decrypt PDF: %w", err)
+		}
+	} else {
+		log.Debugf("PDF isn't encrypted, passing it through")
+		_, err = io.Copy(contents, document)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+	}
+	pageCount, err := writeDocument(fileHandler, contents.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	info.Metadata["PDFDecrypt.Decrypted"] = decrypted
+	info.Metadata["PDFDecrypt.PageCount"] = pageCount
+	return info, nil
+}
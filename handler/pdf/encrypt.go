@@ -0,0 +1,145 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	log "github.com/sirupsen/logrus"
+	"io"
+)
+
+// EncryptHandler encrypts the session's PDF with AES-256.
+type EncryptHandler struct {
+	definitions.BaseHandler
+	config *encryptConfig
+}
+
+type encryptConfig struct {
+	// UserPassword is needed to open the document, anyone can open it if it's empty
+	UserPassword     string `mapstructure:"user_password,omitempty"`
+	UserPasswordFile string `mapstructure:"user_password_file,omitempty"`
+	// OwnerPassword is needed to change the document or its permissions
+	OwnerPassword     string `mapstructure:"owner_password,omitempty"`
+	OwnerPasswordFile string `mapstructure:"owner_password_file,omitempty"`
+	AllowPrint        bool   `mapstructure:"allow_print,omitempty"`
+	AllowCopy         bool   `mapstructure:"allow_copy,omitempty"`
+	AllowModify       bool   `mapstructure:"allow_modify,omitempty"`
+}
+
+func NewEncryptHandler(idPrefix string, c map[string]interface{}) (*EncryptHandler, error) {
+	h := &EncryptHandler{
+		BaseHandler: definitions.BaseHandler{
+			ID: idPrefix + "_pdf_encrypt",
+		},
+	}
+	err := h.setConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *EncryptHandler) setConfig(config map[string]interface{}) error {
+	h.config = &encryptConfig{}
+	err := h.DecodeMap(config, h.config)
+	if err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+	if h.config.OwnerPassword == "" && h.config.OwnerPasswordFile == "" {
+		return errors.New("owner_password or owner_password_file is required")
+	}
+	if h.config.OwnerPassword != "" && h.config.OwnerPasswordFile != "" {
+		return errors.New("owner_password and owner_password_file can't be used together")
+	}
+	if h.config.UserPassword != "" && h.config.UserPasswordFile != "" {
+		return errors.New("user_password and user_password_file can't be used together")
+	}
+	return nil
+}
+
+func (h *EncryptHandler) Name() string {
+	return "PDFEncrypt"
+}
+
+func (h *EncryptHandler) Outputs() []string {
+	return []string{"PageCount", "Permissions"}
+}
+
+func (h *EncryptHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	userPassword, err := evaluatePassword(info, h.config.UserPassword, h.config.UserPasswordFile)
+	if err != nil {
+		log.WithError(err).Errorf("failed to get user password")
+		return nil, fmt.Errorf("failed to get user password: %w", err)
+	}
+	ownerPassword, err := evaluatePassword(info, h.config.OwnerPassword, h.config.OwnerPasswordFile)
+	if err != nil {
+		log.WithError(err).Errorf("failed to get owner password")
+		return nil, fmt.Errorf("failed to get owner password: %w", err)
+	}
+	if ownerPassword == "" {
+		return nil, errors.New("owner password is empty")
+	}
+	document, err := readDocument(fileHandler)
+	if err != nil {
+		return nil, err
+	}
+	// the encrypted document can't be read without the user password, so the pages are counted before
+	pageCount, err := api.PageCount(document, newConfiguration())
+	if err != nil {
+		log.WithError(err).Errorf("failed to count pages")
+		return nil, fmt.Errorf("failed to count pages: %w", err)
+	}
+
+	conf := model.NewAESConfiguration(userPassword, ownerPassword, 256)
+	conf.ValidationMode = model.ValidationRelaxed
+	conf.Permissions = h.getPermissions()
+	output := &bytes.Buffer{}
+	_, err = document.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	err = api.Encrypt(document, output, conf)
+	if err != nil {
+		log.WithError(err).Errorf("failed to encrypt PDF")
+		return nil, fmt.Errorf("failed to encrypt PDF: %w", err)
+	}
+	err = writeContents(fileHandler, output.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	info.Metadata["PDFEncrypt.PageCount"] = pageCount
+	info.Metadata["PDFEncrypt.Permissions"] = h.getPermissionNames()
+	return info, nil
+}
+
+func (h *EncryptHandler) getPermissions() model.PermissionFlags {
+	permissions := model.PermissionsNone
+	if h.config.AllowPrint {
+		permissions |= model.PermissionPrintRev2 | model.PermissionPrintRev3
+	}
+	if h.config.AllowCopy {
+		permissions |= model.PermissionExtract | model.PermissionExtractRev3
+	}
+	if h.config.AllowModify {
+		permissions |= model.PermissionModify | model.PermissionModAnnFillForm | model.PermissionFillRev3 | model.PermissionAssembleRev3
+	}
+	return permissions
+}
+
+func (h *EncryptHandler) getPermissionNames() []string {
+	permissions := []string{}
+	if h.config.AllowPrint {
+		permissions = append(permissions, "print")
+	}
+	if h.config.AllowCopy {
+		permissions = append(permissions, "copy")
+	}
+	if h.config.AllowModify {
+		permissions = append(permissions, "modify")
+	}
+	return permissions
+}
@@ -0,0 +1,65 @@
+package pdf
+
+import (
+	"bytes"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptHandler(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "owner")
+	assert.NoError(t, os.WriteFile(passwordFile, []byte("owner-secret\n"), 0600))
+
+	encrypted, metadata := handle(t, NewEncryptHandler, map[string]interface{}{
+		"user_password":       `${$env["Job.User"]}-pw`,
+		"owner_password_file": passwordFile,
+		"allow_print":         true,
+	}, createPDF(t, 2))
+	assert.Equal(t, 2, metadata["PDFEncrypt.PageCount"])
+	assert.Equal(t, []string{"print"}, metadata["PDFEncrypt.Permissions"])
+
+	_, err := api.PageCount(bytes.NewReader(encrypted), newConfiguration())
+	assert.Error(t, err)
+
+	conf := newConfiguration()
+	conf.UserPW = "alice-pw"
+	conf.OwnerPW = "owner-secret"
+	permissions, err := api.GetPermissions(bytes.NewReader(encrypted), conf)
+	assert.NoError(t, err)
+	assert.NotZero(t, model.PermissionFlags(*permissions)&model.PermissionPrintRev3)
+	assert.Zero(t, model.PermissionFlags(*permissions)&model.PermissionExtract)
+}
+
+func TestDecryptHandler(t *testing.T) {
+	encrypted, _ := handle(t, NewEncryptHandler, map[string]interface{}{"user_password": "user-pw", "owner_password": "owner-pw"}, createPDF(t, 3))
+
+	h, err := NewDecryptHandler("test", map[string]interface{}{"password": "user-pw"})
+	assert.NoError(t, err)
+	fileHandler := newFileHandler(encrypted)
+	info, err := h.Handle(newFlowObject(), fileHandler)
+	assert.NoError(t, err)
+	assert.Equal(t, true, info.Metadata["PDFDecrypt.Decrypted"])
+	assert.Equal(t, 3, info.Metadata["PDFDecrypt.PageCount"])
+	assert.Equal(t, 3, pageCount(t, fileHandler.writer.Bytes()))
+
+	h, err = NewDecryptHandler("test", map[string]interface{}{"password": "wrong"})
+	assert.NoError(t, err)
+	_, err = h.Handle(newFlowObject(), newFileHandler(encrypted))
+	assert.Error(t, err)
+}
+
+func TestDecryptHandler_Unencrypted(t *testing.T) {
+	h, err := NewDecryptHandler("test", map[string]interface{}{"password": "pw"})
+	assert.NoError(t, err)
+
+	document := createPDF(t, 1)
+	fileHandler := newFileHandler(document)
+	info, err := h.Handle(newFlowObject(), fileHandler)
+	assert.NoError(t, err)
+	assert.Equal(t, false, info.Metadata["PDFDecrypt.Decrypted"])
+	assert.Equal(t, document, fileHandler.writer.Bytes())
+}
@@ -0,0 +1,80 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// ExtractPagesHandler replaces the session's PDF with the selected pages.
+type ExtractPagesHandler struct {
+	definitions.BaseHandler
+	config *extractPagesConfig
+}
+
+type extractPagesConfig struct {
+	// Pages is a pdfcpu page selection, e.g. `1-3,5` or `odd`
+	Pages string `mapstructure:"pages"`
+}
+
+func NewExtractPagesHandler(idPrefix string, c map[string]interface{}) (*ExtractPagesHandler, error) {
+	h := &ExtractPagesHandler{
+		BaseHandler: definitions.BaseHandler{
+			ID: idPrefix + "_pdf_extract_pages",
+		},
+	}
+	err := h.setConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *ExtractPagesHandler) setConfig(config map[string]interface{}) error {
+	h.config = &extractPagesConfig{}
+	err := h.DecodeMap(config, h.config)
+	if err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+	if h.config.Pages == "" {
+		return errors.New("pages is required")
+	}
+	return nil
+}
+
+func (h *ExtractPagesHandler) Name() string {
+	return "PDFExtractPages"
+}
+
+func (h *ExtractPagesHandler) Outputs() []string {
+	return []string{"PageCount"}
+}
+
+func (h *ExtractPagesHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	pages, err := evaluatePages(info, h.config.Pages)
+	if err != nil {
+		return nil, err
+	}
+	document, err := readDocument(fileHandler)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &bytes.Buffer{}
+	err = api.Trim(document, output, pages, newConfiguration())
+	if err != nil {
+		log.WithError(err).Errorf("failed to extract pages %v", pages)
+		return nil, fmt.Errorf("failed to extract pages: %w", err)
+	}
+	pageCount, err := writeDocument(fileHandler, output.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	info.Pages = pageCount
+	info.Metadata["PDFExtractPages.PageCount"] = pageCount
+	return info, nil
+}
@@ -0,0 +1,226 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	lpdf "github.com/ledongthuc/pdf"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// pageSeparator separates the pages' text, like pdftotext does.
+const pageSeparator = "\f"
+
+// ExtractTextHandler extracts the text layer of the session's PDF into the metadata or a file,
+// and captures values from it with regular expressions.
+type ExtractTextHandler struct {
+	definitions.BaseHandler
+	config *extractTextConfig
+	rules  []captureRule
+}
+
+type extractTextConfig struct {
+	Pages string `mapstructure:"pages,omitempty"`
+	// OutputFile is where to write the text, instead of the metadata
+	OutputFile string              `mapstructure:"output_file,omitempty"`
+	Rules      []captureRuleConfig `mapstructure:"rules,omitempty"`
+}
+
+type captureRuleConfig struct {
+	// Pattern is a regular expression whose named groups are written to the metadata
+	Pattern string `mapstructure:"pattern"`
+	// Namespace is the groups' metadata namespace, e.g. `Invoice` for `Invoice.Number`, the handler's by default
+	Namespace string `mapstructure:"namespace,omitempty"`
+}
+
+type captureRule struct {
+	regex     *regexp.Regexp
+	namespace string
+}
+
+func NewExtractTextHandler(idPrefix string, c map[string]interface{}) (*ExtractTextHandler, error) {
+	h := &ExtractTextHandler{
+		BaseHandler: definitions.BaseHandler{
+			ID: idPrefix + "_pdf_extract_text",
+		},
+	}
+	err := h.setConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *ExtractTextHandler) setConfig(config map[string]interface{}) error {
+	h.config = &extractTextConfig{}
+	err := h.DecodeMap(config, h.config)
+	if err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+	for i, rule := range h.config.Rules {
+		if rule.Pattern == "" {
+			return fmt.Errorf("pattern of rule %d is required", i+1)
+		}
+		regex, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern of rule %d: %w", i+1, err)
+		}
+		if len(getGroupNames(regex)) == 0 {
+			return fmt.Errorf("pattern of rule %d has no named groups, e.g. (?P<Number>\\d+)", i+1)
+		}
+		if strings.Contains(rule.Namespace, ".") || rule.Namespace == definitions.JobMetadataNamespace {
+			return fmt.Errorf("invalid namespace %s of rule %d", rule.Namespace, i+1)
+		}
+		h.rules = append(h.rules, captureRule{regex: regex, namespace: rule.Namespace})
+	}
+	return nil
+}
+
+func getGroupNames(regex *regexp.Regexp) []string {
+	var names []string
+	for _, name := range regex.SubexpNames() {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (h *ExtractTextHandler) Name() string {
+	return "PDFExtractText"
+}
+
+// Outputs includes the groups of the rules without a namespace, which are written under the handler's.
+func (h *ExtractTextHandler) Outputs() []string {
+	outputs := []string{"Text", "Pages", "PageCount", "OutputFile"}
+	for _, rule := range h.rules {
+		if rule.namespace == "" {
+			outputs = append(outputs, getGroupNames(rule.regex)...)
+		}
+	}
+	return outputs
+}
+
+func (h *ExtractTextHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	selection, err := evaluatePages(info, h.config.Pages)
+	if err != nil {
+		return nil, err
+	}
+	document, err := readDocument(fileHandler)
+	if err != nil {
+		return nil, err
+	}
+	pageCount, err := api.PageCount(document, newConfiguration())
+	if err != nil {
+		log.WithError(err).Errorf("failed to count pages")
+		return nil, fmt.Errorf("failed to count pages: %w", err)
+	}
+	pages, err := api.PagesForPageSelection(pageCount, selection, true, false)
+	if err != nil {
+		log.WithError(err).Errorf("invalid pages %v", selection)
+		return nil, fmt.Errorf("invalid pages: %w", err)
+	}
+
+	texts, err := extractText(document, pageCount, pages)
+	if err != nil {
+		log.WithError(err).Errorf("failed to extract text")
+		return nil, fmt.Errorf("failed to extract text: %w", err)
+	}
+	text := strings.Join(texts, pageSeparator)
+	log.Debugf("extracted %d characters from %d pages", len(text), len(texts))
+
+	if h.config.OutputFile != "" {
+		outputFile, err := info.EvaluateExpression(h.config.OutputFile)
+		if err != nil {
+			log.WithError(err).Errorf("failed to evaluate output file")
+			return nil, fmt.Errorf("failed to evaluate output file: %w", err)
+		}
+		err = os.MkdirAll(filepath.Dir(outputFile), os.ModePerm)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output dir: %w", err)
+		}
+		err = os.WriteFile(outputFile, []byte(text), 0644)
+		if err != nil {
+			log.WithError(err).Errorf("failed to write text to %s", outputFile)
+			return nil, fmt.Errorf("failed to write text: %w", err)
+		}
+		info.Metadata["PDFExtractText.OutputFile"] = outputFile
+	} else {
+		info.Metadata["PDFExtractText.Text"] = text
+		info.Metadata["PDFExtractText.Pages"] = texts
+	}
+	info.Metadata["PDFExtractText.PageCount"] = len(texts)
+
+	for _, rule := range h.rules {
+		rule.capture(text, info.Metadata, h.Name())
+	}
+	return info, nil
+}
+
+// capture writes the rule's named groups of the first match, and empty values when nothing matches,
+// so expressions using them don't fail.
+func (r captureRule) capture(text string, metadata map[string]interface{}, handlerName string) {
+	namespace := r.namespace
+	if namespace == "" {
+		namespace = handlerName
+	}
+	match := r.regex.FindStringSubmatch(text)
+	if match == nil {
+		log.Debugf("pattern %s didn't match", r.regex)
+	}
+	for i, name := range r.regex.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		value := ""
+		if match != nil {
+			value = strings.TrimSpace(match[i])
+		}
+		metadata[namespace+"."+name] = value
+	}
+}
+
+// extractText returns the text of each selected page, in order.
+func extractText(document *bytes.Reader, pageCount int, pages map[int]bool) (texts []string, err error) {
+	// the text reader panics on malformed PDFs
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to parse PDF: %v", r)
+		}
+	}()
+
+	reader, err := lpdf.NewReader(document, document.Size())
+	if err != nil {
+		return nil, err
+	}
+	if reader.NumPage() != pageCount {
+		return nil, errors.New("failed to read the PDF's pages")
+	}
+	for i := 1; i <= pageCount; i++ {
+		if pages[i] {
+			texts = append(texts, getPageText(reader.Page(i)))
+		}
+	}
+	return texts, nil
+}
+
+// getPageText joins the page's text in content order, starting a new line when the text moves vertically.
+func getPageText(page lpdf.Page) string {
+	text := &strings.Builder{}
+	var lastY float64
+	for i, t := range page.Content().Text {
+		if i > 0 && math.Abs(t.Y-lastY) > math.Max(t.FontSize/2, 1) {
+			text.WriteString("\n")
+		}
+		text.WriteString(t.S)
+		lastY = t.Y
+	}
+	return text.String()
+}
@@ -0,0 +1,72 @@
+package pdf
+
+import (
+	"bytes"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testTextPages = `{"pages": {
+	"1": {"content": {"text": [
+		{"value": "Invoice No: INV-2024-001", "pos": [50, 700], "font": {"name": "Helvetica", "size": 12}},
+		{"value": "Customer ID: C-42", "pos": [50, 680], "font": {"name": "Helvetica", "size": 12}}
+	]}},
+	"2": {"content": {"text": [
+		{"value": "Total: 99.50 EUR", "pos": [50, 700], "font": {"name": "Helvetica", "size": 12}}
+	]}}
+}}`
+
+func createTextPDF(t *testing.T) []byte {
+	pdf := &bytes.Buffer{}
+	assert.NoError(t, api.Create(nil, strings.NewReader(testTextPages), pdf, newConfiguration()))
+	return pdf.Bytes()
+}
+
+func TestExtractTextHandler(t *testing.T) {
+	h, err := NewExtractTextHandler("test", map[string]interface{}{
+		"rules": []map[string]interface{}{
+			{"pattern": `Invoice No: (?P<Number>\S+)`, "namespace": "Invoice"},
+			{"pattern": `Customer ID: (?P<CustomerID>\S+)`},
+			{"pattern": `PO: (?P<Order>\S+)`, "namespace": "Order"},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, h.Outputs(), "CustomerID")
+	assert.NotContains(t, h.Outputs(), "Number")
+
+	fileHandler := newFileHandler(createTextPDF(t))
+	info, err := h.Handle(newFlowObject(), fileHandler)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Invoice No: INV-2024-001\nCustomer ID: C-42", "Total: 99.50 EUR"}, info.Metadata["PDFExtractText.Pages"])
+	assert.Equal(t, "Invoice No: INV-2024-001\nCustomer ID: C-42\fTotal: 99.50 EUR", info.Metadata["PDFExtractText.Text"])
+	assert.Equal(t, 2, info.Metadata["PDFExtractText.PageCount"])
+	assert.Equal(t, "INV-2024-001", info.Metadata["Invoice.Number"])
+	assert.Equal(t, "C-42", info.Metadata["PDFExtractText.CustomerID"])
+	assert.Equal(t, "", info.Metadata["Order.Order"])
+	assert.Equal(t, 0, fileHandler.writer.Len())
+}
+
+func TestExtractTextHandler_OutputFile(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "text", "job.txt")
+	h, err := NewExtractTextHandler("test", map[string]interface{}{
+		"pages":       "2",
+		"output_file": output,
+		"rules":       []map[string]interface{}{{"pattern": `Total: (?P<Total>[\d.]+)`}},
+	})
+	assert.NoError(t, err)
+
+	info, err := h.Handle(newFlowObject(), newFileHandler(createTextPDF(t)))
+	assert.NoError(t, err)
+	assert.Equal(t, output, info.Metadata["PDFExtractText.OutputFile"])
+	assert.Equal(t, 1, info.Metadata["PDFExtractText.PageCount"])
+	assert.Equal(t, "99.50", info.Metadata["PDFExtractText.Total"])
+	assert.NotContains(t, info.Metadata, "PDFExtractText.Text")
+
+	text, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, "Total: 99.50 EUR", string(text))
+}
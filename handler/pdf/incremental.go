@@ -0,0 +1,177 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"sort"
+	"strconv"
+)
+
+// incrementalUpdate appends objects to a PDF without changing its existing bytes,
+// so signatures already in it stay valid.
+type incrementalUpdate struct {
+	original []byte
+	ctx      *model.Context
+	size     int
+	objects  map[int]updateObject
+}
+
+type updateObject struct {
+	generation int
+	body       string
+}
+
+func newIncrementalUpdate(original []byte, ctx *model.Context) (*incrementalUpdate, error) {
+	if ctx.XRefTable.Size == nil {
+		return nil, errors.New("the PDF's trailer has no size")
+	}
+	return &incrementalUpdate{
+		original: original,
+		ctx:      ctx,
+		size:     *ctx.XRefTable.Size,
+		objects:  map[int]updateObject{},
+	}, nil
+}
+
+// add adds a new object and returns its reference.
+func (u *incrementalUpdate) add(body string) types.IndirectRef {
+	number := u.size
+	u.size++
+	u.objects[number] = updateObject{body: body}
+	return *types.NewIndirectRef(number, 0)
+}
+
+// replace replaces an existing object.
+func (u *incrementalUpdate) replace(reference types.IndirectRef, body string) {
+	u.objects[reference.ObjectNumber.Value()] = updateObject{generation: reference.GenerationNumber.Value(), body: body}
+}
+
+// write returns the PDF with the update appended, using the same kind of cross-reference section as the PDF.
+func (u *incrementalUpdate) write() ([]byte, error) {
+	previous, err := getStartXRef(u.original)
+	if err != nil {
+		return nil, err
+	}
+	output := bytes.NewBuffer(append([]byte{}, u.original...))
+	if !bytes.HasSuffix(u.original, []byte("\n")) {
+		output.WriteString("\n")
+	}
+
+	offsets := map[int]int{}
+	for _, number := range u.getNumbers() {
+		object := u.objects[number]
+		offsets[number] = output.Len()
+		fmt.Fprintf(output, "%d %d obj\n%s\nendobj\n", number, object.generation, object.body)
+	}
+
+	trailer := types.NewDict()
+	trailer.Insert("Root", *u.ctx.Root)
+	trailer.Insert("Prev", types.Integer(previous))
+	if u.ctx.Info != nil {
+		trailer.Insert("Info", *u.ctx.Info)
+	}
+	if len(u.ctx.ID) > 0 {
+		trailer.Insert("ID", u.ctx.ID)
+	}
+
+	xrefOffset := output.Len()
+	if u.ctx.Read != nil && u.ctx.Read.UsingXRefStreams {
+		u.writeXRefStream(output, offsets, trailer)
+	} else {
+		u.writeXRefTable(output, offsets, trailer)
+	}
+	fmt.Fprintf(output, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+	return output.Bytes(), nil
+}
+
+func (u *incrementalUpdate) getNumbers() []int {
+	var numbers []int
+	for number := range u.objects {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+func (u *incrementalUpdate) getGeneration(number int) int {
+	return u.objects[number].generation
+}
+
+func (u *incrementalUpdate) writeXRefTable(output *bytes.Buffer, offsets map[int]int, trailer types.Dict) {
+	output.WriteString("xref\n")
+	for _, section := range getSubsections(offsets) {
+		fmt.Fprintf(output, "%d %d\n", section[0], len(section))
+		for _, number := range section {
+			fmt.Fprintf(output, "%010d %05d n\r\n", offsets[number], u.getGeneration(number))
+		}
+	}
+	trailer.Insert("Size", types.Integer(u.size))
+	fmt.Fprintf(output, "trailer\n%s\n", trailer.PDFString())
+}
+
+// writeXRefStream writes the cross-reference stream, which is itself one of the update's objects.
+func (u *incrementalUpdate) writeXRefStream(output *bytes.Buffer, offsets map[int]int, trailer types.Dict) {
+	number := u.size
+	u.size++
+	offsets[number] = output.Len()
+
+	var index types.Array
+	entries := &bytes.Buffer{}
+	for _, section := range getSubsections(offsets) {
+		index = append(index, types.Integer(section[0]), types.Integer(len(section)))
+		for _, n := range section {
+			// type 1 entries of an uncompressed object's offset and generation
+			entries.WriteByte(1)
+			_ = binary.Write(entries, binary.BigEndian, uint32(offsets[n]))
+			_ = binary.Write(entries, binary.BigEndian, uint16(u.getGeneration(n)))
+		}
+	}
+
+	trailer.Insert("Type", types.Name("XRef"))
+	trailer.Insert("Size", types.Integer(u.size))
+	trailer.Insert("Index", index)
+	trailer.Insert("W", types.Array{types.Integer(1), types.Integer(4), types.Integer(2)})
+	trailer.Insert("Length", types.Integer(entries.Len()))
+	fmt.Fprintf(output, "%d 0 obj\n%s\nstream\n", number, trailer.PDFString())
+	output.Write(entries.Bytes())
+	output.WriteString("\nendstream\nendobj\n")
+}
+
+// getSubsections groups the object numbers into runs of consecutive numbers.
+func getSubsections(offsets map[int]int) [][]int {
+	var numbers []int
+	for number := range offsets {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	var sections [][]int
+	for i, number := range numbers {
+		if i == 0 || number != numbers[i-1]+1 {
+			sections = append(sections, []int{})
+		}
+		sections[len(sections)-1] = append(sections[len(sections)-1], number)
+	}
+	return sections
+}
+
+// getStartXRef returns the offset of the PDF's last cross-reference section.
+func getStartXRef(document []byte) (int, error) {
+	i := bytes.LastIndex(document, []byte("startxref"))
+	if i < 0 {
+		return 0, errors.New("the PDF has no startxref")
+	}
+	fields := bytes.Fields(document[i+len("startxref"):])
+	if len(fields) == 0 {
+		return 0, errors.New("the PDF has no startxref offset")
+	}
+	offset, err := strconv.Atoi(string(fields[0]))
+	if err != nil {
+		return 0, fmt.Errorf("invalid startxref offset: %w", err)
+	}
+	return offset, nil
+}
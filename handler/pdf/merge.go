@@ -0,0 +1,113 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/utils"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+)
+
+const (
+	mergeAppend  = "append"
+	mergePrepend = "prepend"
+)
+
+// MergeHandler merges other PDFs into the session's PDF.
+type MergeHandler struct {
+	definitions.BaseHandler
+	config *mergeConfig
+}
+
+type mergeConfig struct {
+	// the PDFs to merge
+	utils.FilesConfig `mapstructure:",squash"`
+	// Position is where the files go, append(default) or prepend
+	Position    string `mapstructure:"position,omitempty"`
+	DividerPage bool   `mapstructure:"divider_page,omitempty"`
+}
+
+func NewMergeHandler(idPrefix string, c map[string]interface{}) (*MergeHandler, error) {
+	h := &MergeHandler{
+		BaseHandler: definitions.BaseHandler{
+			ID: idPrefix + "_pdf_merge",
+		},
+	}
+	err := h.setConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *MergeHandler) setConfig(config map[string]interface{}) error {
+	h.config = &mergeConfig{}
+	err := h.DecodeMap(config, h.config)
+	if err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+	if !h.config.IsSet() {
+		return errors.New("files or files_metadata_key is required")
+	}
+	if h.config.Position == "" {
+		h.config.Position = mergeAppend
+	}
+	if h.config.Position != mergeAppend && h.config.Position != mergePrepend {
+		return fmt.Errorf("invalid position %s, must be %s or %s", h.config.Position, mergeAppend, mergePrepend)
+	}
+	return nil
+}
+
+func (h *MergeHandler) Name() string {
+	return "PDFMerge"
+}
+
+func (h *MergeHandler) Outputs() []string {
+	return []string{"PageCount", "MergedFiles"}
+}
+
+func (h *MergeHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	files, err := h.config.GetFiles(info.Metadata)
+	if err != nil {
+		return nil, err
+	}
+	document, err := readDocument(fileHandler)
+	if err != nil {
+		return nil, err
+	}
+
+	var documents []io.ReadSeeker
+	for _, file := range files {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			log.WithError(err).Errorf("failed to read %s", file)
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		documents = append(documents, bytes.NewReader(contents))
+	}
+	if h.config.Position == mergePrepend {
+		documents = append(documents, document)
+	} else {
+		documents = append([]io.ReadSeeker{document}, documents...)
+	}
+
+	output := &bytes.Buffer{}
+	err = api.MergeRaw(documents, output, h.config.DividerPage, newConfiguration())
+	if err != nil {
+		log.WithError(err).Errorf("failed to merge PDFs")
+		return nil, fmt.Errorf("failed to merge PDFs: %w", err)
+	}
+	pageCount, err := writeDocument(fileHandler, output.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	info.Pages = pageCount
+	info.Metadata["PDFMerge.PageCount"] = pageCount
+	info.Metadata["PDFMerge.MergedFiles"] = len(files)
+	return info, nil
+}
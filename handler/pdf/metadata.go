@@ -0,0 +1,302 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// MetadataHandler reads the session's PDF info dictionary and XMP metadata into the flow metadata,
+// and optionally writes fields into the info dictionary.
+type MetadataHandler struct {
+	definitions.BaseHandler
+	config *metadataConfig
+}
+
+type metadataConfig struct {
+	// Set are the info dictionary fields to write, e.g. `Title` or a custom `TrackingID`
+	Set map[string]string `mapstructure:"set,omitempty"`
+}
+
+// documentMetadata holds the standard fields, by their output names.
+type documentMetadata map[string]string
+
+var metadataFields = []string{"Title", "Author", "Subject", "Keywords", "Creator", "Producer", "CreationDate", "ModificationDate"}
+
+// writtenByPDFCPU are the fields pdfcpu overwrites whenever it writes a PDF.
+var writtenByPDFCPU = []string{"Producer", "CreationDate", "ModificationDate", "ModDate"}
+
+func NewMetadataHandler(idPrefix string, c map[string]interface{}) (*MetadataHandler, error) {
+	h := &MetadataHandler{
+		BaseHandler: definitions.BaseHandler{
+			ID: idPrefix + "_pdf_metadata",
+		},
+	}
+	err := h.setConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *MetadataHandler) setConfig(config map[string]interface{}) error {
+	h.config = &metadataConfig{}
+	err := h.DecodeMap(config, h.config)
+	if err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+	for _, key := range writtenByPDFCPU {
+		if _, ok := h.config.Set[key]; ok {
+			return fmt.Errorf("%s can't be set, it's set when the PDF is written", key)
+		}
+	}
+	return nil
+}
+
+func (h *MetadataHandler) Name() string {
+	return "PDFMetadata"
+}
+
+func (h *MetadataHandler) Outputs() []string {
+	return append(append([]string{}, metadataFields...), "Properties")
+}
+
+func (h *MetadataHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	values := map[string]string{}
+	for key, value := range h.config.Set {
+		evaluated, err := info.EvaluateExpression(value)
+		if err != nil {
+			log.WithError(err).Errorf("failed to evaluate %s", key)
+			return nil, fmt.Errorf("failed to evaluate %s: %w", key, err)
+		}
+		values[key] = evaluated
+	}
+	document, err := readDocument(fileHandler)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err := api.ReadValidateAndOptimize(document, newConfiguration())
+	if err != nil {
+		log.WithError(err).Errorf("failed to read PDF")
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+	fields := getInfoMetadata(ctx)
+	xmp, err := getXMPMetadata(ctx)
+	if err != nil {
+		// the info dictionary is enough, a broken XMP packet shouldn't fail the job
+		log.WithError(err).Warnf("failed to read XMP metadata")
+	}
+	for key, value := range xmp {
+		if fields[key] == "" {
+			fields[key] = value
+		}
+	}
+	properties := map[string]string{}
+	for key, value := range ctx.Properties {
+		properties[key] = value
+	}
+
+	if len(values) > 0 {
+		err = setInfoMetadata(ctx, values)
+		if err != nil {
+			log.WithError(err).Errorf("failed to set PDF metadata")
+			return nil, fmt.Errorf("failed to set PDF metadata: %w", err)
+		}
+		output := &bytes.Buffer{}
+		err = api.Write(ctx, output, newConfiguration())
+		if err != nil {
+			log.WithError(err).Errorf("failed to write PDF")
+			return nil, fmt.Errorf("failed to write PDF: %w", err)
+		}
+		err = writeContents(fileHandler, output.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			if isMetadataField(key) {
+				fields[key] = value
+			} else {
+				properties[key] = value
+			}
+		}
+	}
+
+	for _, field := range metadataFields {
+		info.Metadata["PDFMetadata."+field] = fields[field]
+	}
+	info.Metadata["PDFMetadata.Properties"] = properties
+	return info, nil
+}
+
+func isMetadataField(key string) bool {
+	for _, field := range metadataFields {
+		if field == key {
+			return true
+		}
+	}
+	return false
+}
+
+// getInfoMetadata returns the info dictionary's fields, which pdfcpu reads while validating.
+func getInfoMetadata(ctx *model.Context) documentMetadata {
+	return documentMetadata{
+		"Title":            ctx.Title,
+		"Author":           ctx.Author,
+		"Subject":          ctx.Subject,
+		"Keywords":         ctx.Keywords,
+		"Creator":          ctx.Creator,
+		"Producer":         ctx.Producer,
+		"CreationDate":     formatDate(ctx.CreationDate),
+		"ModificationDate": formatDate(ctx.ModDate),
+	}
+}
+
+// formatDate converts a PDF date, e.g. `D:20240102150405+02'00'`, to RFC 3339 like the job metadata.
+func formatDate(date string) string {
+	if date == "" {
+		return ""
+	}
+	t, ok := types.DateTime(date, true)
+	if !ok {
+		return date
+	}
+	return t.Format(time.RFC3339)
+}
+
+type xmpMeta struct {
+	Descriptions []xmpDescription `xml:"http://www.w3.org/1999/02/22-rdf-syntax-ns# RDF>Description"`
+}
+
+// xmpList holds an rdf:Alt, rdf:Seq or rdf:Bag, whichever the field uses.
+type xmpList struct {
+	Alt []string `xml:"Alt>li"`
+	Seq []string `xml:"Seq>li"`
+	Bag []string `xml:"Bag>li"`
+}
+
+func (l xmpList) String() string {
+	return strings.Join(append(append(append([]string{}, l.Alt...), l.Seq...), l.Bag...), ", ")
+}
+
+// xmpDescription holds the fields as elements, the attribute form is read in getXMPMetadata.
+type xmpDescription struct {
+	Attributes   []xml.Attr `xml:",any,attr"`
+	Title        xmpList    `xml:"http://purl.org/dc/elements/1.1/ title"`
+	Author       xmpList    `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Subject      xmpList    `xml:"http://purl.org/dc/elements/1.1/ description"`
+	Keywords     string     `xml:"http://ns.adobe.com/pdf/1.3/ Keywords"`
+	Creator      string     `xml:"http://ns.adobe.com/xap/1.0/ CreatorTool"`
+	Producer     string     `xml:"http://ns.adobe.com/pdf/1.3/ Producer"`
+	CreationDate string     `xml:"http://ns.adobe.com/xap/1.0/ CreateDate"`
+	ModDate      string     `xml:"http://ns.adobe.com/xap/1.0/ ModifyDate"`
+}
+
+var xmpAttributes = map[xml.Name]string{
+	{Space: "http://ns.adobe.com/pdf/1.3/", Local: "Keywords"}:    "Keywords",
+	{Space: "http://ns.adobe.com/xap/1.0/", Local: "CreatorTool"}: "Creator",
+	{Space: "http://ns.adobe.com/pdf/1.3/", Local: "Producer"}:    "Producer",
+	{Space: "http://ns.adobe.com/xap/1.0/", Local: "CreateDate"}:  "CreationDate",
+	{Space: "http://ns.adobe.com/xap/1.0/", Local: "ModifyDate"}:  "ModificationDate",
+}
+
+// getXMPMetadata returns the fields of the catalog's XMP packet, if there is one.
+func getXMPMetadata(ctx *model.Context) (documentMetadata, error) {
+	catalog, err := ctx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	reference := catalog.IndirectRefEntry("Metadata")
+	if reference == nil {
+		return nil, nil
+	}
+	stream, _, err := ctx.DereferenceStreamDict(*reference)
+	if err != nil || stream == nil {
+		return nil, err
+	}
+	err = stream.Decode()
+	if err != nil {
+		return nil, err
+	}
+
+	meta := xmpMeta{}
+	err = xml.Unmarshal(stream.Content, &meta)
+	if err != nil {
+		return nil, err
+	}
+	fields := documentMetadata{}
+	// the fields can be spread over several descriptions
+	for _, d := range meta.Descriptions {
+		for _, attribute := range d.Attributes {
+			if field, ok := xmpAttributes[attribute.Name]; ok {
+				fields.setIfEmpty(field, attribute.Value)
+			}
+		}
+		fields.setIfEmpty("Title", d.Title.String())
+		fields.setIfEmpty("Author", d.Author.String())
+		fields.setIfEmpty("Subject", d.Subject.String())
+		fields.setIfEmpty("Keywords", d.Keywords)
+		fields.setIfEmpty("Creator", d.Creator)
+		fields.setIfEmpty("Producer", d.Producer)
+		fields.setIfEmpty("CreationDate", d.CreationDate)
+		fields.setIfEmpty("ModificationDate", d.ModDate)
+	}
+	return fields, nil
+}
+
+func (m documentMetadata) setIfEmpty(key string, value string) {
+	value = strings.TrimSpace(value)
+	if m[key] == "" && value != "" {
+		m[key] = value
+	}
+}
+
+// setInfoMetadata writes the values into the info dictionary, creating it if needed.
+func setInfoMetadata(ctx *model.Context, values map[string]string) error {
+	if ctx.Info == nil {
+		reference, err := ctx.IndRefForNewObject(types.NewDict())
+		if err != nil {
+			return err
+		}
+		ctx.Info = reference
+	}
+	d, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil {
+		return err
+	}
+
+	for key, value := range values {
+		encoded, err := encodeText(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", key, err)
+		}
+		d[key] = types.StringLiteral(encoded)
+	}
+	return nil
+}
+
+// encodeText encodes a PDF text string, as UTF-16 if it isn't ASCII.
+func encodeText(s string) (string, error) {
+	for _, r := range s {
+		if r > unicode.MaxASCII {
+			escaped, err := types.EscapeUTF16String(s)
+			if err != nil {
+				return "", err
+			}
+			return *escaped, nil
+		}
+	}
+	escaped, err := types.Escape(s)
+	if err != nil {
+		return "", err
+	}
+	return *escaped, nil
+}
@@ -0,0 +1,88 @@
+package pdf
+
+import (
+	"bytes"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const testXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:CreatorTool="Microsoft Word"/>
+  <rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:pdf="http://ns.adobe.com/pdf/1.3/">
+   <dc:title><rdf:Alt><rdf:li xml:lang="x-default">Quarterly Report.docx</rdf:li></rdf:Alt></dc:title>
+   <dc:creator><rdf:Seq><rdf:li>Alice</rdf:li><rdf:li>Bob</rdf:li></rdf:Seq></dc:creator>
+   <pdf:Keywords>finance, q3</pdf:Keywords>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+// createPDFWithXMP creates a PDF whose metadata is only in an XMP packet.
+func createPDFWithXMP(t *testing.T) []byte {
+	ctx, err := api.ReadContext(bytes.NewReader(createPDF(t, 1)), newConfiguration())
+	assert.NoError(t, err)
+	stream, err := ctx.NewStreamDictForBuf([]byte(testXMP))
+	assert.NoError(t, err)
+	stream.InsertName("Type", "Metadata")
+	stream.InsertName("Subtype", "XML")
+	assert.NoError(t, stream.Encode())
+	reference, err := ctx.IndRefForNewObject(*stream)
+	assert.NoError(t, err)
+	catalog, err := ctx.Catalog()
+	assert.NoError(t, err)
+	catalog["Metadata"] = *reference
+
+	output := &bytes.Buffer{}
+	assert.NoError(t, api.WriteContext(ctx, output))
+	return output.Bytes()
+}
+
+func TestMetadataHandler_Read(t *testing.T) {
+	h, err := NewMetadataHandler("test", map[string]interface{}{})
+	assert.NoError(t, err)
+
+	document := createPDFWithXMP(t)
+	fileHandler := newFileHandler(document)
+	info, err := h.Handle(newFlowObject(), fileHandler)
+	assert.NoError(t, err)
+	assert.Equal(t, "Quarterly Report.docx", info.Metadata["PDFMetadata.Title"])
+	assert.Equal(t, "Alice, Bob", info.Metadata["PDFMetadata.Author"])
+	assert.Equal(t, "Microsoft Word", info.Metadata["PDFMetadata.Creator"])
+	assert.Equal(t, "finance, q3", info.Metadata["PDFMetadata.Keywords"])
+	assert.Equal(t, map[string]string{}, info.Metadata["PDFMetadata.Properties"])
+	// reading alone doesn't rewrite the document
+	assert.Equal(t, 0, fileHandler.writer.Len())
+}
+
+func TestMetadataHandler_Write(t *testing.T) {
+	h, err := NewMetadataHandler("test", map[string]interface{}{
+		"set": map[string]string{
+			"Title":      `${$env["Job.Title"]}`,
+			"TrackingID": "track-1",
+		},
+	})
+	assert.NoError(t, err)
+
+	info := newFlowObject()
+	info.Metadata["Job.Title"] = "Überweisung (copy)"
+	fileHandler := newFileHandler(createPDF(t, 1))
+	info, err = h.Handle(info, fileHandler)
+	assert.NoError(t, err)
+	assert.Equal(t, "Überweisung (copy)", info.Metadata["PDFMetadata.Title"])
+	assert.Equal(t, map[string]string{"TrackingID": "track-1"}, info.Metadata["PDFMetadata.Properties"])
+
+	h, err = NewMetadataHandler("test", map[string]interface{}{})
+	assert.NoError(t, err)
+	info, err = h.Handle(newFlowObject(), newFileHandler(fileHandler.writer.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, "Überweisung (copy)", info.Metadata["PDFMetadata.Title"])
+	assert.Equal(t, map[string]string{"TrackingID": "track-1"}, info.Metadata["PDFMetadata.Properties"])
+	assert.NotEmpty(t, info.Metadata["PDFMetadata.CreationDate"])
+}
+
+func TestFormatDate(t *testing.T) {
+	assert.Equal(t, "2024-01-02T15:04:05+02:00", formatDate("D:20240102150405+02'00'"))
+	assert.Equal(t, "not a date", formatDate("not a date"))
+	assert.Equal(t, "", formatDate(""))
+}
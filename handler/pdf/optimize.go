@@ -0,0 +1,54 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// OptimizeHandler removes redundant resources, e.g. duplicate fonts and images, from the session's PDF.
+type OptimizeHandler struct {
+	definitions.BaseHandler
+}
+
+func NewOptimizeHandler(idPrefix string, c map[string]interface{}) (*OptimizeHandler, error) {
+	return &OptimizeHandler{
+		BaseHandler: definitions.BaseHandler{
+			ID: idPrefix + "_pdf_optimize",
+		},
+	}, nil
+}
+
+func (h *OptimizeHandler) Name() string {
+	return "PDFOptimize"
+}
+
+func (h *OptimizeHandler) Outputs() []string {
+	return []string{"PageCount", "InputSize", "OutputSize"}
+}
+
+func (h *OptimizeHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	document, err := readDocument(fileHandler)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &bytes.Buffer{}
+	err = api.Optimize(document, output, newConfiguration())
+	if err != nil {
+		log.WithError(err).Errorf("failed to optimize PDF")
+		return nil, fmt.Errorf("failed to optimize PDF: %w", err)
+	}
+	pageCount, err := writeDocument(fileHandler, output.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("optimized PDF from %d to %d bytes", document.Size(), output.Len())
+
+	info.Metadata["PDFOptimize.PageCount"] = pageCount
+	info.Metadata["PDFOptimize.InputSize"] = int(document.Size())
+	info.Metadata["PDFOptimize.OutputSize"] = output.Len()
+	return info, nil
+}
@@ -0,0 +1,260 @@
+package pdf
+
+import (
+	"bytes"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// MockEngineFileHandler is a mock implementation of EngineFileHandler for testing
+type MockEngineFileHandler struct {
+	reader io.Reader
+	writer *bytes.Buffer
+}
+
+func (m *MockEngineFileHandler) Read() (io.Reader, error) {
+	return m.reader, nil
+}
+
+func (m *MockEngineFileHandler) Write() (io.Writer, error) {
+	return m.writer, nil
+}
+
+func (m *MockEngineFileHandler) Close() {
+
+}
+
+func newFileHandler(document []byte) *MockEngineFileHandler {
+	return &MockEngineFileHandler{
+		reader: bytes.NewReader(document),
+		writer: &bytes.Buffer{},
+	}
+}
+
+func newFlowObject() *definitions.EngineFlowObject {
+	return &definitions.EngineFlowObject{
+		Metadata: map[string]interface{}{"Job.User": "alice"},
+	}
+}
+
+// handle runs a new handler with the config on the document, and returns what it wrote and the metadata.
+func handle[H definitions.Handler](t *testing.T, newHandler func(string, map[string]interface{}) (H, error), c map[string]interface{}, document []byte) ([]byte, map[string]interface{}) {
+	h, err := newHandler("test", c)
+	assert.NoError(t, err)
+	fileHandler := newFileHandler(document)
+	info, err := h.Handle(newFlowObject(), fileHandler)
+	assert.NoError(t, err)
+	return fileHandler.writer.Bytes(), info.Metadata
+}
+
+// validates returns a function that creates the handler with a config, to test which configs are rejected.
+func validates[H definitions.Handler](newHandler func(string, map[string]interface{}) (H, error)) func(map[string]interface{}) error {
+	return func(c map[string]interface{}) error {
+		_, err := newHandler("test", c)
+		return err
+	}
+}
+
+// createPDF creates a PDF with a page per image.
+func createPDF(t *testing.T, pages int) []byte {
+	var images []io.Reader
+	for i := 0; i < pages; i++ {
+		img := &bytes.Buffer{}
+		assert.NoError(t, png.Encode(img, image.NewRGBA(image.Rect(0, 0, 2, 2+i))))
+		images = append(images, img)
+	}
+	pdf := &bytes.Buffer{}
+	assert.NoError(t, api.ImportImages(nil, pdf, images, nil, nil))
+	return pdf.Bytes()
+}
+
+func pageCount(t *testing.T, document []byte) int {
+	count, err := api.PageCount(bytes.NewReader(document), newConfiguration())
+	assert.NoError(t, err)
+	return count
+}
+
+func TestSplitHandler_Span(t *testing.T) {
+	dir := t.TempDir()
+	h, err := NewSplitHandler("test", map[string]interface{}{"output_dir": dir, "span": 2})
+	assert.NoError(t, err)
+
+	document := createPDF(t, 5)
+	fileHandler := newFileHandler(document)
+	info, err := h.Handle(newFlowObject(), fileHandler)
+	assert.NoError(t, err)
+
+	files := info.Metadata["PDFSplit.Files"].([]string)
+	assert.Equal(t, []string{filepath.Join(dir, "part_1.pdf"), filepath.Join(dir, "part_2.pdf"), filepath.Join(dir, "part_3.pdf")}, files)
+	assert.Equal(t, 3, info.Metadata["PDFSplit.PartCount"])
+	assert.Equal(t, []int{2, 2, 1}, info.Metadata["PDFSplit.PageCounts"])
+	for i, file := range files {
+		part, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		assert.Equal(t, []int{2, 2, 1}[i], pageCount(t, part))
+	}
+	assert.Equal(t, 0, fileHandler.writer.Len())
+}
+
+func TestSplitHandler_Ranges(t *testing.T) {
+	dir := t.TempDir()
+	h, err := NewSplitHandler("test", map[string]interface{}{
+		"output_dir": dir,
+		"filename":   "invoice",
+		"ranges":     []string{"1", "2-"},
+	})
+	assert.NoError(t, err)
+
+	info, err := h.Handle(newFlowObject(), newFileHandler(createPDF(t, 4)))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "invoice_1.pdf"), filepath.Join(dir, "invoice_2.pdf")}, info.Metadata["PDFSplit.Files"])
+	assert.Equal(t, []int{1, 3}, info.Metadata["PDFSplit.PageCounts"])
+}
+
+func TestSplitHandler_WritesAllPartsOrNone(t *testing.T) {
+	dir := t.TempDir()
+	// the second part can't be written over a directory
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "part_2.pdf"), 0755))
+	h, err := NewSplitHandler("test", map[string]interface{}{"output_dir": dir})
+	assert.NoError(t, err)
+
+	_, err = h.Handle(newFlowObject(), newFileHandler(createPDF(t, 2)))
+	assert.Error(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, "part_1.pdf"))
+}
+
+func TestExtractPagesHandler(t *testing.T) {
+	h, err := NewExtractPagesHandler("test", map[string]interface{}{"pages": "1, 3-4"})
+	assert.NoError(t, err)
+
+	fileHandler := newFileHandler(createPDF(t, 5))
+	info, err := h.Handle(newFlowObject(), fileHandler)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, info.Pages)
+	assert.Equal(t, 3, info.Metadata["PDFExtractPages.PageCount"])
+	assert.Equal(t, 3, pageCount(t, fileHandler.writer.Bytes()))
+}
+
+func TestRotateHandler(t *testing.T) {
+	h, err := NewRotateHandler("test", map[string]interface{}{"rotation": 90, "pages": "odd"})
+	assert.NoError(t, err)
+
+	fileHandler := newFileHandler(createPDF(t, 3))
+	info, err := h.Handle(newFlowObject(), fileHandler)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, info.Metadata["PDFRotate.PageCount"])
+	assert.Equal(t, 3, pageCount(t, fileHandler.writer.Bytes()))
+}
+
+func TestMergeHandler(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.pdf")
+	second := filepath.Join(dir, "second.pdf")
+	assert.NoError(t, os.WriteFile(first, createPDF(t, 2), 0644))
+	assert.NoError(t, os.WriteFile(second, createPDF(t, 3), 0644))
+
+	h, err := NewMergeHandler("test", map[string]interface{}{
+		"files":              []string{first},
+		"files_metadata_key": "Attachments",
+		"position":           "prepend",
+	})
+	assert.NoError(t, err)
+
+	info := newFlowObject()
+	info.Metadata["Attachments"] = []interface{}{second}
+	fileHandler := newFileHandler(createPDF(t, 1))
+	info, err = h.Handle(info, fileHandler)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, info.Pages)
+	assert.Equal(t, 6, info.Metadata["PDFMerge.PageCount"])
+	assert.Equal(t, 2, info.Metadata["PDFMerge.MergedFiles"])
+	assert.Equal(t, 6, pageCount(t, fileHandler.writer.Bytes()))
+}
+
+func TestMergeHandler_MissingFile(t *testing.T) {
+	h, err := NewMergeHandler("test", map[string]interface{}{"files_metadata_key": "Attachments"})
+	assert.NoError(t, err)
+
+	_, err = h.Handle(newFlowObject(), newFileHandler(createPDF(t, 1)))
+	assert.Error(t, err)
+
+	info := newFlowObject()
+	info.Metadata["Attachments"] = "missing.pdf"
+	_, err = h.Handle(info, newFileHandler(createPDF(t, 1)))
+	assert.Error(t, err)
+}
+
+func TestOptimizeHandler(t *testing.T) {
+	h, err := NewOptimizeHandler("test", map[string]interface{}{})
+	assert.NoError(t, err)
+
+	document := createPDF(t, 2)
+	fileHandler := newFileHandler(document)
+	info, err := h.Handle(newFlowObject(), fileHandler)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, info.Metadata["PDFOptimize.PageCount"])
+	assert.Equal(t, len(document), info.Metadata["PDFOptimize.InputSize"])
+	assert.Equal(t, fileHandler.writer.Len(), info.Metadata["PDFOptimize.OutputSize"])
+}
+
+func TestHandlers_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		handler    string
+		newHandler func(map[string]interface{}) error
+		configs    []map[string]interface{}
+	}{
+		{"PDFSplit", validates(NewSplitHandler), []map[string]interface{}{
+			{},
+			{"output_dir": "out", "span": 2, "ranges": []string{"1"}},
+		}},
+		{"PDFExtractPages", validates(NewExtractPagesHandler), []map[string]interface{}{
+			{},
+		}},
+		{"PDFRotate", validates(NewRotateHandler), []map[string]interface{}{
+			{"rotation": 45},
+		}},
+		{"PDFMerge", validates(NewMergeHandler), []map[string]interface{}{
+			{},
+			{"files": []string{"a.pdf"}, "position": "middle"},
+		}},
+		{"PDFEncrypt", validates(NewEncryptHandler), []map[string]interface{}{
+			{"user_password": "pw"},
+			{"owner_password": "pw", "owner_password_file": "pw.txt"},
+		}},
+		{"PDFExtractText", validates(NewExtractTextHandler), []map[string]interface{}{
+			{"rules": []map[string]interface{}{{"pattern": ""}}},
+			{"rules": []map[string]interface{}{{"pattern": "("}}},
+			{"rules": []map[string]interface{}{{"pattern": `Invoice (\d+)`}}},
+			{"rules": []map[string]interface{}{{"pattern": `(?P<Number>\d+)`, "namespace": "Job"}}},
+		}},
+		{"PDFMetadata", validates(NewMetadataHandler), []map[string]interface{}{
+			{"set": map[string]string{"Producer": "me"}},
+		}},
+		{"PDFSign", validates(NewSignHandler), []map[string]interface{}{
+			{},
+			{"certificate_file": "cert.pem"},
+			{"pkcs12_file": "a.p12", "key_file": "key.pem"},
+			{"pkcs12_file": "a.p12", "rect": []float64{10, 10, 5, 20}},
+		}},
+		{"PDFWatermark", validates(NewWatermarkHandler), []map[string]interface{}{
+			{},
+			{"type": "image"},
+			{"type": "video", "text": "COPY"},
+			{"text": "COPY", "position": "middle"},
+			{"text": "COPY", "opacity": 2},
+			{"text": "COPY", "font_name": "NoSuchFont"},
+		}},
+	}
+	for _, test := range tests {
+		for _, c := range test.configs {
+			assert.Error(t, test.newHandler(c), "%s %v", test.handler, c)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	log "github.com/sirupsen/logrus"
+)
+
+// RotateHandler rotates the pages of the session's PDF.
+type RotateHandler struct {
+	definitions.BaseHandler
+	config *rotateConfig
+}
+
+type rotateConfig struct {
+	// Rotation is clockwise in degrees, a multiple of 90
+	Rotation int `mapstructure:"rotation"`
+	// Pages is a pdfcpu page selection of the pages to rotate, all of them if it's empty
+	Pages string `mapstructure:"pages,omitempty"`
+}
+
+func NewRotateHandler(idPrefix string, c map[string]interface{}) (*RotateHandler, error) {
+	h := &RotateHandler{
+		BaseHandler: definitions.BaseHandler{
+			ID: idPrefix + "_pdf_rotate",
+		},
+	}
+	err := h.setConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *RotateHandler) setConfig(config map[string]interface{}) error {
+	h.config = &rotateConfig{}
+	err := h.DecodeMap(config, h.config)
+	if err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+	if h.config.Rotation == 0 || h.config.Rotation%90 != 0 {
+		return errors.New("rotation must be a non zero multiple of 90")
+	}
+	return nil
+}
+
+func (h *RotateHandler) Name() string {
+	return "PDFRotate"
+}
+
+func (h *RotateHandler) Outputs() []string {
+	return []string{"PageCount"}
+}
+
+func (h *RotateHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	pages, err := evaluatePages(info, h.config.Pages)
+	if err != nil {
+		return nil, err
+	}
+	document, err := readDocument(fileHandler)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &bytes.Buffer{}
+	err = api.Rotate(document, output, h.config.Rotation, pages, newConfiguration())
+	if err != nil {
+		log.WithError(err).Errorf("failed to rotate pages")
+		return nil, fmt.Errorf("failed to rotate pages: %w", err)
+	}
+	pageCount, err := writeDocument(fileHandler, output.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	info.Metadata["PDFRotate.PageCount"] = pageCount
+	return info, nil
+}
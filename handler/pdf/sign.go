@@ -0,0 +1,559 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"software.sslmate.com/src/go-pkcs12"
+	"strings"
+	"time"
+)
+
+const (
+	// byteRangePlaceholder is replaced once the signature's position is known, so it must be as wide as the byte range
+	byteRangePlaceholder = "[0 0000000000 0000000000 0000000000]"
+	byteRangeFormat      = "[0 %010d %010d %010d]"
+	// annotationPrintFlag and annotationLockedFlag make the signature printed and unchangeable
+	annotationPrintFlag  = 4
+	annotationLockedFlag = 128
+	// sigFlags marks the document as signed and to be changed only by appending, i.e. SignaturesExist and AppendOnly
+	sigFlags = 3
+)
+
+var defaultSignatureRect = []float64{36, 36, 236, 96}
+
+// SignHandler signs the session's PDF with a PAdES baseline (B-B) signature, appended as an incremental update,
+// so earlier signatures stay valid.
+type SignHandler struct {
+	definitions.BaseHandler
+	config *signConfig
+}
+
+type signConfig struct {
+	PKCS12File         string `mapstructure:"pkcs12_file,omitempty"`
+	PKCS12Password     string `mapstructure:"pkcs12_password,omitempty"`
+	PKCS12PasswordFile string `mapstructure:"pkcs12_password_file,omitempty"`
+	// CertificateFile is a PEM file of the signing certificate, followed by its chain
+	CertificateFile string `mapstructure:"certificate_file,omitempty"`
+	// KeyFile is a PEM file of the unencrypted private key, in PKCS #8, PKCS #1 or SEC 1
+	KeyFile     string `mapstructure:"key_file,omitempty"`
+	Reason      string `mapstructure:"reason,omitempty"`
+	Location    string `mapstructure:"location,omitempty"`
+	ContactInfo string `mapstructure:"contact_info,omitempty"`
+	// SignerName is the signer's name to show, the certificate's common name by default
+	SignerName string `mapstructure:"name,omitempty"`
+	// Visible adds an appearance with the signature's details, the signature is invisible otherwise
+	Visible bool      `mapstructure:"visible,omitempty"`
+	Page    int       `mapstructure:"page,omitempty"`
+	Rect    []float64 `mapstructure:"rect,omitempty"`
+	// FieldName is the signature field's name, `Signature<N>` by default
+	FieldName string `mapstructure:"field_name,omitempty"`
+}
+
+type signer struct {
+	certificate *x509.Certificate
+	chain       []*x509.Certificate
+	key         crypto.Signer
+}
+
+type signatureDetails struct {
+	name        string
+	reason      string
+	location    string
+	contactInfo string
+	time        time.Time
+}
+
+func NewSignHandler(idPrefix string, c map[string]interface{}) (*SignHandler, error) {
+	h := &SignHandler{
+		BaseHandler: definitions.BaseHandler{
+			ID: idPrefix + "_pdf_sign",
+		},
+	}
+	err := h.setConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *SignHandler) setConfig(config map[string]interface{}) error {
+	h.config = &signConfig{
+		Page: 1,
+		// a copy, the decoder writes the configured rect into it
+		Rect: append([]float64{}, defaultSignatureRect...),
+	}
+	err := h.DecodeMap(config, h.config)
+	if err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+	usesPEM := h.config.CertificateFile != "" || h.config.KeyFile != ""
+	if h.config.PKCS12File == "" && !usesPEM {
+		return errors.New("pkcs12_file, or certificate_file and key_file are required")
+	}
+	if h.config.PKCS12File != "" && usesPEM {
+		return errors.New("pkcs12_file can't be used together with certificate_file and key_file")
+	}
+	if usesPEM && (h.config.CertificateFile == "" || h.config.KeyFile == "") {
+		return errors.New("certificate_file and key_file must be used together")
+	}
+	if h.config.PKCS12Password != "" && h.config.PKCS12PasswordFile != "" {
+		return errors.New("pkcs12_password and pkcs12_password_file can't be used together")
+	}
+	if h.config.Page < 1 {
+		return fmt.Errorf("invalid page %d", h.config.Page)
+	}
+	if len(h.config.Rect) != 4 || h.config.Rect[2] <= h.config.Rect[0] || h.config.Rect[3] <= h.config.Rect[1] {
+		return fmt.Errorf("invalid rect %v, should be [left bottom right top]", h.config.Rect)
+	}
+	if strings.Contains(h.config.FieldName, ".") {
+		return fmt.Errorf("invalid field name %s, it can't contain periods", h.config.FieldName)
+	}
+	return nil
+}
+
+func (h *SignHandler) Name() string {
+	return "PDFSign"
+}
+
+func (h *SignHandler) Outputs() []string {
+	return []string{"Signer", "SigningTime", "FieldName"}
+}
+
+func (h *SignHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	s, err := h.loadSigner(info)
+	if err != nil {
+		log.WithError(err).Errorf("failed to load signing certificate")
+		return nil, fmt.Errorf("failed to load signing certificate: %w", err)
+	}
+	details, err := h.evaluateDetails(info, s)
+	if err != nil {
+		return nil, err
+	}
+	document, err := readDocument(fileHandler)
+	if err != nil {
+		return nil, err
+	}
+	original := make([]byte, document.Size())
+	_, err = document.ReadAt(original, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	// the PDF is only read, since the signature has to be appended to its bytes as they are
+	ctx, err := api.ReadContext(document, newConfiguration())
+	if err != nil {
+		log.WithError(err).Errorf("failed to read PDF")
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+	if ctx.E != nil {
+		return nil, errors.New("encrypted PDFs can't be signed, decrypt it first")
+	}
+	fieldName, err := h.getFieldName(ctx)
+	if err != nil {
+		log.WithError(err).Errorf("failed to read signature fields")
+		return nil, fmt.Errorf("failed to read signature fields: %w", err)
+	}
+
+	placeholderSize := getSignaturePlaceholderSize(s)
+	update, err := newIncrementalUpdate(original, ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = h.addSignatureField(ctx, update, fieldName, details, placeholderSize)
+	if err != nil {
+		log.WithError(err).Errorf("failed to add signature field")
+		return nil, fmt.Errorf("failed to add signature field: %w", err)
+	}
+	signed, err := update.write()
+	if err != nil {
+		log.WithError(err).Errorf("failed to write PDF")
+		return nil, fmt.Errorf("failed to write PDF: %w", err)
+	}
+	err = sign(signed, len(original), placeholderSize, s)
+	if err != nil {
+		log.WithError(err).Errorf("failed to sign PDF")
+		return nil, fmt.Errorf("failed to sign PDF: %w", err)
+	}
+	err = writeContents(fileHandler, signed)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("signed PDF as %s in field %s", details.name, fieldName)
+
+	info.Metadata["PDFSign.Signer"] = details.name
+	info.Metadata["PDFSign.SigningTime"] = details.time.Format(time.RFC3339)
+	info.Metadata["PDFSign.FieldName"] = fieldName
+	return info, nil
+}
+
+func (h *SignHandler) evaluateDetails(info *definitions.EngineFlowObject, s *signer) (*signatureDetails, error) {
+	details := &signatureDetails{time: time.Now()}
+	values := []struct {
+		key   string
+		value string
+		out   *string
+	}{
+		{"name", h.config.SignerName, &details.name},
+		{"reason", h.config.Reason, &details.reason},
+		{"location", h.config.Location, &details.location},
+		{"contact info", h.config.ContactInfo, &details.contactInfo},
+	}
+	for _, v := range values {
+		evaluated, err := info.EvaluateExpression(v.value)
+		if err != nil {
+			log.WithError(err).Errorf("failed to evaluate %s", v.key)
+			return nil, fmt.Errorf("failed to evaluate %s: %w", v.key, err)
+		}
+		*v.out = evaluated
+	}
+	if details.name == "" {
+		details.name = s.certificate.Subject.CommonName
+	}
+	return details, nil
+}
+
+func (h *SignHandler) loadSigner(info *definitions.EngineFlowObject) (*signer, error) {
+	if h.config.PKCS12File != "" {
+		path, err := info.EvaluateExpression(h.config.PKCS12File)
+		if err != nil {
+			return nil, err
+		}
+		password, err := evaluatePassword(info, h.config.PKCS12Password, h.config.PKCS12PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get PKCS #12 password: %w", err)
+		}
+		return loadPKCS12(path, password)
+	}
+	certificatePath, err := info.EvaluateExpression(h.config.CertificateFile)
+	if err != nil {
+		return nil, err
+	}
+	keyPath, err := info.EvaluateExpression(h.config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return loadPEM(certificatePath, keyPath)
+}
+
+func loadPKCS12(path string, password string) (*signer, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, certificate, chain, err := pkcs12.DecodeChain(contents, password)
+	if err != nil {
+		return nil, err
+	}
+	return newSigner(certificate, chain, key)
+}
+
+func loadPEM(certificatePath string, keyPath string) (*signer, error) {
+	certificates, err := readCertificates(certificatePath)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, fmt.Errorf("%s has no PEM key", keyPath)
+	}
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key: %w", err)
+	}
+	return newSigner(certificates[0], certificates[1:], key)
+}
+
+// readCertificates reads all the certificates of a PEM file.
+func readCertificates(path string) ([]*x509.Certificate, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var certificates []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, contents = pem.Decode(contents)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("%s has no PEM certificates", path)
+	}
+	return certificates, nil
+}
+
+func newSigner(certificate *x509.Certificate, chain []*x509.Certificate, key interface{}) (*signer, error) {
+	s, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errUnsupportedSigningKeys
+	}
+	if _, err := getSignatureAlgorithm(s); err != nil {
+		return nil, err
+	}
+	publicKey, ok := s.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !publicKey.Equal(certificate.PublicKey) {
+		return nil, errors.New("the key doesn't match the certificate")
+	}
+	return &signer{certificate: certificate, chain: chain, key: s}, nil
+}
+
+// getSignaturePlaceholderSize returns the number of bytes reserved for the CMS, which holds the certificates.
+func getSignaturePlaceholderSize(s *signer) int {
+	size := len(s.certificate.Raw) + 4096
+	for _, c := range s.chain {
+		size += len(c.Raw)
+	}
+	return max(size, 8192)
+}
+
+// getFieldName returns the configured field name, or the next free `Signature<N>`.
+func (h *SignHandler) getFieldName(ctx *model.Context) (string, error) {
+	fields, err := getSignatureFields(ctx)
+	if err != nil {
+		return "", err
+	}
+	names := map[string]bool{}
+	for _, f := range fields {
+		names[f.name] = true
+	}
+	if h.config.FieldName != "" {
+		if names[h.config.FieldName] {
+			return "", fmt.Errorf("field %s already exists", h.config.FieldName)
+		}
+		return h.config.FieldName, nil
+	}
+	for i := len(fields) + 1; ; i++ {
+		name := fmt.Sprintf("Signature%d", i)
+		if !names[name] {
+			return name, nil
+		}
+	}
+}
+
+// addSignatureField adds the signature dictionary with placeholders, its field and widget,
+// and updates the page's annotations and the catalog's form to include them.
+func (h *SignHandler) addSignatureField(ctx *model.Context, update *incrementalUpdate, fieldName string, details *signatureDetails, placeholderSize int) error {
+	err := ctx.EnsurePageCount()
+	if err != nil {
+		return err
+	}
+	if h.config.Page > ctx.PageCount {
+		return fmt.Errorf("page %d doesn't exist, the PDF has %d pages", h.config.Page, ctx.PageCount)
+	}
+	page, pageReference, _, err := ctx.PageDict(h.config.Page, false)
+	if err != nil {
+		return err
+	}
+
+	signature, err := newTextDict(map[string]string{
+		"Name":        details.name,
+		"Reason":      details.reason,
+		"Location":    details.location,
+		"ContactInfo": details.contactInfo,
+	})
+	if err != nil {
+		return err
+	}
+	signature.Insert("Type", types.Name("Sig"))
+	signature.Insert("Filter", types.Name("Adobe.PPKLite"))
+	signature.Insert("SubFilter", types.Name("ETSI.CAdES.detached"))
+	signature.Insert("M", types.StringLiteral(types.DateString(details.time)))
+	signatureReference := update.add(fmt.Sprintf("<</ByteRange %s/Contents <%s>%s",
+		byteRangePlaceholder, strings.Repeat("0", placeholderSize*2), strings.TrimPrefix(signature.PDFString(), "<<")))
+
+	fieldTitle, err := encodeText(fieldName)
+	if err != nil {
+		return err
+	}
+	widget := types.Dict{
+		"Type":    types.Name("Annot"),
+		"Subtype": types.Name("Widget"),
+		"FT":      types.Name("Sig"),
+		"T":       types.StringLiteral(fieldTitle),
+		"V":       signatureReference,
+		"F":       types.Integer(annotationPrintFlag | annotationLockedFlag),
+		"P":       *pageReference,
+		"Rect":    types.NewNumberArray(0, 0, 0, 0),
+	}
+	if h.config.Visible {
+		rect := h.config.Rect
+		widget["Rect"] = types.NewNumberArray(rect...)
+		fontReference := update.add(types.Dict{
+			"Type":     types.Name("Font"),
+			"Subtype":  types.Name("Type1"),
+			"BaseFont": types.Name("Helvetica"),
+			"Encoding": types.Name("WinAnsiEncoding"),
+		}.PDFString())
+		appearance := getSignatureAppearance(details, rect[2]-rect[0], rect[3]-rect[1], fontReference)
+		widget["AP"] = types.Dict{"N": update.add(appearance)}
+	}
+	widgetReference := update.add(widget.PDFString())
+
+	annotations, err := ctx.DereferenceArray(page["Annots"])
+	if err != nil {
+		return err
+	}
+	page = page.Clone().(types.Dict)
+	page["Annots"] = append(append(types.Array{}, annotations...), widgetReference)
+	update.replace(*pageReference, page.PDFString())
+
+	return addFormField(ctx, update, widgetReference)
+}
+
+// addFormField adds the field to the catalog's form, creating it if needed.
+func addFormField(ctx *model.Context, update *incrementalUpdate, fieldReference types.IndirectRef) error {
+	catalog, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+	catalog = catalog.Clone().(types.Dict)
+	formReference, isReference := catalog["AcroForm"].(types.IndirectRef)
+	form, err := ctx.DereferenceDict(catalog["AcroForm"])
+	if err != nil {
+		return err
+	}
+	if form == nil {
+		form = types.NewDict()
+	} else {
+		form = form.Clone().(types.Dict)
+	}
+	fields, err := ctx.DereferenceArray(form["Fields"])
+	if err != nil {
+		return err
+	}
+	form["Fields"] = append(append(types.Array{}, fields...), fieldReference)
+	form["SigFlags"] = types.Integer(sigFlags)
+
+	if isReference {
+		update.replace(formReference, form.PDFString())
+		return nil
+	}
+	catalog["AcroForm"] = form
+	update.replace(*ctx.Root, catalog.PDFString())
+	return nil
+}
+
+// newTextDict returns a dictionary of the non-empty text values.
+func newTextDict(values map[string]string) (types.Dict, error) {
+	d := types.NewDict()
+	for key, value := range values {
+		if value == "" {
+			continue
+		}
+		encoded, err := encodeText(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", key, err)
+		}
+		d.Insert(key, types.StringLiteral(encoded))
+	}
+	return d, nil
+}
+
+// getSignatureAppearance returns a form XObject listing the signature's details, sized to fit the rect.
+func getSignatureAppearance(details *signatureDetails, width float64, height float64, fontReference types.IndirectRef) string {
+	lines := []string{"Digitally signed by " + details.name, "Date: " + details.time.Format("2006-01-02 15:04:05 -07:00")}
+	if details.reason != "" {
+		lines = append(lines, "Reason: "+details.reason)
+	}
+	if details.location != "" {
+		lines = append(lines, "Location: "+details.location)
+	}
+	fontSize := min(10, height/(float64(len(lines))*1.2+0.5))
+
+	content := &strings.Builder{}
+	fmt.Fprintf(content, "BT\n/F1 %.2f Tf\n%.2f TL\n%.2f %.2f Td\n", fontSize, fontSize*1.2, fontSize/2, height-fontSize*1.2)
+	for i, line := range lines {
+		if i > 0 {
+			content.WriteString("T*\n")
+		}
+		fmt.Fprintf(content, "(%s) Tj\n", escapeWinAnsi(line))
+	}
+	content.WriteString("ET")
+
+	d := types.Dict{
+		"Type":      types.Name("XObject"),
+		"Subtype":   types.Name("Form"),
+		"BBox":      types.NewNumberArray(0, 0, width, height),
+		"Resources": types.Dict{"Font": types.Dict{"F1": fontReference}},
+		"Length":    types.Integer(content.Len()),
+	}
+	return fmt.Sprintf("%s\nstream\n%s\nendstream", d.PDFString(), content.String())
+}
+
+// escapeWinAnsi escapes a string for a WinAnsi font, replacing the characters it doesn't have.
+func escapeWinAnsi(s string) string {
+	escaped := &strings.Builder{}
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			escaped.WriteRune('\\')
+			escaped.WriteRune(r)
+		case r >= ' ' && r <= '~':
+			escaped.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(escaped, "\\%03o", r)
+		default:
+			escaped.WriteRune('?')
+		}
+	}
+	return escaped.String()
+}
+
+// sign fills in the byte range of the update, and the CMS signature of the bytes it covers.
+func sign(document []byte, updateOffset int, placeholderSize int, s *signer) error {
+	update := document[updateOffset:]
+	byteRangeIndex := bytes.Index(update, []byte("/ByteRange "+byteRangePlaceholder))
+	contentsIndex := bytes.Index(update, []byte("/Contents <"+strings.Repeat("0", placeholderSize*2)+">"))
+	if byteRangeIndex < 0 || contentsIndex < 0 {
+		return errors.New("signature placeholders not found")
+	}
+	byteRangeStart := updateOffset + byteRangeIndex + len("/ByteRange ")
+	contentsStart := updateOffset + contentsIndex + len("/Contents ")
+	contentsEnd := contentsStart + placeholderSize*2 + 2
+
+	byteRange := fmt.Sprintf(byteRangeFormat, contentsStart, contentsEnd, len(document)-contentsEnd)
+	copy(document[byteRangeStart:], byteRange)
+
+	content := append(append([]byte{}, document[:contentsStart]...), document[contentsEnd:]...)
+	cms, err := createCMS(content, s.certificate, s.chain, s.key)
+	if err != nil {
+		return err
+	}
+	if len(cms) > placeholderSize {
+		return fmt.Errorf("signature of %d bytes is larger than the %d reserved", len(cms), placeholderSize)
+	}
+	copy(document[contentsStart+1:], strings.ToUpper(hex.EncodeToString(cms)))
+	return nil
+}
@@ -0,0 +1,190 @@
+package pdf
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"os"
+	"path/filepath"
+	"software.sslmate.com/src/go-pkcs12"
+	"testing"
+	"time"
+)
+
+func createCertificate(t *testing.T, key crypto.Signer) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(42),
+		Subject:               pkix.Name{CommonName: "Alice Signer", Organization: []string{"Printers Inc"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return certificate
+}
+
+// writePEM writes the certificate and key as PEM files, and returns their paths.
+func writePEM(t *testing.T, certificate *x509.Certificate, key crypto.Signer) (string, string) {
+	dir := t.TempDir()
+	certificateFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(certificateFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw}), 0600))
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes}), 0600))
+	return certificateFile, keyFile
+}
+
+func TestSignHandler_PEM(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	certificate := createCertificate(t, key)
+	certificateFile, keyFile := writePEM(t, certificate, key)
+
+	document := createPDF(t, 2)
+	signed, metadata := handle(t, NewSignHandler, map[string]interface{}{
+		"certificate_file": certificateFile,
+		"key_file":         keyFile,
+		"reason":           `Printed by ${$env["Job.User"]}`,
+		"location":         "Tel Aviv",
+	}, document)
+	assert.Equal(t, "Alice Signer", metadata["PDFSign.Signer"])
+	assert.Equal(t, "Signature1", metadata["PDFSign.FieldName"])
+	assert.NotEmpty(t, metadata["PDFSign.SigningTime"])
+	assert.True(t, bytes.HasPrefix(signed, document), "the signature should be appended")
+	assert.Equal(t, 2, pageCount(t, signed))
+
+	_, metadata = handle(t, NewVerifySignatureHandler, map[string]interface{}{}, signed)
+	assert.Equal(t, true, metadata["PDFVerifySignature.Signed"])
+	assert.Equal(t, true, metadata["PDFVerifySignature.Valid"], metadata["PDFVerifySignature.Error"])
+	assert.Equal(t, "Alice Signer", metadata["PDFVerifySignature.Signer"])
+	signatures := metadata["PDFVerifySignature.Signatures"].([]map[string]interface{})
+	assert.Len(t, signatures, 1)
+	assert.Equal(t, "Signature1", signatures[0]["Name"])
+	assert.Equal(t, "Printed by alice", signatures[0]["Reason"])
+	assert.Equal(t, "Tel Aviv", signatures[0]["Location"])
+	assert.Equal(t, true, signatures[0]["CoversWholeDocument"])
+
+	// only the signer's certificate is trusted
+	_, metadata = handle(t, NewVerifySignatureHandler, map[string]interface{}{"trusted_certificates": certificateFile}, signed)
+	assert.Equal(t, true, metadata["PDFVerifySignature.Valid"], metadata["PDFVerifySignature.Error"])
+}
+
+func TestSignHandler_PKCS12(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	certificate := createCertificate(t, key)
+	contents, err := pkcs12.Modern.Encode(key, certificate, nil, "p12-secret")
+	assert.NoError(t, err)
+	pkcs12File := filepath.Join(t.TempDir(), "signer.p12")
+	assert.NoError(t, os.WriteFile(pkcs12File, contents, 0600))
+
+	config := map[string]interface{}{
+		"pkcs12_file":     pkcs12File,
+		"pkcs12_password": "p12-secret",
+		"visible":         true,
+		"page":            2,
+		"name":            "Print Server",
+	}
+	signed, metadata := handle(t, NewSignHandler, config, createPDF(t, 2))
+	assert.Equal(t, "Print Server", metadata["PDFSign.Signer"])
+
+	// a second signature keeps the first one valid
+	signedTwice, metadata := handle(t, NewSignHandler, config, signed)
+	assert.Equal(t, "Signature2", metadata["PDFSign.FieldName"])
+
+	_, metadata = handle(t, NewVerifySignatureHandler, map[string]interface{}{}, signedTwice)
+	assert.Equal(t, true, metadata["PDFVerifySignature.Valid"], metadata["PDFVerifySignature.Error"])
+	signatures := metadata["PDFVerifySignature.Signatures"].([]map[string]interface{})
+	assert.Len(t, signatures, 2)
+	assert.Equal(t, false, signatures[0]["CoversWholeDocument"])
+	assert.Equal(t, true, signatures[1]["CoversWholeDocument"])
+
+	ctx, err := api.ReadContext(bytes.NewReader(signedTwice), newConfiguration())
+	assert.NoError(t, err)
+	assert.NoError(t, api.ValidateContext(ctx))
+	page, _, _, err := ctx.PageDict(2, false)
+	assert.NoError(t, err)
+	annotations, err := ctx.DereferenceArray(page["Annots"])
+	assert.NoError(t, err)
+	assert.Len(t, annotations, 2)
+}
+
+func TestVerifySignatureHandler_Tampered(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	certificateFile, keyFile := writePEM(t, createCertificate(t, key), key)
+	signed, _ := handle(t, NewSignHandler, map[string]interface{}{"certificate_file": certificateFile, "key_file": keyFile}, createPDF(t, 1))
+
+	i := bytes.Index(signed, []byte("/MediaBox"))
+	assert.Greater(t, i, 0)
+	tampered := append([]byte{}, signed...)
+	tampered[i+1] = 'm'
+
+	_, metadata := handle(t, NewVerifySignatureHandler, map[string]interface{}{}, tampered)
+	assert.Equal(t, true, metadata["PDFVerifySignature.Signed"])
+	assert.Equal(t, false, metadata["PDFVerifySignature.Valid"])
+	assert.Contains(t, metadata["PDFVerifySignature.Error"], "Signature1")
+
+	h, err := NewVerifySignatureHandler("test", map[string]interface{}{"fail_on_invalid": true})
+	assert.NoError(t, err)
+	_, err = h.Handle(newFlowObject(), newFileHandler(tampered))
+	assert.Error(t, err)
+
+	// another certificate isn't trusted
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	otherCertificateFile, _ := writePEM(t, createCertificate(t, otherKey), otherKey)
+	_, metadata = handle(t, NewVerifySignatureHandler, map[string]interface{}{"trusted_certificates": otherCertificateFile}, signed)
+	assert.Equal(t, false, metadata["PDFVerifySignature.Valid"])
+}
+
+func TestVerifySignatureHandler_ChangedAfterSigning(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	certificateFile, keyFile := writePEM(t, createCertificate(t, key), key)
+	signed, _ := handle(t, NewSignHandler, map[string]interface{}{"certificate_file": certificateFile, "key_file": keyFile}, createPDF(t, 1))
+	changed := append(append([]byte{}, signed...), "\n% appended after signing\n"...)
+
+	_, metadata := handle(t, NewVerifySignatureHandler, map[string]interface{}{}, changed)
+	assert.Equal(t, true, metadata["PDFVerifySignature.Signed"])
+	assert.Equal(t, false, metadata["PDFVerifySignature.Valid"])
+	assert.Equal(t, "the PDF was changed after its last signature", metadata["PDFVerifySignature.Error"])
+	signatures := metadata["PDFVerifySignature.Signatures"].([]map[string]interface{})
+	assert.Equal(t, true, signatures[0]["Valid"])
+	assert.Equal(t, false, signatures[0]["CoversWholeDocument"])
+
+	h, err := NewVerifySignatureHandler("test", map[string]interface{}{"fail_on_invalid": true})
+	assert.NoError(t, err)
+	_, err = h.Handle(newFlowObject(), newFileHandler(changed))
+	assert.EqualError(t, err, "the PDF was changed after its last signature")
+}
+
+func TestVerifySignatureHandler_Unsigned(t *testing.T) {
+	_, metadata := handle(t, NewVerifySignatureHandler, map[string]interface{}{}, createPDF(t, 1))
+	assert.Equal(t, false, metadata["PDFVerifySignature.Signed"])
+	assert.Equal(t, false, metadata["PDFVerifySignature.Valid"])
+	assert.Empty(t, metadata["PDFVerifySignature.Signatures"])
+}
+
+func TestSignHandler_RejectedRectKeepsTheDefault(t *testing.T) {
+	_, err := NewSignHandler("test", map[string]interface{}{"pkcs12_file": "a.p12", "rect": []float64{10, 10, 5, 20}})
+	assert.Error(t, err)
+	h, err := NewSignHandler("test", map[string]interface{}{"pkcs12_file": "a.p12"})
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{36, 36, 236, 96}, h.config.Rect)
+}
@@ -0,0 +1,157 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/utils"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"path/filepath"
+)
+
+// SplitHandler splits the session's PDF into parts, which are written to a directory.
+// The session's contents stay the whole document.
+type SplitHandler struct {
+	definitions.BaseHandler
+	config *splitConfig
+}
+
+type splitConfig struct {
+	OutputDir string `mapstructure:"output_dir"`
+	Filename  string `mapstructure:"filename,omitempty"`
+	// Span splits the document every Span pages
+	Span int `mapstructure:"span,omitempty"`
+	// Ranges splits the document into a part per page range, e.g. `1-3` or `4-`
+	Ranges []string `mapstructure:"ranges,omitempty"`
+}
+
+func NewSplitHandler(idPrefix string, c map[string]interface{}) (*SplitHandler, error) {
+	h := &SplitHandler{
+		BaseHandler: definitions.BaseHandler{
+			ID: idPrefix + "_pdf_split",
+		},
+	}
+	err := h.setConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *SplitHandler) setConfig(config map[string]interface{}) error {
+	h.config = &splitConfig{}
+	err := h.DecodeMap(config, h.config)
+	if err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+	if h.config.OutputDir == "" {
+		return errors.New("output_dir is required")
+	}
+	if h.config.Span > 0 && len(h.config.Ranges) > 0 {
+		return errors.New("span and ranges can't be used together")
+	}
+	if h.config.Span < 0 {
+		return errors.New("span must be positive")
+	}
+	if h.config.Span == 0 && len(h.config.Ranges) == 0 {
+		h.config.Span = 1
+	}
+	if h.config.Filename == "" {
+		h.config.Filename = "part"
+	}
+	return nil
+}
+
+func (h *SplitHandler) Name() string {
+	return "PDFSplit"
+}
+
+func (h *SplitHandler) Outputs() []string {
+	return []string{"Files", "PartCount", "PageCounts"}
+}
+
+func (h *SplitHandler) Destinations() []string {
+	return []string{"Files"}
+}
+
+func (h *SplitHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	outputDir, err := info.EvaluateExpression(h.config.OutputDir)
+	if err != nil {
+		log.WithError(err).Errorf("failed to evaluate output dir")
+		return nil, fmt.Errorf("failed to evaluate output dir: %w", err)
+	}
+	filename, err := info.EvaluateExpression(h.config.Filename)
+	if err != nil {
+		log.WithError(err).Errorf("failed to evaluate filename")
+		return nil, fmt.Errorf("failed to evaluate filename: %w", err)
+	}
+	document, err := readDocument(fileHandler)
+	if err != nil {
+		return nil, err
+	}
+
+	parts, err := h.split(document)
+	if err != nil {
+		log.WithError(err).Errorf("failed to split PDF")
+		return nil, fmt.Errorf("failed to split PDF: %w", err)
+	}
+
+	var files []string
+	var pageCounts []int
+	for i, part := range parts {
+		pages, err := api.PageCount(bytes.NewReader(part), newConfiguration())
+		if err != nil {
+			return nil, fmt.Errorf("failed to count pages of part %d: %w", i+1, err)
+		}
+		path := filepath.Join(outputDir, fmt.Sprintf("%s_%d.pdf", filename, i+1))
+		log.Debugf("writing part %d with %d pages to %s", i+1, pages, path)
+		files = append(files, path)
+		pageCounts = append(pageCounts, pages)
+	}
+	// none of the parts are left behind if one of them can't be written
+	err = utils.WriteFiles(files, parts)
+	if err != nil {
+		log.WithError(err).Errorf("failed to write the parts")
+		return nil, err
+	}
+
+	info.Metadata["PDFSplit.Files"] = files
+	info.Metadata["PDFSplit.PartCount"] = len(files)
+	info.Metadata["PDFSplit.PageCounts"] = pageCounts
+	return info, nil
+}
+
+func (h *SplitHandler) split(document io.ReadSeeker) ([][]byte, error) {
+	var parts [][]byte
+	if h.config.Span > 0 {
+		spans, err := api.SplitRaw(document, h.config.Span, newConfiguration())
+		if err != nil {
+			return nil, err
+		}
+		for _, span := range spans {
+			part, err := io.ReadAll(span.Reader)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+		}
+		return parts, nil
+	}
+
+	for _, pageRange := range h.config.Ranges {
+		_, err := document.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+		part := &bytes.Buffer{}
+		err = api.Trim(document, part, []string{pageRange}, newConfiguration())
+		if err != nil {
+			return nil, fmt.Errorf("invalid range %s: %w", pageRange, err)
+		}
+		parts = append(parts, part.Bytes())
+	}
+	return parts, nil
+}
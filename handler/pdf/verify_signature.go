@@ -0,0 +1,329 @@
+package pdf
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/digitorus/pkcs7"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	log "github.com/sirupsen/logrus"
+)
+
+// VerifySignatureHandler verifies the session PDF's signatures, and writes the results into the metadata.
+type VerifySignatureHandler struct {
+	definitions.BaseHandler
+	config *verifySignatureConfig
+}
+
+type verifySignatureConfig struct {
+	// TrustedCertificates is a PEM file of the certificates to verify the signers' chains against,
+	// only the signatures themselves are verified without it
+	TrustedCertificates string `mapstructure:"trusted_certificates,omitempty"`
+	FailOnInvalid       bool   `mapstructure:"fail_on_invalid,omitempty"`
+}
+
+type signatureField struct {
+	name string
+	// value is the signature dictionary, nil if the field isn't signed
+	value types.Dict
+}
+
+// detachedSubFilters are the signature formats whose CMS doesn't hold the signed content.
+var detachedSubFilters = map[string]bool{"ETSI.CAdES.detached": true, "adbe.pkcs7.detached": true}
+
+func NewVerifySignatureHandler(idPrefix string, c map[string]interface{}) (*VerifySignatureHandler, error) {
+	h := &VerifySignatureHandler{
+		BaseHandler: definitions.BaseHandler{
+			ID: idPrefix + "_pdf_verify_signature",
+		},
+	}
+	err := h.setConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *VerifySignatureHandler) setConfig(config map[string]interface{}) error {
+	h.config = &verifySignatureConfig{}
+	err := h.DecodeMap(config, h.config)
+	if err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+	return nil
+}
+
+func (h *VerifySignatureHandler) Name() string {
+	return "PDFVerifySignature"
+}
+
+func (h *VerifySignatureHandler) Outputs() []string {
+	return []string{"Signed", "Valid", "Signer", "Error", "Signatures"}
+}
+
+func (h *VerifySignatureHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	var trusted *x509.CertPool
+	if h.config.TrustedCertificates != "" {
+		path, err := info.EvaluateExpression(h.config.TrustedCertificates)
+		if err != nil {
+			log.WithError(err).Errorf("failed to evaluate trusted certificates")
+			return nil, fmt.Errorf("failed to evaluate trusted certificates: %w", err)
+		}
+		certificates, err := readCertificates(path)
+		if err != nil {
+			log.WithError(err).Errorf("failed to read trusted certificates")
+			return nil, fmt.Errorf("failed to read trusted certificates: %w", err)
+		}
+		trusted = x509.NewCertPool()
+		for _, c := range certificates {
+			trusted.AddCert(c)
+		}
+	}
+	document, err := readDocument(fileHandler)
+	if err != nil {
+		return nil, err
+	}
+	contents := make([]byte, document.Size())
+	_, err = document.ReadAt(contents, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	ctx, err := api.ReadContext(document, newConfiguration())
+	if err != nil {
+		log.WithError(err).Errorf("failed to read PDF")
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+	fields, err := getSignatureFields(ctx)
+	if err != nil {
+		log.WithError(err).Errorf("failed to read signature fields")
+		return nil, fmt.Errorf("failed to read signature fields: %w", err)
+	}
+
+	signatures := []map[string]interface{}{}
+	valid := true
+	signer, firstError := "", ""
+	for _, field := range fields {
+		if field.value == nil {
+			continue
+		}
+		result := verifySignature(contents, field, trusted)
+		signatures = append(signatures, result)
+		signer = result["Signer"].(string)
+		if !result["Valid"].(bool) {
+			log.Warnf("signature %s is invalid: %s", field.name, result["Error"])
+			valid = false
+			if firstError == "" {
+				firstError = fmt.Sprintf("%s: %s", field.name, result["Error"])
+			}
+		}
+	}
+	signed := len(signatures) > 0
+	valid = valid && signed
+	// only the last signature can cover the whole document, anything else was appended after it
+	changed := valid && !coversWholeDocument(signatures)
+	if changed {
+		log.Warnf("the PDF was changed after its last signature")
+		valid = false
+		firstError = "the PDF was changed after its last signature"
+	}
+	log.Debugf("verified %d signatures, valid: %t", len(signatures), valid)
+
+	info.Metadata["PDFVerifySignature.Signed"] = signed
+	info.Metadata["PDFVerifySignature.Valid"] = valid
+	info.Metadata["PDFVerifySignature.Signer"] = signer
+	info.Metadata["PDFVerifySignature.Error"] = firstError
+	info.Metadata["PDFVerifySignature.Signatures"] = signatures
+	if h.config.FailOnInvalid && !valid {
+		if !signed {
+			return nil, errors.New("the PDF isn't signed")
+		}
+		if changed {
+			return nil, errors.New(firstError)
+		}
+		return nil, fmt.Errorf("invalid signature %s", firstError)
+	}
+	return info, nil
+}
+
+func coversWholeDocument(signatures []map[string]interface{}) bool {
+	for _, signature := range signatures {
+		if signature["CoversWholeDocument"].(bool) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySignature verifies a signature field, and returns its details and result.
+func verifySignature(document []byte, field signatureField, trusted *x509.CertPool) map[string]interface{} {
+	result := map[string]interface{}{
+		"Name":                field.name,
+		"Signer":              getTextEntry(field.value, "Name"),
+		"Reason":              getTextEntry(field.value, "Reason"),
+		"Location":            getTextEntry(field.value, "Location"),
+		"SigningTime":         formatDate(getTextEntry(field.value, "M")),
+		"CoversWholeDocument": false,
+		"Valid":               false,
+		"Error":               "",
+	}
+	p7, coversWholeDocument, err := parseSignature(document, field.value)
+	if err == nil {
+		result["CoversWholeDocument"] = coversWholeDocument
+		if certificate := p7.GetOnlySigner(); certificate != nil {
+			result["Signer"] = certificate.Subject.CommonName
+		}
+		if trusted != nil {
+			err = p7.VerifyWithChain(trusted)
+		} else {
+			err = p7.Verify()
+		}
+	}
+	if err != nil {
+		result["Error"] = err.Error()
+		return result
+	}
+	result["Valid"] = true
+	return result
+}
+
+// parseSignature returns the signature's CMS with the content its byte range covers,
+// and whether the byte range covers the whole document, i.e. nothing was appended after signing.
+func parseSignature(document []byte, value types.Dict) (*pkcs7.PKCS7, bool, error) {
+	subFilter := value.NameEntry("SubFilter")
+	if subFilter == nil || !detachedSubFilters[*subFilter] {
+		return nil, false, fmt.Errorf("unsupported signature format %v", value["SubFilter"])
+	}
+	byteRange := value.ArrayEntry("ByteRange")
+	var offsets []int
+	for _, o := range byteRange {
+		i, ok := o.(types.Integer)
+		if !ok || i < 0 {
+			return nil, false, fmt.Errorf("invalid byte range %v", byteRange)
+		}
+		offsets = append(offsets, i.Value())
+	}
+	if len(offsets) != 4 || offsets[0] != 0 || offsets[1] > offsets[2] || offsets[2]+offsets[3] > len(document) {
+		return nil, false, fmt.Errorf("invalid byte range %v", byteRange)
+	}
+
+	var contents []byte
+	var err error
+	switch c := value["Contents"].(type) {
+	case types.HexLiteral:
+		contents, err = c.Bytes()
+	case types.StringLiteral:
+		contents, err = types.Unescape(c.Value())
+	default:
+		err = errors.New("the signature has no contents")
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	// the contents are padded with zeros after the CMS
+	raw := asn1.RawValue{}
+	_, err = asn1.Unmarshal(contents, &raw)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid signature contents: %w", err)
+	}
+	p7, err := pkcs7.Parse(raw.FullBytes)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid signature contents: %w", err)
+	}
+	p7.Content = append(append([]byte{}, document[:offsets[1]]...), document[offsets[2]:offsets[2]+offsets[3]]...)
+	return p7, offsets[2]+offsets[3] == len(document), nil
+}
+
+func getTextEntry(d types.Dict, key string) string {
+	if _, ok := d[key]; !ok {
+		return ""
+	}
+	text, err := model.Text(d[key])
+	if err != nil {
+		return ""
+	}
+	return text
+}
+
+// getSignatureFields returns the form's signature fields, with their fully qualified names.
+func getSignatureFields(ctx *model.Context) ([]signatureField, error) {
+	catalog, err := ctx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	form, err := ctx.DereferenceDict(catalog["AcroForm"])
+	if err != nil || form == nil {
+		return nil, err
+	}
+	fields, err := ctx.DereferenceArray(form["Fields"])
+	if err != nil {
+		return nil, err
+	}
+	var signatureFields []signatureField
+	visited := map[int]bool{}
+	for _, f := range fields {
+		signatureFields, err = appendSignatureFields(ctx, signatureFields, f, "", "", visited)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return signatureFields, nil
+}
+
+// appendSignatureFields appends the field's signature fields, or its kids', which inherit its name and type.
+func appendSignatureFields(ctx *model.Context, signatureFields []signatureField, o types.Object, parentName string, parentType string, visited map[int]bool) ([]signatureField, error) {
+	if reference, ok := o.(types.IndirectRef); ok {
+		// malformed forms can reference their own ancestors
+		if visited[reference.ObjectNumber.Value()] {
+			return signatureFields, nil
+		}
+		visited[reference.ObjectNumber.Value()] = true
+	}
+	field, err := ctx.DereferenceDict(o)
+	if err != nil || field == nil {
+		return signatureFields, err
+	}
+	name := parentName
+	if title := getTextEntry(field, "T"); title != "" {
+		name = title
+		if parentName != "" {
+			name = parentName + "." + title
+		}
+	}
+	fieldType := parentType
+	if t := field.NameEntry("FT"); t != nil {
+		fieldType = *t
+	}
+
+	kids, err := ctx.DereferenceArray(field["Kids"])
+	if err != nil {
+		return nil, err
+	}
+	hasKidFields := false
+	for _, kid := range kids {
+		// kids without a name are the field's widgets
+		d, err := ctx.DereferenceDict(kid)
+		if err != nil || d == nil || d["T"] == nil {
+			continue
+		}
+		hasKidFields = true
+		signatureFields, err = appendSignatureFields(ctx, signatureFields, kid, name, fieldType, visited)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if hasKidFields {
+		return signatureFields, nil
+	}
+	if fieldType != "Sig" {
+		return signatureFields, nil
+	}
+	value, err := ctx.DereferenceDict(field["V"])
+	if err != nil {
+		return nil, err
+	}
+	return append(signatureFields, signatureField{name: name, value: value}), nil
+}
@@ -0,0 +1,207 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+const (
+	watermarkText  = "text"
+	watermarkImage = "image"
+)
+
+var watermarkPositions = []string{"tl", "tc", "tr", "l", "c", "r", "bl", "bc", "br"}
+
+// WatermarkHandler stamps text or an image onto the pages of the session's PDF.
+type WatermarkHandler struct {
+	definitions.BaseHandler
+	config      *watermarkConfig
+	description string
+}
+
+type watermarkConfig struct {
+	// Type is text(default) or image
+	Type string `mapstructure:"type,omitempty"`
+	// Text is the text to stamp, pdfcpu replaces %p with the page number and %P with the page count
+	Text string `mapstructure:"text,omitempty"`
+	// Image is the path of the image to stamp
+	Image string `mapstructure:"image,omitempty"`
+	// Position is the stamp's anchor on the page, e.g. tl for top left or c(default) for center
+	Position string  `mapstructure:"position,omitempty"`
+	OffsetX  float64 `mapstructure:"offset_x,omitempty"`
+	OffsetY  float64 `mapstructure:"offset_y,omitempty"`
+	// Opacity is between 0 and 1, defaults to 1
+	Opacity float64 `mapstructure:"opacity,omitempty"`
+	// Rotation is counterclockwise in degrees
+	Rotation float64 `mapstructure:"rotation,omitempty"`
+	// Scale is the stamp's width relative to the page's, defaults to 0.5 unless FontSize is set
+	Scale    float64 `mapstructure:"scale,omitempty"`
+	FontName string  `mapstructure:"font_name,omitempty"`
+	FontSize int     `mapstructure:"font_size,omitempty"`
+	Color    string  `mapstructure:"color,omitempty"`
+	// Background puts the watermark behind the page's contents instead of stamping it on top
+	Background bool   `mapstructure:"background,omitempty"`
+	Pages      string `mapstructure:"pages,omitempty"`
+}
+
+func NewWatermarkHandler(idPrefix string, c map[string]interface{}) (*WatermarkHandler, error) {
+	h := &WatermarkHandler{
+		BaseHandler: definitions.BaseHandler{
+			ID: idPrefix + "_pdf_watermark",
+		},
+	}
+	err := h.setConfig(c)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (h *WatermarkHandler) setConfig(config map[string]interface{}) error {
+	h.config = &watermarkConfig{}
+	err := h.DecodeMap(config, h.config)
+	if err != nil {
+		return fmt.Errorf("failed to decode config: %w", err)
+	}
+	if h.config.Type == "" {
+		h.config.Type = watermarkText
+	}
+	switch h.config.Type {
+	case watermarkText:
+		if h.config.Text == "" {
+			return errors.New("text is required")
+		}
+	case watermarkImage:
+		if h.config.Image == "" {
+			return errors.New("image is required")
+		}
+	default:
+		return fmt.Errorf("invalid type %s, must be %s or %s", h.config.Type, watermarkText, watermarkImage)
+	}
+	if h.config.Position == "" {
+		h.config.Position = "c"
+	}
+	if !isWatermarkPosition(h.config.Position) {
+		return fmt.Errorf("invalid position %s, must be one of %s", h.config.Position, strings.Join(watermarkPositions, ", "))
+	}
+	if h.config.Opacity == 0 {
+		h.config.Opacity = 1
+	}
+	if h.config.Opacity < 0 || h.config.Opacity > 1 {
+		return errors.New("opacity must be between 0 and 1")
+	}
+	if h.config.Scale < 0 || h.config.FontSize < 0 {
+		return errors.New("scale and font_size must be positive")
+	}
+
+	h.description = h.getDescription()
+	// the content is only known when handling, so the description is validated with a placeholder
+	_, err = api.TextWatermark("placeholder", h.description, !h.config.Background, false, types.POINTS)
+	if err != nil {
+		return fmt.Errorf("invalid watermark: %w", err)
+	}
+	return nil
+}
+
+func isWatermarkPosition(position string) bool {
+	for _, p := range watermarkPositions {
+		if p == position {
+			return true
+		}
+	}
+	return false
+}
+
+// getDescription builds the pdfcpu watermark description, e.g. `position:c, opacity:1, rotation:0`.
+func (h *WatermarkHandler) getDescription() string {
+	parts := []string{
+		"position:" + h.config.Position,
+		fmt.Sprintf("offset:%g %g", h.config.OffsetX, h.config.OffsetY),
+		fmt.Sprintf("opacity:%g", h.config.Opacity),
+		fmt.Sprintf("rotation:%g", h.config.Rotation),
+	}
+	if h.config.Scale > 0 {
+		parts = append(parts, fmt.Sprintf("scalefactor:%g", h.config.Scale))
+	} else if h.config.FontSize > 0 {
+		// a relative scale would resize the text to the page's width, ignoring the font size
+		parts = append(parts, "scalefactor:1 abs")
+	}
+	if h.config.Type == watermarkText {
+		if h.config.FontName != "" {
+			parts = append(parts, "fontname:"+h.config.FontName)
+		}
+		if h.config.FontSize > 0 {
+			parts = append(parts, fmt.Sprintf("points:%d", h.config.FontSize))
+		}
+		if h.config.Color != "" {
+			parts = append(parts, "fillcolor:"+h.config.Color)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (h *WatermarkHandler) Name() string {
+	return "PDFWatermark"
+}
+
+func (h *WatermarkHandler) Outputs() []string {
+	return []string{"Content", "PageCount"}
+}
+
+func (h *WatermarkHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
+	pages, err := evaluatePages(info, h.config.Pages)
+	if err != nil {
+		return nil, err
+	}
+	watermark, content, err := h.getWatermark(info)
+	if err != nil {
+		log.WithError(err).Errorf("failed to create watermark")
+		return nil, fmt.Errorf("failed to create watermark: %w", err)
+	}
+	document, err := readDocument(fileHandler)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &bytes.Buffer{}
+	err = api.AddWatermarks(document, output, pages, watermark, newConfiguration())
+	if err != nil {
+		log.WithError(err).Errorf("failed to watermark PDF")
+		return nil, fmt.Errorf("failed to watermark PDF: %w", err)
+	}
+	pageCount, err := writeDocument(fileHandler, output.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	info.Metadata["PDFWatermark.Content"] = content
+	info.Metadata["PDFWatermark.PageCount"] = pageCount
+	return info, nil
+}
+
+// getWatermark evaluates the watermark's content, the text or the image path, and creates it.
+func (h *WatermarkHandler) getWatermark(info *definitions.EngineFlowObject) (*model.Watermark, string, error) {
+	onTop := !h.config.Background
+	if h.config.Type == watermarkImage {
+		image, err := info.EvaluateExpression(h.config.Image)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to evaluate image: %w", err)
+		}
+		watermark, err := api.ImageWatermark(image, h.description, onTop, false, types.POINTS)
+		return watermark, image, err
+	}
+
+	text, err := info.EvaluateExpression(h.config.Text)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to evaluate text: %w", err)
+	}
+	watermark, err := api.TextWatermark(text, h.description, onTop, false, types.POINTS)
+	return watermark, text, err
+}
@@ -0,0 +1,62 @@
+package pdf
+
+import (
+	"bytes"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWatermarkHandler_Text(t *testing.T) {
+	h, err := NewWatermarkHandler("test", map[string]interface{}{
+		"text":      `COPY - ${$env["Job.User"]}`,
+		"position":  "tr",
+		"opacity":   0.5,
+		"rotation":  45,
+		"font_size": 24,
+		"color":     "#ff0000",
+		"pages":     "1",
+	})
+	assert.NoError(t, err)
+
+	info := newFlowObject()
+	info.Metadata["Job.User"] = "alice"
+	fileHandler := newFileHandler(createPDF(t, 2))
+	info, err = h.Handle(info, fileHandler)
+	assert.NoError(t, err)
+	assert.Equal(t, "COPY - alice", info.Metadata["PDFWatermark.Content"])
+	assert.Equal(t, 2, info.Metadata["PDFWatermark.PageCount"])
+
+	watermarked, err := api.HasWatermarks(bytes.NewReader(fileHandler.writer.Bytes()), newConfiguration())
+	assert.NoError(t, err)
+	assert.True(t, watermarked)
+}
+
+func TestWatermarkHandler_Image(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stamp.png")
+	img := &bytes.Buffer{}
+	assert.NoError(t, png.Encode(img, image.NewRGBA(image.Rect(0, 0, 4, 4))))
+	assert.NoError(t, os.WriteFile(path, img.Bytes(), 0644))
+
+	h, err := NewWatermarkHandler("test", map[string]interface{}{
+		"type":       "image",
+		"image":      path,
+		"position":   "bl",
+		"scale":      0.2,
+		"background": true,
+	})
+	assert.NoError(t, err)
+
+	fileHandler := newFileHandler(createPDF(t, 1))
+	info, err := h.Handle(newFlowObject(), fileHandler)
+	assert.NoError(t, err)
+	assert.Equal(t, path, info.Metadata["PDFWatermark.Content"])
+
+	watermarked, err := api.HasWatermarks(bytes.NewReader(fileHandler.writer.Bytes()), newConfiguration())
+	assert.NoError(t, err)
+	assert.True(t, watermarked)
+}
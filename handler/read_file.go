@@ -40,6 +40,10 @@ func (h *ReadFileHandler) Name() string {
 	return "ReadFile"
 }
 
+func (h *ReadFileHandler) Outputs() []string {
+	return []string{"Source"}
+}
+
 func (h *ReadFileHandler) setConfig(config map[string]interface{}) error {
 	h.config = &ReadFileHandlerConfig{}
 	return h.DecodeMap(config, h.config)
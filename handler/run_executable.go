@@ -38,6 +38,10 @@ func (h *RunExecutableHandler) Name() string {
 	return "RunExecutable"
 }
 
+func (h *RunExecutableHandler) Outputs() []string {
+	return nil
+}
+
 func (h *RunExecutableHandler) setConfig(config map[string]interface{}) error {
 	h.config = &runExecConfig{}
 	return h.DecodeMap(config, h.config)
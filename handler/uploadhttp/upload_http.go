@@ -3,11 +3,15 @@ package uploadhttp
 import (
 	"fmt"
 	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/metrics"
 	"github.com/benyaa/virtual-printer-process-engine/utils"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"sync/atomic"
 )
 
 type UploadHTTPHandler struct {
@@ -58,6 +62,14 @@ func (h *UploadHTTPHandler) Name() string {
 	return "UploadHTTP"
 }
 
+func (h *UploadHTTPHandler) Outputs() []string {
+	return []string{"ResponseStatusCode", "ResponseBody", "ResponseHeaders", "URL"}
+}
+
+func (h *UploadHTTPHandler) Destinations() []string {
+	return []string{"URL"}
+}
+
 func (h *UploadHTTPHandler) setConfig(config map[string]interface{}) error {
 	h.config = &sendHTTPHandlerConfig{}
 	err := h.DecodeMap(config, h.config)
@@ -104,11 +116,12 @@ func (h *UploadHTTPHandler) formatBase64Content(base64Content string, info *defi
 }
 
 func (h *UploadHTTPHandler) Handle(info *definitions.EngineFlowObject, fileHandler definitions.EngineFileHandler) (*definitions.EngineFlowObject, error) {
-	reader, err := fileHandler.Read()
+	fileReader, err := fileHandler.Read()
 	if err != nil {
 		log.WithError(err).Errorf("failed to read file")
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
+	reader := &countingReader{reader: fileReader}
 	url := h.config.URL
 	url, err = info.EvaluateExpression(url)
 	if err != nil {
@@ -143,8 +156,11 @@ func (h *UploadHTTPHandler) Handle(info *definitions.EngineFlowObject, fileHandl
 		}
 		req.Header.Set(key, value)
 	}
+	// links the receiver's trace to the session, if tracing is enabled
+	otel.GetTextMapPropagator().Inject(info.Context(), propagation.HeaderCarrier(req.Header))
 
 	resp, err := h.client.Do(req)
+	metrics.UploadedBytes.WithLabelValues(h.GetID()).Add(float64(reader.count.Load()))
 	if err != nil {
 		log.WithError(err).Errorf("failed to send HTTP request")
 		return nil, fmt.Errorf("failed to send HTTP request: %w", err)
@@ -241,3 +257,16 @@ func createFormFile(writer *multipart.Writer, fieldName, filename string, reader
 	}
 	return part, nil
 }
+
+// countingReader counts the bytes read from the file, which are the bytes uploaded once the request is sent.
+// It's atomic since the streaming request reads the file in another goroutine.
+type countingReader struct {
+	reader io.Reader
+	count  atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count.Add(int64(n))
+	return n, err
+}
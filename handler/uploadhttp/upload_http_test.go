@@ -2,12 +2,19 @@ package uploadhttp
 
 import (
 	"bytes"
+	"context"
 	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -56,11 +63,13 @@ func TestSendHTTPHandler_Multipart(t *testing.T) {
 
 	h := &UploadHTTPHandler{
 		BaseHandler: definitions.BaseHandler{ID: "test_upload_http"},
+		client:      mockClient,
 	}
 	err := h.setConfig(map[string]interface{}{
-		"url":                  "http://example.com/upload",
-		"type":                 "multipart",
-		"multipart_field_name": "file",
+		"url":                      "http://example.com/upload",
+		"type":                     "multipart",
+		"multipart_field_name":     "file",
+		"put_response_as_contents": true,
 	})
 	assert.NoError(t, err)
 
@@ -122,6 +131,46 @@ func TestSendHTTPHandler_Base64(t *testing.T) {
 	assert.Contains(t, mockFileHandler.writer.String(), "mock response")
 }
 
+func TestSendHTTPHandler_UploadedBytesMetric(t *testing.T) {
+	mockResp := &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewBufferString("mock response")),
+		Header:     make(http.Header),
+	}
+
+	// Mock the HTTP client
+	mockClient := new(MockHTTPClient)
+	mockClient.On("Do", mock.AnythingOfType("*http.Request")).Return(mockResp, nil)
+
+	// Mock file handler
+	mockFileHandler := &MockEngineFileHandler{
+		reader: bytes.NewBufferString("mock file content"),
+		writer: new(bytes.Buffer),
+	}
+
+	h := &UploadHTTPHandler{
+		BaseHandler: definitions.BaseHandler{ID: "test_upload_http_metric"},
+		client:      mockClient,
+	}
+	err := h.setConfig(map[string]interface{}{
+		"url":                "http://example.com/upload",
+		"type":               "base64",
+		"base64_body_format": "{{.Base64Contents}}",
+	})
+	assert.NoError(t, err)
+
+	info := &definitions.EngineFlowObject{
+		Metadata: map[string]interface{}{},
+	}
+
+	uploadedBytes := testutil.ToFloat64(metrics.UploadedBytes.WithLabelValues("test_upload_http_metric"))
+	_, err = h.Handle(info, mockFileHandler)
+	assert.NoError(t, err)
+
+	// the metric counts the document's bytes, not the encoded request body
+	assert.Equal(t, uploadedBytes+float64(len("mock file content")), testutil.ToFloat64(metrics.UploadedBytes.WithLabelValues("test_upload_http_metric")))
+}
+
 func TestSendHTTPHandler_Error(t *testing.T) {
 	// Mock the HTTP client to simulate an error
 	mockClient := new(MockHTTPClient)
@@ -155,3 +204,47 @@ func TestSendHTTPHandler_Error(t *testing.T) {
 	assert.Error(t, err)
 	mockClient.AssertExpectations(t)
 }
+
+func TestSendHTTPHandler_TraceContext(t *testing.T) {
+	mockResp := &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewBufferString("mock response")),
+		Header:     make(http.Header),
+	}
+
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "UploadHTTP")
+	defer span.End()
+
+	mockClient := new(MockHTTPClient)
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.Contains(req.Header.Get("traceparent"), span.SpanContext().TraceID().String())
+	})).Return(mockResp, nil)
+
+	mockFileHandler := &MockEngineFileHandler{
+		reader: bytes.NewBufferString("mock file content"),
+		writer: new(bytes.Buffer),
+	}
+
+	h := &UploadHTTPHandler{
+		BaseHandler: definitions.BaseHandler{ID: "test_upload_http"},
+		client:      mockClient,
+	}
+	err := h.setConfig(map[string]interface{}{
+		"url":                  "http://example.com/upload",
+		"type":                 "multipart",
+		"multipart_field_name": "file",
+	})
+	assert.NoError(t, err)
+
+	info := &definitions.EngineFlowObject{
+		Metadata: map[string]interface{}{},
+	}
+	info.SetContext(ctx)
+
+	_, err = h.Handle(info, mockFileHandler)
+	assert.NoError(t, err)
+	mockClient.AssertExpectations(t)
+}
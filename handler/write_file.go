@@ -41,6 +41,14 @@ func (h *WriteFileHandler) Name() string {
 	return "WriteFile"
 }
 
+func (h *WriteFileHandler) Outputs() []string {
+	return []string{"OutputPath"}
+}
+
+func (h *WriteFileHandler) Destinations() []string {
+	return []string{"OutputPath"}
+}
+
 func (h *WriteFileHandler) setConfig(config map[string]interface{}) error {
 	h.config = &writeFileHandlerConfig{}
 	return h.DecodeMap(config, h.config)
@@ -2,11 +2,16 @@ package main
 
 import (
 	"context"
+	"github.com/benyaa/virtual-printer-process-engine/api"
+	"github.com/benyaa/virtual-printer-process-engine/audit"
 	"github.com/benyaa/virtual-printer-process-engine/config"
 	"github.com/benyaa/virtual-printer-process-engine/engine"
+	"github.com/benyaa/virtual-printer-process-engine/metrics"
 	"github.com/benyaa/virtual-printer-process-engine/osutils"
 	"github.com/benyaa/virtual-printer-process-engine/printer"
 	"github.com/benyaa/virtual-printer-process-engine/repo"
+	"github.com/benyaa/virtual-printer-process-engine/source"
+	"github.com/benyaa/virtual-printer-process-engine/tracing"
 	"github.com/benyaa/virtual-printer-process-engine/utils"
 	"github.com/getlantern/systray"
 	"github.com/getlantern/systray/example/icon"
@@ -19,12 +24,17 @@ import (
 )
 
 func main() {
+	if printer.IsCUPSBackend() {
+		os.Exit(printer.RunCUPSBackend(os.Args[1:]))
+	}
 	runAsAService()
 }
 
 var cancel context.CancelFunc
 var printerCreator printer.Creator
 var configLocation = "./config.yaml"
+var shutdownTracing func(context.Context) error
+var auditLogger *audit.Logger
 
 func runAsAService() {
 	log.Infof("Initiating...")
@@ -34,6 +44,9 @@ func runAsAService() {
 
 	log.Debugf("Log file set to %s", conf.Logs.Filename)
 	assertAdmin()
+	if conf.Tracing.Enabled {
+		setupTracing(conf)
+	}
 
 	var err error
 	conf.Workdir, err = utils.EvaluateExpression(conf.Workdir, map[string]interface{}{})
@@ -46,12 +59,37 @@ func runAsAService() {
 	var ctx context.Context
 	ctx, cancel = context.WithCancel(context.Background())
 	printerCreator = createPrinter(ctx, conf, path.Join(conf.Workdir, "jobs"))
+	log.Infof("setting up sources")
+	sources, err := source.Create(conf, path.Join(conf.Workdir, "jobs"), printerCreator.GetChannel())
+	if err != nil {
+		log.WithError(err).Fatalf("Error setting up sources")
+	}
 	log.Infof("settuing up write ahead logger")
-	writeAheadLogger := repo.NewWriteAheadLogger(path.Join(conf.Workdir, "wal", "wal.log"), conf.WriteAheadLogging)
+	walPath := path.Join(conf.Workdir, "wal", "wal.log")
+	writeAheadLogger := repo.NewWriteAheadLogger(walPath, conf.WriteAheadLogging)
+	jobStore := repo.NewMemoryJobStore(0)
+	log.Info("setting up audit log")
+	auditLogger, err = audit.New(conf.Audit)
+	if err != nil {
+		log.WithError(err).Fatalf("Error setting up audit log")
+	}
 	log.Info("setting up engine")
-	e := engine.New(ctx, conf, printerCreator.GetChannel(), writeAheadLogger)
+	e := engine.New(ctx, conf, printerCreator.GetChannel(), writeAheadLogger, jobStore, auditLogger)
 	log.Info("starting engine")
 	go e.Run()
+	source.RunAll(ctx, sources)
+	if conf.Metrics.Enabled {
+		startMetrics(ctx, conf, e, walPath)
+	}
+	if conf.API.Enabled {
+		apiServer := api.NewServer(conf, path.Join(conf.Workdir, "jobs"), printerCreator.GetChannel(), e, jobStore, writeAheadLogger)
+		go func() {
+			err := apiServer.Run(ctx)
+			if err != nil {
+				log.WithError(err).Errorf("API stopped")
+			}
+		}()
+	}
 
 	systray.Run(onReady, onExit)
 	log.Debugf("exiting")
@@ -109,6 +147,16 @@ func onExit() {
 			log.WithError(err).Errorf("Error removing virtual printer")
 		}
 	}
+	err := auditLogger.Close()
+	if err != nil {
+		log.WithError(err).Errorf("Error closing audit log")
+	}
+	if shutdownTracing != nil {
+		err := shutdownTracing(context.Background())
+		if err != nil {
+			log.WithError(err).Errorf("Error flushing traces")
+		}
+	}
 	log.Infof("Shutting down...")
 }
 
@@ -130,6 +178,29 @@ func setupLogging(conf config.Config) {
 	log.SetFormatter(&log.JSONFormatter{})
 }
 
+func setupTracing(conf config.Config) {
+	var err error
+	shutdownTracing, err = tracing.Setup(context.Background(), conf.Tracing)
+	if err != nil {
+		log.WithError(err).Fatalf("Error setting up tracing")
+	}
+}
+
+func startMetrics(ctx context.Context, conf config.Config, e *engine.Engine, walPath string) {
+	address := conf.Metrics.Address
+	if address == "" {
+		address = "127.0.0.1:9464"
+	}
+	metrics.RegisterEngine(e)
+	metrics.RegisterWAL(walPath)
+	go func() {
+		err := metrics.Serve(ctx, address)
+		if err != nil {
+			log.WithError(err).Errorf("metrics server stopped")
+		}
+	}()
+}
+
 func getConfig() config.Config {
 	var argConfigLocation string
 	if len(os.Args) > 1 {
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"os"
+)
+
+const namespace = "vppe"
+
+var (
+	JobsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_received_total",
+		Help:      "The number of jobs the engine took, by pipeline.",
+	}, []string{"pipeline"})
+	JobsCompleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_completed_total",
+		Help:      "The number of jobs that went through their pipeline, by pipeline.",
+	}, []string{"pipeline"})
+	JobsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_failed_total",
+		Help:      "The number of jobs that failed, by pipeline.",
+	}, []string{"pipeline"})
+	JobsCanceled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_canceled_total",
+		Help:      "The number of jobs that were canceled, by pipeline.",
+	}, []string{"pipeline"})
+	HandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handler_duration_seconds",
+		Help:      "The duration of each handler attempt, by pipeline, handler and result.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 15),
+	}, []string{"pipeline", "handler_id", "handler", "result"})
+	HandlerRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "handler_retries_total",
+		Help:      "The number of times a handler was retried after it failed, by pipeline and handler.",
+	}, []string{"pipeline", "handler_id", "handler"})
+	UploadedBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_http_uploaded_bytes_total",
+		Help:      "The number of document bytes UploadHTTP sent, by handler.",
+	}, []string{"handler_id"})
+)
+
+// Engine is what the engine gauges are read from when they're scraped.
+type Engine interface {
+	QueueDepth() int
+	BusyWorkers() int
+	MaxWorkers() int
+}
+
+// RegisterEngine registers the gauges of the engine's queue and worker pool.
+func RegisterEngine(e Engine) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "The number of queued jobs, which are waiting for a worker.",
+	}, func() float64 {
+		return float64(e.QueueDepth())
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "workers_busy",
+		Help:      "The number of workers of the worker pool that are running a job.",
+	}, func() float64 {
+		return float64(e.BusyWorkers())
+	})
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "workers_max",
+		Help:      "The size of the worker pool.",
+	}, func() float64 {
+		return float64(e.MaxWorkers())
+	})
+}
+
+// RegisterWAL registers the gauge of the WAL file's size.
+func RegisterWAL(walPath string) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "wal_size_bytes",
+		Help:      "The size of the current WAL file.",
+	}, func() float64 {
+		stat, err := os.Stat(walPath)
+		if err != nil {
+			return 0
+		}
+		return float64(stat.Size())
+	})
+}
+
+// Serve serves the metrics at /metrics on the address until ctx is done.
+func Serve(ctx context.Context, address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	log.Infof("serving metrics on %s", listener.Addr())
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.Handler())
+	server := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		log.Infof("context canceled, stopping metrics server")
+		server.Shutdown(context.Background())
+	}()
+
+	err = server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
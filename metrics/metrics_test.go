@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeEngine struct{}
+
+func (fakeEngine) QueueDepth() int {
+	return 4
+}
+
+func (fakeEngine) BusyWorkers() int {
+	return 1
+}
+
+func (fakeEngine) MaxWorkers() int {
+	return 2
+}
+
+func TestGauges(t *testing.T) {
+	walPath := filepath.Join(t.TempDir(), "wal.log")
+	assert.NoError(t, os.WriteFile(walPath, []byte("0123456789"), 0644))
+	RegisterEngine(fakeEngine{})
+	RegisterWAL(walPath)
+
+	expected := `
+# HELP vppe_queue_depth The number of queued jobs, which are waiting for a worker.
+# TYPE vppe_queue_depth gauge
+vppe_queue_depth 4
+# HELP vppe_wal_size_bytes The size of the current WAL file.
+# TYPE vppe_wal_size_bytes gauge
+vppe_wal_size_bytes 10
+# HELP vppe_workers_busy The number of workers of the worker pool that are running a job.
+# TYPE vppe_workers_busy gauge
+vppe_workers_busy 1
+# HELP vppe_workers_max The size of the worker pool.
+# TYPE vppe_workers_max gauge
+vppe_workers_max 2
+`
+	err := testutil.GatherAndCompare(prometheus.DefaultGatherer, strings.NewReader(expected),
+		"vppe_queue_depth", "vppe_wal_size_bytes", "vppe_workers_busy", "vppe_workers_max")
+	assert.NoError(t, err)
+}
@@ -73,7 +73,7 @@ func IsRunningAtStartup() (bool, error) {
 		return false, err
 	}
 
-	log.Debugf("app is running at startup", autoStartPath)
+	log.Debugf("app is running at startup: %s", autoStartPath)
 	return true, nil
 }
 
@@ -0,0 +1,358 @@
+package printer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/consts"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/utils"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CUPSBackendScheme is the device URI scheme of the backend, e.g. `virtualprinterprocessengine:/run/engine.sock`
+var CUPSBackendScheme = strings.ToLower(consts.AppName)
+
+// CUPS backend exit codes
+const (
+	cupsBackendOK     = 0
+	cupsBackendFailed = 1
+	cupsBackendRetry  = 6
+)
+
+// cupsJobEnvironment are the environment variables CUPS passes the backend with job attributes
+var cupsJobEnvironment = []string{"CONTENT_TYPE", "FINAL_CONTENT_TYPE", "PRINTER", "PRINTER_INFO", "PRINTER_LOCATION", "CLASS", "CHARSET", "LANG"}
+
+// backendJob is sent by the backend to the engine before the document data.
+type backendJob struct {
+	JobID       string            `json:"job_id"`
+	User        string            `json:"user"`
+	Title       string            `json:"title"`
+	Copies      int               `json:"copies"`
+	Options     map[string]string `json:"options"`
+	Environment map[string]string `json:"environment"`
+}
+
+// IsCUPSBackend returns whether CUPS executed the binary as the backend of the virtual printer.
+func IsCUPSBackend() bool {
+	return strings.HasPrefix(os.Getenv("DEVICE_URI"), CUPSBackendScheme+":") ||
+		strings.HasPrefix(os.Args[0], CUPSBackendScheme+":") ||
+		filepath.Base(os.Args[0]) == CUPSBackendScheme
+}
+
+// RunCUPSBackend hands the job to the running engine, as `backend job-id user title copies options [file]`,
+// and returns the exit code for CUPS.
+func RunCUPSBackend(args []string) int {
+	if len(args) == 0 {
+		// device discovery, the device URI is set by the engine when it creates the printer
+		fmt.Printf("direct %s \"Unknown\" \"%s\"\n", CUPSBackendScheme, consts.AppName)
+		return cupsBackendOK
+	}
+	if len(args) != 5 && len(args) != 6 {
+		fmt.Fprintf(os.Stderr, "Usage: %s job-id user title copies options [file]\n", CUPSBackendScheme)
+		return cupsBackendFailed
+	}
+
+	socketPath := strings.TrimPrefix(os.Getenv("DEVICE_URI"), CUPSBackendScheme+":")
+	if socketPath == "" {
+		fmt.Fprintf(os.Stderr, "ERROR: DEVICE_URI isn't set\n")
+		return cupsBackendFailed
+	}
+
+	document := os.Stdin
+	if len(args) == 6 {
+		file, err := os.Open(args[5])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: failed to open %s: %v\n", args[5], err)
+			return cupsBackendFailed
+		}
+		defer file.Close()
+		document = file
+	}
+
+	copies, err := strconv.Atoi(args[3])
+	if err != nil {
+		copies = 1
+	}
+	job := backendJob{
+		JobID:       args[0],
+		User:        args[1],
+		Title:       args[2],
+		Copies:      copies,
+		Options:     parseCUPSOptions(args[4]),
+		Environment: map[string]string{},
+	}
+	for _, name := range cupsJobEnvironment {
+		if value := os.Getenv(name); value != "" {
+			job.Environment[name] = value
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "INFO: sending job %s to %s\n", job.JobID, consts.AppName)
+	err = sendBackendJob(socketPath, job, document)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: failed to send job to %s: %v\n", consts.AppName, err)
+		var netErr *net.OpError
+		if errors.As(err, &netErr) && netErr.Op == "dial" {
+			// the engine isn't running, so CUPS should hold on to the job and retry it later
+			return cupsBackendRetry
+		}
+		return cupsBackendFailed
+	}
+	fmt.Fprintf(os.Stderr, "INFO: job %s was sent to %s\n", job.JobID, consts.AppName)
+	return cupsBackendOK
+}
+
+// parseCUPSOptions parses the CUPS options argument, e.g. `media=A4 sides=one-sided landscape`.
+// Options without a value are boolean options that are set to true.
+func parseCUPSOptions(options string) map[string]string {
+	parsed := map[string]string{}
+	for _, option := range strings.Fields(options) {
+		name, value, found := strings.Cut(option, "=")
+		if !found {
+			value = "true"
+		}
+		parsed[name] = value
+	}
+	return parsed
+}
+
+func sendBackendJob(socketPath string, job backendJob, document io.Reader) error {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	header, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Write(append(header, '\n'))
+	if err != nil {
+		return fmt.Errorf("failed to send job attributes: %w", err)
+	}
+	_, err = io.Copy(conn, document)
+	if err != nil {
+		return fmt.Errorf("failed to send document: %w", err)
+	}
+	err = conn.(*net.UnixConn).CloseWrite()
+	if err != nil {
+		return err
+	}
+
+	response, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	response = strings.TrimSuffix(response, "\n")
+	if response != "ok" {
+		return errors.New(response)
+	}
+	return nil
+}
+
+func (pc *printerCreator) getBackendSocket() string {
+	if pc.conf.Printer.BackendSocket != "" {
+		return pc.conf.Printer.BackendSocket
+	}
+	return filepath.Join(pc.conf.Workdir, "backend.sock")
+}
+
+func (pc *printerCreator) setBackendSocketGroup(socketPath string) error {
+	groupName := pc.conf.Printer.BackendSocketGroup
+	if groupName == "" {
+		groupName = "lp"
+	}
+	group, err := user.LookupGroup(groupName)
+	if err != nil {
+		return fmt.Errorf("failed to find backend socket group %s: %w", groupName, err)
+	}
+	gid, err := strconv.Atoi(group.Gid)
+	if err != nil {
+		return fmt.Errorf("invalid gid %s of group %s: %w", group.Gid, groupName, err)
+	}
+	err = os.Chown(socketPath, -1, gid)
+	if err != nil {
+		return fmt.Errorf("failed to set backend socket group: %w", err)
+	}
+	return nil
+}
+
+func (pc *printerCreator) getBackendPath() string {
+	backendDir := pc.conf.Printer.BackendDir
+	if backendDir == "" {
+		backendDir = "/usr/lib/cups/backend"
+	}
+	return filepath.Join(backendDir, CUPSBackendScheme)
+}
+
+// installBackend links the backend to the running binary, so CUPS can execute it.
+func (pc *printerCreator) installBackend() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %w", err)
+	}
+	backendPath := pc.getBackendPath()
+	log.Infof("installing CUPS backend %s", backendPath)
+	err = os.Remove(backendPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove old CUPS backend: %w", err)
+	}
+	err = os.Symlink(executable, backendPath)
+	if err != nil {
+		return fmt.Errorf("failed to install CUPS backend: %w", err)
+	}
+	return nil
+}
+
+// listenForBackendJobs receives the jobs sent by the backend until the context is done.
+func (pc *printerCreator) listenForBackendJobs(listener net.Listener) {
+	go func() {
+		<-pc.ctx.Done()
+		log.Infof("context canceled, stopping CUPS backend listener")
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if pc.ctx.Err() == nil {
+				log.WithError(err).Errorf("failed to accept CUPS backend connection")
+			}
+			return
+		}
+		go func() {
+			defer conn.Close()
+			err := pc.handleBackendConnection(conn)
+			response := "ok"
+			if err != nil {
+				log.WithError(err).Errorf("failed to receive job from CUPS backend")
+				response = err.Error()
+			}
+			conn.Write([]byte(response + "\n"))
+		}()
+	}
+}
+
+func (pc *printerCreator) listenOnBackendSocket() (net.Listener, error) {
+	socketPath := pc.getBackendSocket()
+	err := os.MkdirAll(filepath.Dir(socketPath), os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backend socket directory: %w", err)
+	}
+	// a socket left behind by a previous run
+	os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	// only the group CUPS runs the backend as can send jobs, since their attributes are trusted
+	err = pc.setBackendSocketGroup(socketPath)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	err = os.Chmod(socketPath, 0660)
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set backend socket permissions: %w", err)
+	}
+	log.Infof("listening for CUPS backend jobs on %s", socketPath)
+	return listener, nil
+}
+
+func (pc *printerCreator) handleBackendConnection(conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	header, err := reader.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read job attributes: %w", err)
+	}
+	var job backendJob
+	err = json.Unmarshal(header, &job)
+	if err != nil {
+		return fmt.Errorf("failed to parse job attributes: %w", err)
+	}
+
+	outputPath := filepath.Join(pc.dir, fmt.Sprintf("job_%s", uuid.New().String()[0:8]))
+	printInfo, err := pc.spoolBackendJob(reader, outputPath)
+	if err != nil {
+		os.Remove(outputPath)
+		return err
+	}
+
+	printInfo.Source = "cups"
+	printInfo.Title = job.Title
+	printInfo.User = job.User
+	printInfo.Copies = job.Copies
+	printInfo.OriginalFilename = job.Title
+	printInfo.SubmittedAt = time.Now()
+	printInfo.Host, _ = os.Hostname()
+	for name, value := range job.Options {
+		printInfo.Attributes[name] = value
+	}
+	for name, value := range job.Environment {
+		printInfo.Attributes[name] = value
+	}
+	printInfo.Attributes["JobID"] = job.JobID
+
+	log.Infof("received CUPS job %s from %s as %s", job.JobID, job.User, printInfo.Filepath)
+	select {
+	case pc.channel <- printInfo:
+		log.Debugf("added CUPS job to channel: %s", printInfo.Filepath)
+		return nil
+	case <-pc.ctx.Done():
+		os.Remove(printInfo.Filepath)
+		return errors.New("the engine is shutting down")
+	}
+}
+
+// spoolBackendJob writes the document to outputPath, with the extension of its type.
+func (pc *printerCreator) spoolBackendJob(document io.Reader, outputPath string) (definitions.PrintInfo, error) {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return definitions.PrintInfo{}, fmt.Errorf("failed to create job file: %w", err)
+	}
+	_, err = io.Copy(file, document)
+	file.Close()
+	if err != nil {
+		return definitions.PrintInfo{}, fmt.Errorf("failed to receive document: %w", err)
+	}
+
+	documentType, err := utils.DetectFileDocumentType(outputPath)
+	if err != nil {
+		return definitions.PrintInfo{}, fmt.Errorf("failed to detect document type: %w", err)
+	}
+	switch documentType {
+	case utils.DocumentPDF, utils.DocumentPostScript, utils.DocumentPCL, utils.DocumentText:
+	default:
+		return definitions.PrintInfo{}, fmt.Errorf("unsupported document type %s", documentType)
+	}
+	pages, err := utils.CountPages(outputPath, documentType)
+	if err != nil {
+		return definitions.PrintInfo{}, fmt.Errorf("failed to count pages: %w", err)
+	}
+
+	typedPath := outputPath + documentType.Extension()
+	err = os.Rename(outputPath, typedPath)
+	if err != nil {
+		return definitions.PrintInfo{}, fmt.Errorf("failed to rename job file: %w", err)
+	}
+	return definitions.PrintInfo{
+		Filepath: typedPath,
+		Pages:    pages,
+		Attributes: map[string]string{
+			"DocumentType": string(documentType),
+		},
+	}, nil
+}
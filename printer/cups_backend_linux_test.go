@@ -0,0 +1,76 @@
+package printer
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCUPSOptions(t *testing.T) {
+	options := parseCUPSOptions("media=A4 sides=one-sided  landscape")
+	assert.Equal(t, map[string]string{"media": "A4", "sides": "one-sided", "landscape": "true"}, options)
+}
+
+func TestCUPSBackend(t *testing.T) {
+	workdir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	group, err := user.LookupGroupId(strconv.Itoa(os.Getgid()))
+	assert.NoError(t, err)
+	conf := config.Config{Workdir: workdir}
+	conf.Printer.Mode = config.PrinterModeBackend
+	conf.Printer.BackendSocketGroup = group.Name
+	pc := &printerCreator{conf: conf, ctx: ctx, channel: make(chan definitions.PrintInfo, 1), dir: workdir}
+	listener, err := pc.listenOnBackendSocket()
+	assert.NoError(t, err)
+	info, err := os.Stat(filepath.Join(workdir, "backend.sock"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+	assert.Equal(t, uint32(os.Getgid()), info.Sys().(*syscall.Stat_t).Gid)
+	go pc.listenForBackendJobs(listener)
+
+	job := backendJob{
+		JobID:       "42",
+		User:        "alice",
+		Title:       "report.txt",
+		Copies:      2,
+		Options:     map[string]string{"media": "A4"},
+		Environment: map[string]string{"PRINTER": "MyPrinter"},
+	}
+	err = sendBackendJob(filepath.Join(workdir, "backend.sock"), job, strings.NewReader("hello world\n"))
+	assert.NoError(t, err)
+
+	printInfo := <-pc.channel
+	assert.Equal(t, "cups", printInfo.Source)
+	assert.Equal(t, "report.txt", printInfo.Title)
+	assert.Equal(t, "alice", printInfo.User)
+	assert.Equal(t, 2, printInfo.Copies)
+	assert.Equal(t, "42", printInfo.Attributes["JobID"])
+	assert.Equal(t, "A4", printInfo.Attributes["media"])
+	assert.Equal(t, "MyPrinter", printInfo.Attributes["PRINTER"])
+	assert.Equal(t, "text", printInfo.Attributes["DocumentType"])
+	contents, err := os.ReadFile(printInfo.Filepath)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world\n", string(contents))
+
+	err = sendBackendJob(filepath.Join(workdir, "backend.sock"), job, strings.NewReader("\x00\x01\x02"))
+	assert.ErrorContains(t, err, "unsupported document type")
+}
+
+func TestCUPSBackend_UnknownSocketGroup(t *testing.T) {
+	conf := config.Config{Workdir: t.TempDir()}
+	conf.Printer.BackendSocketGroup = "no-such-group"
+	pc := &printerCreator{conf: conf, ctx: context.Background()}
+	_, err := pc.listenOnBackendSocket()
+	assert.ErrorContains(t, err, "failed to find backend socket group no-such-group")
+}
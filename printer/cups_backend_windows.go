@@ -0,0 +1,10 @@
+package printer
+
+// IsCUPSBackend returns whether CUPS executed the binary as the backend of the virtual printer, which is never on Windows.
+func IsCUPSBackend() bool {
+	return false
+}
+
+func RunCUPSBackend(args []string) int {
+	return 1
+}
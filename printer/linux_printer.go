@@ -12,9 +12,12 @@ import (
 	"github.com/google/uuid"
 	"github.com/pdfcpu/pdfcpu/pkg/api"
 	log "github.com/sirupsen/logrus"
-	"io/fs"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -39,18 +42,45 @@ func (pc *printerCreator) GetChannel() chan definitions.PrintInfo {
 }
 
 func (pc *printerCreator) CreateVirtualPrinter() error {
+	switch pc.conf.Printer.Mode {
+	case "", config.PrinterModeCUPSPDF:
+		err := pc.addPrinter("cups-pdf:/")
+		if err != nil {
+			return err
+		}
+		go pc.monitorOutputDirectory()
+	case config.PrinterModeBackend:
+		err := pc.installBackend()
+		if err != nil {
+			return err
+		}
+		listener, err := pc.listenOnBackendSocket()
+		if err != nil {
+			return err
+		}
+		err = pc.addPrinter(CUPSBackendScheme + ":" + pc.getBackendSocket())
+		if err != nil {
+			listener.Close()
+			return err
+		}
+		go pc.listenForBackendJobs(listener)
+	default:
+		return fmt.Errorf("unknown printer mode %s", pc.conf.Printer.Mode)
+	}
+
+	return nil
+}
+
+func (pc *printerCreator) addPrinter(deviceURI string) error {
 	output, err := utils.ExecuteCommand("lpadmin",
 		"-p", pc.conf.Printer.Name,
 		"-E",
-		"-v", "cups-pdf:/",
+		"-v", deviceURI,
 		"-m", "raw")
 	if err != nil {
 		log.WithError(err).Errorf("failed to create virtual printer: %s", output)
 		return fmt.Errorf("failed to create virtual printer: %v", err)
 	}
-
-	go pc.monitorOutputDirectory()
-
 	return nil
 }
 
@@ -66,65 +96,136 @@ func (pc *printerCreator) RemoveVirtualPrinter() error {
 		return fmt.Errorf("failed to remove virtual printer: %v", err)
 	}
 
+	if pc.conf.Printer.Mode == config.PrinterModeBackend {
+		log.Infof("removing CUPS backend %s", pc.getBackendPath())
+		os.Remove(pc.getBackendPath())
+		os.Remove(pc.getBackendSocket())
+	}
+
 	return nil
 }
 
+func (pc *printerCreator) getOutputDir() string {
+	if pc.conf.Printer.OutputDir != "" {
+		return pc.conf.Printer.OutputDir
+	}
+	return filepath.Join(os.Getenv("HOME"), "PDF") // Default output directory for cups-pdf
+}
+
+func (pc *printerCreator) getQuarantineDir() string {
+	if pc.conf.Printer.QuarantineDir != "" {
+		return pc.conf.Printer.QuarantineDir
+	}
+	return filepath.Join(pc.conf.Workdir, "quarantine")
+}
+
 func (pc *printerCreator) monitorOutputDirectory() {
-	outputDir := filepath.Join(os.Getenv("HOME"), "PDF") // Default output directory for cups-pdf
-	ticker := time.NewTicker(5 * time.Second)            // Adjust the interval as needed
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-pc.ctx.Done():
-			log.Infof("context canceled, stopping monitorOutputDirectory.")
-			return
-		case <-ticker.C:
-			err := filepath.WalkDir(outputDir, func(path string, d fs.DirEntry, err error) error {
-				if err != nil {
-					return err
-				}
-				if !d.IsDir() {
-					pc.processPDF(path)
-				}
-				return nil
-			})
-			if err != nil {
-				log.WithError(err).Errorf("failed to walk output directory: %s", outputDir)
-			}
+	outputDir := pc.getOutputDir()
+	err := os.MkdirAll(outputDir, os.ModePerm)
+	if err != nil {
+		log.WithError(err).Errorf("failed to create output directory: %s", outputDir)
+	}
+	log.Infof("watching output directory: %s", outputDir)
+
+	utils.WatchFiles(pc.ctx, utils.FileWatcherConfig{
+		Dirs:         []string{outputDir},
+		StableFor:    time.Duration(pc.conf.Printer.StableForMs) * time.Millisecond,
+		PollInterval: time.Duration(pc.conf.Printer.MonitorInterval) * time.Millisecond,
+		UsePolling:   pc.conf.Printer.UsePolling,
+	}, func(path string) {
+		err := pc.processPDF(path)
+		if err != nil {
+			pc.quarantine(path)
 		}
+	})
+}
+
+func (pc *printerCreator) quarantine(path string) {
+	quarantineDir := pc.getQuarantineDir()
+	log.Warnf("moving PDF file %s to quarantine %s", path, quarantineDir)
+	err := os.MkdirAll(quarantineDir, os.ModePerm)
+	if err != nil {
+		log.WithError(err).Errorf("failed to create quarantine directory: %s", quarantineDir)
+		return
+	}
+	quarantinePath := filepath.Join(quarantineDir, fmt.Sprintf("%s_%s", uuid.New().String()[0:8], filepath.Base(path)))
+	err = utils.MoveFile(path, quarantinePath)
+	if err != nil {
+		log.WithError(err).Errorf("failed to move PDF file %s to quarantine", path)
 	}
 }
 
-func (pc *printerCreator) processPDF(path string) {
+func (pc *printerCreator) processPDF(path string) error {
 	log.Infof("processing PDF file: %s", path)
 	outputPath := filepath.Join(pc.dir, fmt.Sprintf("job_%s.pdf", uuid.New().String()[0:8]))
 	pages, err := pc.getNumberOfPages(path)
 	if err != nil {
 		log.WithError(err).Errorf("failed to get number of pages for PDF file: %s", path)
-		return
+		return err
 	}
 
+	printInfo := pc.getJobInfo(path)
+	printInfo.Filepath = outputPath
+	printInfo.Pages = pages
+
 	log.Debugf("moving PDF file to output directory: %s", outputPath)
 	err = utils.CopyFile(path, outputPath)
 	if err != nil {
 		log.WithError(err).Errorf("failed to move PDF file: %s", path)
-		return
+		return err
 	}
 
 	log.Debugf("removing original PDF file: %s", path)
 
 	err = os.Remove(path)
 	if err != nil {
-		log.Printf("Failed to remove original PDF file %s: %v", path, err)
-		return
+		log.WithError(err).Errorf("failed to remove original PDF file: %s", path)
+		os.Remove(outputPath)
+		return err
+	}
+
+	select {
+	case pc.channel <- printInfo:
+		log.Debugf("added PDF file to channel: %s", outputPath)
+	case <-pc.ctx.Done():
+		log.Warnf("context canceled before PDF file %s was handed to the engine", outputPath)
+	}
+	return nil
+}
+
+// getJobInfo collects what cups-pdf leaves about the job: it names the file after the job's title
+// and creates it as the submitting user.
+func (pc *printerCreator) getJobInfo(path string) definitions.PrintInfo {
+	filename := filepath.Base(path)
+	printInfo := definitions.PrintInfo{
+		Source:           "printer",
+		Title:            strings.TrimSuffix(filename, filepath.Ext(filename)),
+		OriginalFilename: filename,
+		Copies:           1,
 	}
 
-	pc.channel <- definitions.PrintInfo{
-		Filepath: outputPath,
-		Pages:    pages,
+	host, err := os.Hostname()
+	if err != nil {
+		log.WithError(err).Warnf("failed to get hostname")
 	}
-	log.Debugf("added PDF file to channel: %s", outputPath)
+	printInfo.Host = host
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		log.WithError(err).Warnf("failed to stat PDF file: %s", path)
+		return printInfo
+	}
+	printInfo.SubmittedAt = stat.ModTime()
+	if sysStat, ok := stat.Sys().(*syscall.Stat_t); ok {
+		owner, err := user.LookupId(strconv.Itoa(int(sysStat.Uid)))
+		if err != nil {
+			log.WithError(err).Warnf("failed to lookup owner of PDF file: %s", path)
+		} else {
+			printInfo.User = owner.Username
+		}
+	}
+
+	return printInfo
 }
 
 func (pc *printerCreator) getNumberOfPages(filePath string) (int, error) {
@@ -53,6 +53,36 @@ DWORD getPrintJobPages(HANDLE hPrinter, DWORD jobId) {
     return totalPages;
 }
 
+DWORD getPrintJobCopies(HANDLE hPrinter, DWORD jobId) {
+    DWORD needed, returned;
+    JOB_INFO_2 *pJobInfo = NULL;
+
+    if (!GetJob(hPrinter, jobId, 2, NULL, 0, &needed)) {
+        if (GetLastError() != ERROR_INSUFFICIENT_BUFFER) {
+            return 0; // Failed to get job info
+        }
+    }
+
+    pJobInfo = (JOB_INFO_2*)malloc(needed);
+    if (pJobInfo == NULL) {
+        return 0; // Memory allocation failure
+    }
+
+    if (!GetJob(hPrinter, jobId, 2, (LPBYTE)pJobInfo, needed, &returned)) {
+        free(pJobInfo);
+        return 0; // Failed to get job info
+    }
+
+    DWORD copies = 0;
+    if (pJobInfo->pDevMode != NULL && (pJobInfo->pDevMode->dmFields & DM_COPIES)) {
+        copies = pJobInfo->pDevMode->dmCopies;
+    }
+
+    free(pJobInfo);
+
+    return copies;
+}
+
 int copy_file(const char *src, const char *dst) {
     FILE *source = fopen(src, "rb");
     if (source == NULL) {
@@ -267,6 +297,11 @@ func jobStatusToString(status uint32) string {
 	return strings.Join(statuses, " | ")
 }
 
+func systemTimeToTime(t C.SYSTEMTIME) time.Time {
+	return time.Date(int(t.wYear), time.Month(t.wMonth), int(t.wDay),
+		int(t.wHour), int(t.wMinute), int(t.wSecond), int(t.wMilliseconds)*int(time.Millisecond), time.UTC)
+}
+
 func (p *processor) RunService(monitorInterval time.Duration) {
 	hPrinter := openPrinter(p.printerName)
 	defer closePrinter(hPrinter)
@@ -305,9 +340,17 @@ func (p *processor) RunService(monitorInterval time.Duration) {
 					cPrinterName := C.CString(p.printerName)
 					defer C.free(unsafe.Pointer(cPrinterName))
 					cJobId := C.DWORD(job.JobId)
+					document := C.GoString(job.pDocument)
 					printerInfo := definitions.PrintInfo{
-						Filepath: xpsFile,
-						Pages:    int(C.getPrintJobPages(hPrinter, cJobId)),
+						Filepath:         xpsFile,
+						Pages:            int(C.getPrintJobPages(hPrinter, cJobId)),
+						Source:           "printer",
+						Title:            document,
+						User:             C.GoString(job.pUserName),
+						Host:             strings.TrimLeft(C.GoString(job.pMachineName), `\`),
+						Copies:           int(C.getPrintJobCopies(hPrinter, cJobId)),
+						SubmittedAt:      systemTimeToTime(job.Submitted),
+						OriginalFilename: document,
 					}
 					C.DeletePrintJob(cPrinterName, cJobId)
 					log.Debugf("deleted job %d", job.JobId)
@@ -0,0 +1,176 @@
+package repo
+
+import (
+	"github.com/google/uuid"
+	"sort"
+	"sync"
+	"time"
+)
+
+type JobStatus string
+
+const (
+	JobQueued     JobStatus = "queued"
+	JobProcessing JobStatus = "processing"
+	JobCompleted  JobStatus = "completed"
+	JobFailed     JobStatus = "failed"
+	JobCanceled   JobStatus = "canceled"
+)
+
+// Job is the progress of a session through its pipeline.
+type Job struct {
+	SessionID uuid.UUID `json:"session_id"`
+	Pipeline  string    `json:"pipeline"`
+	Status    JobStatus `json:"status"`
+	// HandlerName and HandlerID are of the handler that is running, or the last one that ran
+	HandlerName string                 `json:"handler_name,omitempty"`
+	HandlerID   string                 `json:"handler_id,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	// Handlers are the handler runs of the session, in order
+	Handlers  []HandlerRun `json:"handlers,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+type HandlerRun struct {
+	HandlerName string    `json:"handler_name"`
+	HandlerID   string    `json:"handler_id"`
+	StartedAt   time.Time `json:"started_at"`
+	// FinishedAt is zero while the handler is running
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	// Destinations are where the handler sent the document, e.g. the file it wrote
+	Destinations []string `json:"destinations,omitempty"`
+}
+
+func (j Job) IsDone() bool {
+	return j.Status == JobCompleted || j.Status == JobFailed || j.Status == JobCanceled
+}
+
+// JobStore keeps the status of the recent jobs.
+type JobStore interface {
+	// Update applies update to the session's job, which is created if it doesn't exist.
+	Update(sessionID uuid.UUID, update func(job *Job))
+	// TryQueue sets the session's job to queued in the pipeline, unless it's still active, and returns whether it did.
+	TryQueue(sessionID uuid.UUID, pipeline string) bool
+	Get(sessionID uuid.UUID) (Job, bool)
+	// List returns the jobs, most recently created first.
+	List() []Job
+	// Count returns the number of jobs with the status.
+	Count(status JobStatus) int
+}
+
+type MemoryJobStore struct {
+	mutex   sync.RWMutex
+	jobs    map[uuid.UUID]*Job
+	maxJobs int
+}
+
+// NewMemoryJobStore creates a job store that forgets the oldest finished jobs once it holds more than maxJobs.
+func NewMemoryJobStore(maxJobs int) *MemoryJobStore {
+	if maxJobs <= 0 {
+		maxJobs = 1000
+	}
+	return &MemoryJobStore{
+		jobs:    map[uuid.UUID]*Job{},
+		maxJobs: maxJobs,
+	}
+}
+
+func (s *MemoryJobStore) Update(sessionID uuid.UUID, update func(job *Job)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	job, ok := s.jobs[sessionID]
+	if !ok {
+		job = &Job{SessionID: sessionID, Status: JobQueued, CreatedAt: now}
+		s.jobs[sessionID] = job
+	}
+	update(job)
+	job.UpdatedAt = now
+
+	if !ok && len(s.jobs) > s.maxJobs {
+		s.evict()
+	}
+}
+
+func (s *MemoryJobStore) TryQueue(sessionID uuid.UUID, pipeline string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	job, ok := s.jobs[sessionID]
+	if ok && !job.IsDone() {
+		return false
+	}
+	if !ok {
+		job = &Job{SessionID: sessionID, CreatedAt: now}
+		s.jobs[sessionID] = job
+	}
+	job.Pipeline = pipeline
+	job.Status = JobQueued
+	job.Error = ""
+	job.UpdatedAt = now
+
+	if !ok && len(s.jobs) > s.maxJobs {
+		s.evict()
+	}
+	return true
+}
+
+// evict removes the oldest finished job.
+func (s *MemoryJobStore) evict() {
+	var oldest *Job
+	for _, job := range s.jobs {
+		if job.IsDone() && (oldest == nil || job.CreatedAt.Before(oldest.CreatedAt)) {
+			oldest = job
+		}
+	}
+	if oldest != nil {
+		delete(s.jobs, oldest.SessionID)
+	}
+}
+
+func (s *MemoryJobStore) Get(sessionID uuid.UUID) (Job, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	job, ok := s.jobs[sessionID]
+	if !ok {
+		return Job{}, false
+	}
+	return job.copy(), true
+}
+
+func (s *MemoryJobStore) List() []Job {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.copy())
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+func (s *MemoryJobStore) Count(status JobStatus) int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	count := 0
+	for _, job := range s.jobs {
+		if job.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// copy returns a copy of the job that doesn't share its handler runs with the store.
+func (j *Job) copy() Job {
+	copied := *j
+	copied.Handlers = append([]HandlerRun(nil), j.Handlers...)
+	return copied
+}
@@ -0,0 +1,51 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryJobStore_EvictsOldestFinishedJob(t *testing.T) {
+	store := NewMemoryJobStore(2)
+	finished, running, latest := uuid.New(), uuid.New(), uuid.New()
+	store.Update(finished, func(job *Job) { job.Status = JobCompleted })
+	store.Update(running, func(job *Job) { job.Status = JobProcessing })
+	store.Update(latest, func(job *Job) {})
+
+	_, ok := store.Get(finished)
+	assert.False(t, ok)
+	jobs := store.List()
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, latest, jobs[0].SessionID)
+	assert.Equal(t, JobQueued, jobs[0].Status)
+}
+
+func TestMemoryJobStore_Count(t *testing.T) {
+	store := NewMemoryJobStore(0)
+	store.Update(uuid.New(), func(job *Job) {})
+	store.Update(uuid.New(), func(job *Job) {})
+	store.Update(uuid.New(), func(job *Job) { job.Status = JobProcessing })
+
+	assert.Equal(t, 2, store.Count(JobQueued))
+	assert.Equal(t, 1, store.Count(JobProcessing))
+	assert.Equal(t, 0, store.Count(JobFailed))
+}
+
+func TestMemoryJobStore_TryQueue(t *testing.T) {
+	store := NewMemoryJobStore(0)
+	sessionID := uuid.New()
+	assert.True(t, store.TryQueue(sessionID, "default"))
+	assert.False(t, store.TryQueue(sessionID, "default"))
+
+	store.Update(sessionID, func(job *Job) {
+		job.Status = JobFailed
+		job.Error = "failed"
+	})
+	assert.True(t, store.TryQueue(sessionID, "other"))
+	job, _ := store.Get(sessionID)
+	assert.Equal(t, JobQueued, job.Status)
+	assert.Equal(t, "other", job.Pipeline)
+	assert.Empty(t, job.Error)
+}
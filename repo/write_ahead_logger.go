@@ -15,8 +15,10 @@ type LogEntry struct {
 	SessionID   uuid.UUID                    `json:"session_id"`
 	HandlerName string                       `json:"handler_name"`
 	HandlerID   string                       `json:"handler_id"`
+	Pipeline    string                       `json:"pipeline,omitempty"`
 	InputFile   string                       `json:"input_file"`
 	OutputFile  string                       `json:"output_file"`
+	InMemory    bool                         `json:"in_memory,omitempty"`
 	FlowObject  definitions.EngineFlowObject `json:"flow_object"`
 }
 
@@ -100,8 +102,10 @@ func (l *DefaultWriteAheadLogger) WriteEntry(entry LogEntry) {
 		"session_id":   entry.SessionID.String(),
 		"handler_name": entry.HandlerName,
 		"handler_id":   entry.HandlerID,
+		"pipeline":     entry.Pipeline,
 		"input_file":   entry.InputFile,
 		"output_file":  entry.OutputFile,
+		"in_memory":    entry.InMemory,
 		"flow_object":  entry.FlowObject,
 	}).Info("WAL entry recorded")
 }
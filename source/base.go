@@ -0,0 +1,150 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"time"
+)
+
+const (
+	minAcceptRetryDelay = 5 * time.Millisecond
+	maxAcceptRetryDelay = time.Second
+)
+
+// Source feeds jobs to the engine next to the virtual printer.
+type Source interface {
+	Name() string
+	// Run submits jobs to the engine until ctx is done
+	Run(ctx context.Context) error
+}
+
+// Create creates all the configured sources. Their jobs are sent to channel, after being copied to jobsDir.
+func Create(conf config.Config, jobsDir string, channel chan definitions.PrintInfo) ([]Source, error) {
+	var sources []Source
+	for _, folderConf := range conf.Sources.Folders {
+		if !conf.HasPipeline(folderConf.Pipeline) {
+			return nil, fmt.Errorf("folder source %s uses unknown pipeline %s", folderConf.Name, folderConf.Pipeline)
+		}
+		folderSource, err := NewFolderSource(folderConf, conf.Workdir, jobsDir, channel)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, folderSource)
+	}
+	for _, ippConf := range conf.Sources.IPP {
+		if !conf.HasPipeline(ippConf.Pipeline) {
+			return nil, fmt.Errorf("IPP source %s uses unknown pipeline %s", ippConf.Name, ippConf.Pipeline)
+		}
+		ippSource, err := NewIPPSource(ippConf, jobsDir, channel)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, ippSource)
+	}
+	for _, rawConf := range conf.Sources.Raw {
+		if !conf.HasPipeline(rawConf.Pipeline) {
+			return nil, fmt.Errorf("raw source %s uses unknown pipeline %s", rawConf.Name, rawConf.Pipeline)
+		}
+		rawSource, err := NewRawSource(rawConf, jobsDir, channel)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, rawSource)
+	}
+	for _, lpdConf := range conf.Sources.LPD {
+		pipelines := []string{lpdConf.Pipeline}
+		for _, pipeline := range lpdConf.Queues {
+			pipelines = append(pipelines, pipeline)
+		}
+		for _, pipeline := range pipelines {
+			if !conf.HasPipeline(pipeline) {
+				return nil, fmt.Errorf("LPD source %s uses unknown pipeline %s", lpdConf.Name, pipeline)
+			}
+		}
+		lpdSource, err := NewLPDSource(lpdConf, jobsDir, channel)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, lpdSource)
+	}
+	return sources, nil
+}
+
+// RunAll runs the sources in the background until ctx is done.
+func RunAll(ctx context.Context, sources []Source) {
+	for _, s := range sources {
+		go func(s Source) {
+			log.Infof("starting source %s", s.Name())
+			err := s.Run(ctx)
+			if err != nil {
+				log.WithError(err).Errorf("source %s stopped", s.Name())
+			}
+		}(s)
+	}
+}
+
+// serveTCP accepts connections on address until ctx is done, and handles each of them in its own goroutine.
+func serveTCP(ctx context.Context, address string, name string, handle func(conn net.Conn)) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	log.Infof("source %s listening on %s", name, listener.Addr())
+
+	go func() {
+		<-ctx.Done()
+		log.Infof("context canceled, stopping source %s", name)
+		listener.Close()
+	}()
+	return acceptConnections(ctx, listener, name, handle)
+}
+
+// acceptConnections accepts connections until ctx is done or the listener is closed. Other accept errors,
+// such as running out of file descriptors, are retried with a backoff like net/http's server does.
+func acceptConnections(ctx context.Context, listener net.Listener, name string, handle func(conn net.Conn)) error {
+	var delay time.Duration
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return fmt.Errorf("failed to accept connection: %w", err)
+			}
+			if delay == 0 {
+				delay = minAcceptRetryDelay
+			} else {
+				delay = min(2*delay, maxAcceptRetryDelay)
+			}
+			log.WithError(err).Errorf("source %s failed to accept a connection, retrying in %s", name, delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil
+			}
+			continue
+		}
+		delay = 0
+		log.Debugf("source %s accepted connection from %s", name, conn.RemoteAddr())
+		go func() {
+			defer conn.Close()
+			handle(conn)
+		}()
+	}
+}
+
+func submit(ctx context.Context, channel chan definitions.PrintInfo, printInfo definitions.PrintInfo) error {
+	select {
+	case channel <- printInfo:
+		log.Debugf("submitted %s to the engine", printInfo.Filepath)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
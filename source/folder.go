@@ -0,0 +1,160 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/utils"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FolderSource watches hot folders and submits the documents dropped into them.
+type FolderSource struct {
+	conf          config.FolderSourceConfig
+	jobsDir       string
+	quarantineDir string
+	channel       chan definitions.PrintInfo
+}
+
+func NewFolderSource(conf config.FolderSourceConfig, workdir string, jobsDir string, channel chan definitions.PrintInfo) (*FolderSource, error) {
+	if len(conf.Dirs) == 0 {
+		return nil, fmt.Errorf("folder source %s has no dirs", conf.Name)
+	}
+	for _, pattern := range append(append([]string{}, conf.Include...), conf.Exclude...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("folder source %s has an invalid glob %s: %w", conf.Name, pattern, err)
+		}
+	}
+	if conf.Name == "" {
+		conf.Name = strings.Join(conf.Dirs, ",")
+	}
+
+	quarantineDir := conf.QuarantineDir
+	if quarantineDir == "" {
+		quarantineDir = filepath.Join(workdir, "quarantine")
+	}
+
+	return &FolderSource{
+		conf:          conf,
+		jobsDir:       jobsDir,
+		quarantineDir: quarantineDir,
+		channel:       channel,
+	}, nil
+}
+
+func (s *FolderSource) Name() string {
+	return "folder:" + s.conf.Name
+}
+
+func (s *FolderSource) Run(ctx context.Context) error {
+	for _, dir := range s.conf.Dirs {
+		err := os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+		}
+	}
+
+	utils.WatchFiles(ctx, utils.FileWatcherConfig{
+		Dirs:         s.conf.Dirs,
+		StableFor:    time.Duration(s.conf.StableForMs) * time.Millisecond,
+		PollInterval: time.Duration(s.conf.PollIntervalMs) * time.Millisecond,
+		UsePolling:   s.conf.UsePolling,
+		Filter:       s.matches,
+	}, func(path string) {
+		err := s.process(ctx, path)
+		if err != nil {
+			log.WithError(err).Errorf("failed to process %s", path)
+			s.quarantine(path)
+		}
+	})
+	return nil
+}
+
+func (s *FolderSource) matches(path string) bool {
+	name := filepath.Base(path)
+	if len(s.conf.Include) > 0 && !matchesAny(s.conf.Include, name) {
+		return false
+	}
+	return !matchesAny(s.conf.Exclude, name)
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *FolderSource) process(ctx context.Context, path string) error {
+	log.Infof("processing %s from folder source %s", path, s.conf.Name)
+	documentType, err := utils.DetectFileDocumentType(path)
+	if err != nil {
+		return fmt.Errorf("failed to detect document type: %w", err)
+	}
+	if documentType != utils.DocumentPDF && documentType != utils.DocumentXPS && !documentType.IsImage() {
+		return fmt.Errorf("unsupported document type %s", documentType)
+	}
+	log.Debugf("detected %s as %s", path, documentType)
+
+	pages, err := utils.CountPages(path, documentType)
+	if err != nil {
+		return fmt.Errorf("failed to count pages: %w", err)
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	outputPath := filepath.Join(s.jobsDir, fmt.Sprintf("folder_%s%s", uuid.New().String()[0:8], documentType.Extension()))
+	log.Debugf("moving %s to %s", path, outputPath)
+	err = utils.MoveFile(path, outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to move file to jobs directory: %w", err)
+	}
+
+	filename := filepath.Base(path)
+	host, _ := os.Hostname()
+	printInfo := definitions.PrintInfo{
+		Filepath:         outputPath,
+		Pages:            pages,
+		Pipeline:         s.conf.Pipeline,
+		Source:           "folder",
+		Title:            strings.TrimSuffix(filename, filepath.Ext(filename)),
+		Host:             host,
+		Copies:           1,
+		SubmittedAt:      stat.ModTime(),
+		OriginalFilename: filename,
+		Attributes: map[string]string{
+			"Folder":       filepath.Dir(path),
+			"SourceName":   s.conf.Name,
+			"DocumentType": string(documentType),
+		},
+	}
+	return submit(ctx, s.channel, printInfo)
+}
+
+func (s *FolderSource) quarantine(path string) {
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+	err := os.MkdirAll(s.quarantineDir, os.ModePerm)
+	if err != nil {
+		log.WithError(err).Errorf("failed to create quarantine directory %s", s.quarantineDir)
+		return
+	}
+	quarantinePath := filepath.Join(s.quarantineDir, fmt.Sprintf("%s_%s", uuid.New().String()[0:8], filepath.Base(path)))
+	log.Warnf("moving %s to quarantine %s", path, quarantinePath)
+	err = utils.MoveFile(path, quarantinePath)
+	if err != nil {
+		log.WithError(err).Errorf("failed to move %s to quarantine", path)
+	}
+}
@@ -0,0 +1,77 @@
+package source
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/stretchr/testify/assert"
+)
+
+func writePNG(t *testing.T, path string) {
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	assert.NoError(t, png.Encode(file, image.NewRGBA(image.Rect(0, 0, 2, 2))))
+}
+
+func TestFolderSource(t *testing.T) {
+	workdir := t.TempDir()
+	watched := filepath.Join(workdir, "watched")
+	jobsDir := filepath.Join(workdir, "jobs")
+	assert.NoError(t, os.MkdirAll(watched, os.ModePerm))
+	assert.NoError(t, os.MkdirAll(jobsDir, os.ModePerm))
+
+	channel := make(chan definitions.PrintInfo)
+	s, err := NewFolderSource(config.FolderSourceConfig{
+		Name:        "scans",
+		Dirs:        []string{watched},
+		Include:     []string{"*.png", "*.bin"},
+		Exclude:     []string{"ignored*"},
+		Pipeline:    "scans",
+		StableForMs: 50,
+	}, workdir, jobsDir, channel)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	writePNG(t, filepath.Join(watched, "ignored.png"))
+	assert.NoError(t, os.WriteFile(filepath.Join(watched, "unsupported.bin"), []byte{0, 1, 2, 3}, 0644))
+	writePNG(t, filepath.Join(watched, "scan.png"))
+
+	select {
+	case printInfo := <-channel:
+		assert.Equal(t, "scans", printInfo.Pipeline)
+		assert.Equal(t, "folder", printInfo.Source)
+		assert.Equal(t, "scan", printInfo.Title)
+		assert.Equal(t, "scan.png", printInfo.OriginalFilename)
+		assert.Equal(t, 1, printInfo.Pages)
+		assert.Equal(t, jobsDir, filepath.Dir(printInfo.Filepath))
+		assert.FileExists(t, printInfo.Filepath)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the job")
+	}
+
+	assert.Eventually(t, func() bool {
+		entries, err := os.ReadDir(filepath.Join(workdir, "quarantine"))
+		return err == nil && len(entries) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.FileExists(t, filepath.Join(watched, "ignored.png"))
+	assert.NoFileExists(t, filepath.Join(watched, "scan.png"))
+}
+
+func TestNewFolderSource_InvalidGlob(t *testing.T) {
+	_, err := NewFolderSource(config.FolderSourceConfig{
+		Dirs:    []string{t.TempDir()},
+		Include: []string{"[*.pdf"},
+	}, t.TempDir(), t.TempDir(), nil)
+	assert.Error(t, err)
+}
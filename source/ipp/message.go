@@ -0,0 +1,369 @@
+package ipp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Delimiter tags
+const (
+	TagOperationGroup   byte = 0x01
+	TagJobGroup         byte = 0x02
+	TagEndOfAttributes  byte = 0x03
+	TagPrinterGroup     byte = 0x04
+	TagUnsupportedGroup byte = 0x05
+)
+
+// Value tags
+const (
+	TagUnsupportedValue byte = 0x10
+	TagUnknown          byte = 0x12
+	TagNoValue          byte = 0x13
+	TagInteger          byte = 0x21
+	TagBoolean          byte = 0x22
+	TagEnum             byte = 0x23
+	TagOctetString      byte = 0x30
+	TagDateTime         byte = 0x31
+	TagResolution       byte = 0x32
+	TagRangeOfInteger   byte = 0x33
+	TagBeginCollection  byte = 0x34
+	TagTextWithLanguage byte = 0x35
+	TagNameWithLanguage byte = 0x36
+	TagEndCollection    byte = 0x37
+	TagText             byte = 0x41
+	TagName             byte = 0x42
+	TagKeyword          byte = 0x44
+	TagURI              byte = 0x45
+	TagURIScheme        byte = 0x46
+	TagCharset          byte = 0x47
+	TagNaturalLanguage  byte = 0x48
+	TagMimeMediaType    byte = 0x49
+	TagMemberName       byte = 0x4a
+)
+
+// Operations
+const (
+	OperationPrintJob             uint16 = 0x0002
+	OperationValidateJob          uint16 = 0x0004
+	OperationCancelJob            uint16 = 0x0008
+	OperationGetJobAttributes     uint16 = 0x0009
+	OperationGetJobs              uint16 = 0x000a
+	OperationGetPrinterAttributes uint16 = 0x000b
+)
+
+// Status codes
+const (
+	StatusOK                                    uint16 = 0x0000
+	StatusClientErrorBadRequest                 uint16 = 0x0400
+	StatusClientErrorNotFound                   uint16 = 0x0406
+	StatusClientErrorRequestEntityTooLarge      uint16 = 0x0409
+	StatusClientErrorDocumentFormatNotSupported uint16 = 0x040a
+	StatusServerErrorInternalError              uint16 = 0x0500
+	StatusServerErrorOperationNotSupported      uint16 = 0x0501
+	StatusServerErrorVersionNotSupported        uint16 = 0x0503
+)
+
+type Value struct {
+	Tag  byte
+	Data []byte
+}
+
+func (v Value) String() string {
+	return string(v.Data)
+}
+
+func (v Value) Int() int {
+	if len(v.Data) == 1 {
+		return int(v.Data[0])
+	}
+	if len(v.Data) != 4 {
+		return 0
+	}
+	return int(int32(binary.BigEndian.Uint32(v.Data)))
+}
+
+type Attribute struct {
+	Name   string
+	Values []Value
+}
+
+func (a Attribute) String() string {
+	if len(a.Values) == 0 {
+		return ""
+	}
+	return a.Values[0].String()
+}
+
+func (a Attribute) Strings() []string {
+	var values []string
+	for _, value := range a.Values {
+		values = append(values, value.String())
+	}
+	return values
+}
+
+func (a Attribute) Int() int {
+	if len(a.Values) == 0 {
+		return 0
+	}
+	return a.Values[0].Int()
+}
+
+type Group struct {
+	Tag        byte
+	Attributes []Attribute
+}
+
+func (g *Group) Add(attributes ...Attribute) {
+	g.Attributes = append(g.Attributes, attributes...)
+}
+
+func (g Group) Get(name string) (Attribute, bool) {
+	for _, attribute := range g.Attributes {
+		if attribute.Name == name {
+			return attribute, true
+		}
+	}
+	return Attribute{}, false
+}
+
+// Message is an IPP request or response, without the document data that follows it.
+type Message struct {
+	VersionMajor byte
+	VersionMinor byte
+	// Code is the operation-id of a request or the status-code of a response
+	Code      uint16
+	RequestID uint32
+	Groups    []Group
+}
+
+// Group returns the first group with the tag.
+func (m *Message) Group(tag byte) (Group, bool) {
+	for _, group := range m.Groups {
+		if group.Tag == tag {
+			return group, true
+		}
+	}
+	return Group{}, false
+}
+
+func (m *Message) Encode(w io.Writer) error {
+	header := make([]byte, 8)
+	header[0] = m.VersionMajor
+	header[1] = m.VersionMinor
+	binary.BigEndian.PutUint16(header[2:], m.Code)
+	binary.BigEndian.PutUint32(header[4:], m.RequestID)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	for _, group := range m.Groups {
+		if _, err := w.Write([]byte{group.Tag}); err != nil {
+			return err
+		}
+		for _, attribute := range group.Attributes {
+			for i, value := range attribute.Values {
+				name := attribute.Name
+				if i > 0 {
+					name = ""
+				}
+				if err := writeAttributeValue(w, value.Tag, name, value.Data); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	_, err := w.Write([]byte{TagEndOfAttributes})
+	return err
+}
+
+func writeAttributeValue(w io.Writer, tag byte, name string, data []byte) error {
+	buffer := make([]byte, 0, 5+len(name)+len(data))
+	buffer = append(buffer, tag)
+	buffer = binary.BigEndian.AppendUint16(buffer, uint16(len(name)))
+	buffer = append(buffer, name...)
+	buffer = binary.BigEndian.AppendUint16(buffer, uint16(len(data)))
+	buffer = append(buffer, data...)
+	_, err := w.Write(buffer)
+	return err
+}
+
+// Decode reads a message from r, leaving r at the beginning of the document data.
+func Decode(r io.Reader) (*Message, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	m := &Message{
+		VersionMajor: header[0],
+		VersionMinor: header[1],
+		Code:         binary.BigEndian.Uint16(header[2:]),
+		RequestID:    binary.BigEndian.Uint32(header[4:]),
+	}
+
+	var group *Group
+	tag := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(r, tag); err != nil {
+			return nil, fmt.Errorf("failed to read tag: %w", err)
+		}
+		if tag[0] == TagEndOfAttributes {
+			return m, nil
+		}
+		if tag[0] < 0x10 {
+			m.Groups = append(m.Groups, Group{Tag: tag[0]})
+			group = &m.Groups[len(m.Groups)-1]
+			continue
+		}
+		if group == nil {
+			return nil, errors.New("attribute outside of a group")
+		}
+
+		name, err := readString(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attribute name: %w", err)
+		}
+		data, err := readString(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attribute value: %w", err)
+		}
+		value := Value{Tag: tag[0], Data: []byte(data)}
+		if name == "" {
+			if len(group.Attributes) == 0 {
+				return nil, errors.New("additional value without an attribute")
+			}
+			last := &group.Attributes[len(group.Attributes)-1]
+			last.Values = append(last.Values, value)
+			continue
+		}
+		group.Attributes = append(group.Attributes, Attribute{Name: name, Values: []Value{value}})
+	}
+}
+
+func readString(r io.Reader) (string, error) {
+	length := make([]byte, 2)
+	if _, err := io.ReadFull(r, length); err != nil {
+		return "", err
+	}
+	data := make([]byte, binary.BigEndian.Uint16(length))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func newStringAttribute(tag byte, name string, values ...string) Attribute {
+	attribute := Attribute{Name: name}
+	for _, value := range values {
+		attribute.Values = append(attribute.Values, Value{Tag: tag, Data: []byte(value)})
+	}
+	return attribute
+}
+
+func newIntAttribute(tag byte, name string, values ...int) Attribute {
+	attribute := Attribute{Name: name}
+	for _, value := range values {
+		attribute.Values = append(attribute.Values, Value{Tag: tag, Data: binary.BigEndian.AppendUint32(nil, uint32(int32(value)))})
+	}
+	return attribute
+}
+
+func Keyword(name string, values ...string) Attribute {
+	return newStringAttribute(TagKeyword, name, values...)
+}
+
+func Text(name string, values ...string) Attribute {
+	return newStringAttribute(TagText, name, values...)
+}
+
+func Name(name string, values ...string) Attribute {
+	return newStringAttribute(TagName, name, values...)
+}
+
+func URI(name string, values ...string) Attribute {
+	return newStringAttribute(TagURI, name, values...)
+}
+
+func Charset(name string, values ...string) Attribute {
+	return newStringAttribute(TagCharset, name, values...)
+}
+
+func NaturalLanguage(name string, values ...string) Attribute {
+	return newStringAttribute(TagNaturalLanguage, name, values...)
+}
+
+func MimeMediaType(name string, values ...string) Attribute {
+	return newStringAttribute(TagMimeMediaType, name, values...)
+}
+
+func Integer(name string, values ...int) Attribute {
+	return newIntAttribute(TagInteger, name, values...)
+}
+
+func Enum(name string, values ...int) Attribute {
+	return newIntAttribute(TagEnum, name, values...)
+}
+
+func Boolean(name string, value bool) Attribute {
+	data := []byte{0}
+	if value {
+		data[0] = 1
+	}
+	return Attribute{Name: name, Values: []Value{{Tag: TagBoolean, Data: data}}}
+}
+
+func RangeOfInteger(name string, lower, upper int) Attribute {
+	data := binary.BigEndian.AppendUint32(nil, uint32(int32(lower)))
+	data = binary.BigEndian.AppendUint32(data, uint32(int32(upper)))
+	return Attribute{Name: name, Values: []Value{{Tag: TagRangeOfInteger, Data: data}}}
+}
+
+func Resolution(name string, x, y int) Attribute {
+	data := binary.BigEndian.AppendUint32(nil, uint32(int32(x)))
+	data = binary.BigEndian.AppendUint32(data, uint32(int32(y)))
+	data = append(data, 3) // dots per inch
+	return Attribute{Name: name, Values: []Value{{Tag: TagResolution, Data: data}}}
+}
+
+// NewRequest creates an IPP/2.0 request with the required operation attributes.
+func NewRequest(operation uint16, requestID uint32, printerURI string) *Message {
+	return &Message{
+		VersionMajor: 2,
+		VersionMinor: 0,
+		Code:         operation,
+		RequestID:    requestID,
+		Groups: []Group{{
+			Tag: TagOperationGroup,
+			Attributes: []Attribute{
+				Charset("attributes-charset", "utf-8"),
+				NaturalLanguage("attributes-natural-language", "en"),
+				URI("printer-uri", printerURI),
+			},
+		}},
+	}
+}
+
+// NewResponse creates a response to the request with the required operation attributes.
+func NewResponse(request *Message, status uint16) *Message {
+	// the response has the supported version closest to the request's
+	major, minor := byte(2), byte(0)
+	if request.VersionMajor == 1 {
+		major, minor = 1, 1
+	}
+	return &Message{
+		VersionMajor: major,
+		VersionMinor: minor,
+		Code:         status,
+		RequestID:    request.RequestID,
+		Groups: []Group{{
+			Tag: TagOperationGroup,
+			Attributes: []Attribute{
+				Charset("attributes-charset", "utf-8"),
+				NaturalLanguage("attributes-natural-language", "en"),
+			},
+		}},
+	}
+}
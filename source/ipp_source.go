@@ -0,0 +1,518 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/consts"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/source/ipp"
+	"github.com/benyaa/virtual-printer-process-engine/utils"
+	"github.com/google/uuid"
+	"github.com/grandcat/zeroconf"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ippJobStateCompleted = 9
+	ippJobStateAborted   = 8
+	ippPrinterStateIdle  = 3
+	maxIPPJobsHistory    = 100
+)
+
+var ippSupportedDocumentFormats = []string{"application/pdf", "application/octet-stream"}
+
+// IPPSource is an IPP/2.0 print server that accepts PDF documents.
+type IPPSource struct {
+	conf      config.IPPSourceConfig
+	jobsDir   string
+	channel   chan definitions.PrintInfo
+	uuid      string
+	startedAt time.Time
+
+	mutex     sync.Mutex
+	nextJobID int
+	jobs      []*ippJob
+}
+
+type ippJob struct {
+	id          int
+	name        string
+	user        string
+	state       int
+	pages       int
+	createdAt   time.Time
+	completedAt time.Time
+}
+
+func NewIPPSource(conf config.IPPSourceConfig, jobsDir string, channel chan definitions.PrintInfo) (*IPPSource, error) {
+	if conf.Name == "" {
+		return nil, fmt.Errorf("IPP source must have a name")
+	}
+	if conf.Address == "" {
+		conf.Address = ":8631"
+	}
+	if conf.Path == "" {
+		conf.Path = "/ipp/print"
+	}
+	if !strings.HasPrefix(conf.Path, "/") {
+		conf.Path = "/" + conf.Path
+	}
+	if conf.MakeAndModel == "" {
+		conf.MakeAndModel = consts.AppName
+	}
+	if conf.MaxJobSizeMB == 0 {
+		conf.MaxJobSizeMB = 100
+	}
+
+	return &IPPSource{
+		conf:      conf,
+		jobsDir:   jobsDir,
+		channel:   channel,
+		uuid:      uuid.NewSHA1(uuid.NameSpaceURL, []byte("ipp://"+conf.Name)).String(),
+		startedAt: time.Now(),
+		nextJobID: 1,
+	}, nil
+}
+
+func (s *IPPSource) Name() string {
+	return "ipp:" + s.conf.Name
+}
+
+func (s *IPPSource) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.conf.Address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.conf.Address, err)
+	}
+	log.Infof("IPP printer %s listening on %s%s", s.conf.Name, listener.Addr(), s.conf.Path)
+
+	if s.conf.Advertise {
+		port := listener.Addr().(*net.TCPAddr).Port
+		advertiser, err := zeroconf.Register(s.conf.Name, "_ipp._tcp,_print", "local.", port, s.getTXTRecords(), nil)
+		if err != nil {
+			log.WithError(err).Errorf("failed to advertise IPP printer %s", s.conf.Name)
+		} else {
+			defer advertiser.Shutdown()
+		}
+	}
+
+	server := &http.Server{Handler: s}
+	go func() {
+		<-ctx.Done()
+		log.Infof("context canceled, stopping IPP printer %s", s.conf.Name)
+		server.Shutdown(context.Background())
+	}()
+
+	err = server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *IPPSource) getTXTRecords() []string {
+	return []string{
+		"txtvers=1",
+		"qtotal=1",
+		"rp=" + strings.TrimPrefix(s.conf.Path, "/"),
+		"ty=" + s.conf.MakeAndModel,
+		"product=(" + s.conf.MakeAndModel + ")",
+		"note=" + s.conf.Location,
+		"pdl=application/pdf",
+		"UUID=" + s.uuid,
+		"kind=document",
+		"Color=T",
+		"Duplex=F",
+		"TLS=",
+	}
+}
+
+func (s *IPPSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != s.conf.Path {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	request, err := ipp.Decode(r.Body)
+	if err != nil {
+		log.WithError(err).Warnf("failed to decode IPP request from %s", r.RemoteAddr)
+		http.Error(w, "bad IPP request", http.StatusBadRequest)
+		return
+	}
+	log.Debugf("received IPP operation 0x%04x from %s", request.Code, r.RemoteAddr)
+
+	response := s.handle(r, request)
+	w.Header().Set("Content-Type", "application/ipp")
+	err = response.Encode(w)
+	if err != nil {
+		log.WithError(err).Errorf("failed to write IPP response to %s", r.RemoteAddr)
+	}
+}
+
+func (s *IPPSource) handle(r *http.Request, request *ipp.Message) *ipp.Message {
+	if request.VersionMajor != 1 && request.VersionMajor != 2 {
+		return ipp.NewResponse(request, ipp.StatusServerErrorVersionNotSupported)
+	}
+	operation, ok := request.Group(ipp.TagOperationGroup)
+	if !ok {
+		return ipp.NewResponse(request, ipp.StatusClientErrorBadRequest)
+	}
+	if _, ok := operation.Get("attributes-charset"); !ok {
+		return ipp.NewResponse(request, ipp.StatusClientErrorBadRequest)
+	}
+
+	switch request.Code {
+	case ipp.OperationPrintJob:
+		return s.printJob(r, request, operation)
+	case ipp.OperationValidateJob:
+		return s.validateJob(request, operation)
+	case ipp.OperationGetPrinterAttributes:
+		return s.getPrinterAttributes(r, request, operation)
+	case ipp.OperationGetJobs:
+		return s.getJobs(r, request, operation)
+	case ipp.OperationGetJobAttributes:
+		return s.getJobAttributes(r, request, operation)
+	}
+	return ipp.NewResponse(request, ipp.StatusServerErrorOperationNotSupported)
+}
+
+func (s *IPPSource) getPrinterURI(r *http.Request) string {
+	return "ipp://" + r.Host + s.conf.Path
+}
+
+func isSupportedDocumentFormat(operation ipp.Group) bool {
+	format, ok := operation.Get("document-format")
+	if !ok {
+		return true
+	}
+	for _, supported := range ippSupportedDocumentFormats {
+		if format.String() == supported {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *IPPSource) validateJob(request *ipp.Message, operation ipp.Group) *ipp.Message {
+	if !isSupportedDocumentFormat(operation) {
+		return ipp.NewResponse(request, ipp.StatusClientErrorDocumentFormatNotSupported)
+	}
+	return ipp.NewResponse(request, ipp.StatusOK)
+}
+
+func (s *IPPSource) printJob(r *http.Request, request *ipp.Message, operation ipp.Group) *ipp.Message {
+	if !isSupportedDocumentFormat(operation) {
+		return ipp.NewResponse(request, ipp.StatusClientErrorDocumentFormatNotSupported)
+	}
+
+	outputPath := filepath.Join(s.jobsDir, fmt.Sprintf("ipp_%s.pdf", uuid.New().String()[0:8]))
+	status, err := s.spoolDocument(r.Body, outputPath)
+	if err != nil {
+		log.WithError(err).Errorf("failed to spool IPP document from %s", r.RemoteAddr)
+		os.Remove(outputPath)
+		return ipp.NewResponse(request, status)
+	}
+
+	pages, err := utils.CountPages(outputPath, utils.DocumentPDF)
+	if err != nil {
+		log.WithError(err).Errorf("failed to count pages of IPP document from %s", r.RemoteAddr)
+		os.Remove(outputPath)
+		return ipp.NewResponse(request, ipp.StatusClientErrorBadRequest)
+	}
+
+	printInfo := s.getPrintInfo(r, request)
+	printInfo.Filepath = outputPath
+	printInfo.Pages = pages
+
+	job := s.addJob(printInfo)
+	err = submit(r.Context(), s.channel, printInfo)
+	s.mutex.Lock()
+	job.completedAt = time.Now()
+	job.state = ippJobStateCompleted
+	if err != nil {
+		job.state = ippJobStateAborted
+	}
+	s.mutex.Unlock()
+	if err != nil {
+		log.WithError(err).Errorf("failed to submit IPP job %d", job.id)
+		os.Remove(outputPath)
+		return ipp.NewResponse(request, ipp.StatusServerErrorInternalError)
+	}
+	log.Infof("IPP job %d from %s submitted as %s", job.id, r.RemoteAddr, outputPath)
+
+	response := ipp.NewResponse(request, ipp.StatusOK)
+	response.Groups = append(response.Groups, s.getJobGroup(r, job, nil))
+	return response
+}
+
+// spoolDocument writes the document data to outputPath, and returns the IPP status to respond with on failure.
+func (s *IPPSource) spoolDocument(body io.Reader, outputPath string) (uint16, error) {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return ipp.StatusServerErrorInternalError, err
+	}
+	defer file.Close()
+
+	maxSize := int64(s.conf.MaxJobSizeMB) * 1024 * 1024
+	written, err := io.Copy(file, io.LimitReader(body, maxSize+1))
+	if err != nil {
+		return ipp.StatusServerErrorInternalError, err
+	}
+	if written > maxSize {
+		return ipp.StatusClientErrorRequestEntityTooLarge, fmt.Errorf("document is larger than %d MB", s.conf.MaxJobSizeMB)
+	}
+
+	documentType, err := utils.DetectFileDocumentType(outputPath)
+	if err != nil {
+		return ipp.StatusServerErrorInternalError, err
+	}
+	if documentType != utils.DocumentPDF {
+		return ipp.StatusClientErrorDocumentFormatNotSupported, fmt.Errorf("unsupported document type %s", documentType)
+	}
+	return ipp.StatusOK, nil
+}
+
+func (s *IPPSource) getPrintInfo(r *http.Request, request *ipp.Message) definitions.PrintInfo {
+	attributes := map[string]string{}
+	for _, group := range request.Groups {
+		if group.Tag != ipp.TagOperationGroup && group.Tag != ipp.TagJobGroup {
+			continue
+		}
+		for _, attribute := range group.Attributes {
+			if value, ok := getIPPAttributeValue(attribute); ok {
+				attributes[attribute.Name] = value
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	title := attributes["job-name"]
+	filename := attributes["document-name"]
+	if filename == "" {
+		filename = title
+	}
+	copies := 1
+	if jobGroup, ok := request.Group(ipp.TagJobGroup); ok {
+		if attribute, ok := jobGroup.Get("copies"); ok && attribute.Int() > 0 {
+			copies = attribute.Int()
+		}
+	}
+
+	return definitions.PrintInfo{
+		Pipeline:         s.conf.Pipeline,
+		Source:           "ipp",
+		Title:            title,
+		User:             attributes["requesting-user-name"],
+		Host:             host,
+		Copies:           copies,
+		SubmittedAt:      time.Now(),
+		OriginalFilename: filename,
+		Attributes:       attributes,
+	}
+}
+
+func getIPPAttributeValue(attribute ipp.Attribute) (string, bool) {
+	var values []string
+	for _, value := range attribute.Values {
+		switch value.Tag {
+		case ipp.TagInteger, ipp.TagEnum:
+			values = append(values, strconv.Itoa(value.Int()))
+		case ipp.TagBoolean:
+			values = append(values, strconv.FormatBool(value.Int() != 0))
+		case ipp.TagText, ipp.TagName, ipp.TagKeyword, ipp.TagURI, ipp.TagURIScheme, ipp.TagCharset,
+			ipp.TagNaturalLanguage, ipp.TagMimeMediaType:
+			values = append(values, value.String())
+		default:
+			return "", false
+		}
+	}
+	return strings.Join(values, ","), true
+}
+
+func (s *IPPSource) addJob(printInfo definitions.PrintInfo) *ippJob {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job := &ippJob{
+		id:        s.nextJobID,
+		name:      printInfo.Title,
+		user:      printInfo.User,
+		pages:     printInfo.Pages,
+		createdAt: printInfo.SubmittedAt,
+	}
+	s.nextJobID++
+	s.jobs = append(s.jobs, job)
+	if len(s.jobs) > maxIPPJobsHistory {
+		s.jobs = s.jobs[len(s.jobs)-maxIPPJobsHistory:]
+	}
+	return job
+}
+
+func getRequestedAttributes(operation ipp.Group) map[string]bool {
+	attribute, ok := operation.Get("requested-attributes")
+	if !ok {
+		return nil
+	}
+	requested := map[string]bool{}
+	for _, name := range attribute.Strings() {
+		if name == "all" || strings.HasSuffix(name, "-description") || strings.HasSuffix(name, "-template") {
+			return nil
+		}
+		requested[name] = true
+	}
+	return requested
+}
+
+func filterAttributes(group ipp.Group, requested map[string]bool) ipp.Group {
+	if requested == nil {
+		return group
+	}
+	filtered := ipp.Group{Tag: group.Tag}
+	for _, attribute := range group.Attributes {
+		if requested[attribute.Name] {
+			filtered.Add(attribute)
+		}
+	}
+	return filtered
+}
+
+func (s *IPPSource) getPrinterAttributes(r *http.Request, request *ipp.Message, operation ipp.Group) *ipp.Message {
+	printer := ipp.Group{Tag: ipp.TagPrinterGroup}
+	printer.Add(
+		ipp.URI("printer-uri-supported", s.getPrinterURI(r)),
+		ipp.Keyword("uri-security-supported", "none"),
+		ipp.Keyword("uri-authentication-supported", "none"),
+		ipp.Name("printer-name", s.conf.Name),
+		ipp.Text("printer-info", s.conf.Info),
+		ipp.Text("printer-location", s.conf.Location),
+		ipp.Text("printer-make-and-model", s.conf.MakeAndModel),
+		ipp.URI("printer-uuid", "urn:uuid:"+s.uuid),
+		ipp.Enum("printer-state", ippPrinterStateIdle),
+		ipp.Keyword("printer-state-reasons", "none"),
+		ipp.Boolean("printer-is-accepting-jobs", true),
+		// jobs are handed to the engine as soon as they are received, so none are ever queued
+		ipp.Integer("queued-job-count", 0),
+		ipp.Integer("printer-up-time", int(time.Since(s.startedAt).Seconds())+1),
+		ipp.Keyword("ipp-versions-supported", "1.1", "2.0"),
+		ipp.Keyword("ipp-features-supported", "ipp-everywhere"),
+		ipp.Enum("operations-supported",
+			int(ipp.OperationPrintJob),
+			int(ipp.OperationValidateJob),
+			int(ipp.OperationGetJobAttributes),
+			int(ipp.OperationGetJobs),
+			int(ipp.OperationGetPrinterAttributes)),
+		ipp.Charset("charset-configured", "utf-8"),
+		ipp.Charset("charset-supported", "utf-8"),
+		ipp.NaturalLanguage("natural-language-configured", "en"),
+		ipp.NaturalLanguage("generated-natural-language-supported", "en"),
+		ipp.MimeMediaType("document-format-default", "application/pdf"),
+		ipp.MimeMediaType("document-format-supported", ippSupportedDocumentFormats...),
+		ipp.Keyword("pdl-override-supported", "attempted"),
+		ipp.Keyword("compression-supported", "none"),
+		ipp.Integer("copies-default", 1),
+		ipp.RangeOfInteger("copies-supported", 1, 999),
+		ipp.Boolean("color-supported", true),
+		ipp.Keyword("sides-default", "one-sided"),
+		ipp.Keyword("sides-supported", "one-sided"),
+		ipp.Keyword("media-default", "iso_a4_210x297mm"),
+		ipp.Keyword("media-supported", "iso_a4_210x297mm", "na_letter_8.5x11in"),
+		ipp.Keyword("print-color-mode-default", "color"),
+		ipp.Keyword("print-color-mode-supported", "color", "monochrome"),
+		ipp.Resolution("printer-resolution-default", 300, 300),
+		ipp.Resolution("printer-resolution-supported", 300, 300),
+		ipp.Keyword("which-jobs-supported", "completed", "not-completed"),
+		ipp.Keyword("job-creation-attributes-supported", "copies", "media", "sides", "print-color-mode"),
+		ipp.RangeOfInteger("job-k-octets-supported", 0, s.conf.MaxJobSizeMB*1024),
+	)
+
+	response := ipp.NewResponse(request, ipp.StatusOK)
+	response.Groups = append(response.Groups, filterAttributes(printer, getRequestedAttributes(operation)))
+	return response
+}
+
+func (s *IPPSource) getJobGroup(r *http.Request, job *ippJob, requested map[string]bool) ipp.Group {
+	stateReason := "job-completed-successfully"
+	if job.state == ippJobStateAborted {
+		stateReason = "aborted-by-system"
+	}
+	group := ipp.Group{Tag: ipp.TagJobGroup}
+	group.Add(
+		ipp.Integer("job-id", job.id),
+		ipp.URI("job-uri", fmt.Sprintf("%s/%d", s.getPrinterURI(r), job.id)),
+		ipp.URI("job-printer-uri", s.getPrinterURI(r)),
+		ipp.Name("job-name", job.name),
+		ipp.Name("job-originating-user-name", job.user),
+		ipp.Enum("job-state", job.state),
+		ipp.Keyword("job-state-reasons", stateReason),
+		ipp.Integer("job-impressions-completed", job.pages),
+		ipp.Integer("time-at-creation", int(job.createdAt.Sub(s.startedAt).Seconds())+1),
+		ipp.Integer("time-at-completed", int(job.completedAt.Sub(s.startedAt).Seconds())+1),
+	)
+	return filterAttributes(group, requested)
+}
+
+func (s *IPPSource) getJobs(r *http.Request, request *ipp.Message, operation ipp.Group) *ipp.Message {
+	whichJobs := "not-completed"
+	if attribute, ok := operation.Get("which-jobs"); ok {
+		whichJobs = attribute.String()
+	}
+	limit := 0
+	if attribute, ok := operation.Get("limit"); ok {
+		limit = attribute.Int()
+	}
+	requested := getRequestedAttributes(operation)
+	if _, ok := operation.Get("requested-attributes"); !ok {
+		requested = map[string]bool{"job-id": true, "job-uri": true}
+	}
+
+	response := ipp.NewResponse(request, ipp.StatusOK)
+	// jobs are handed to the engine as soon as they are received, so no job is pending
+	if whichJobs == "not-completed" {
+		return response
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for i := len(s.jobs) - 1; i >= 0; i-- {
+		if limit > 0 && len(response.Groups)-1 >= limit {
+			break
+		}
+		response.Groups = append(response.Groups, s.getJobGroup(r, s.jobs[i], requested))
+	}
+	return response
+}
+
+func (s *IPPSource) getJobAttributes(r *http.Request, request *ipp.Message, operation ipp.Group) *ipp.Message {
+	attribute, ok := operation.Get("job-id")
+	if !ok {
+		return ipp.NewResponse(request, ipp.StatusClientErrorBadRequest)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, job := range s.jobs {
+		if job.id == attribute.Int() {
+			response := ipp.NewResponse(request, ipp.StatusOK)
+			response.Groups = append(response.Groups, s.getJobGroup(r, job, getRequestedAttributes(operation)))
+			return response
+		}
+	}
+	return ipp.NewResponse(request, ipp.StatusClientErrorNotFound)
+}
@@ -0,0 +1,327 @@
+package source
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/source/ipp"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func createPDF(t *testing.T) []byte {
+	img := &bytes.Buffer{}
+	assert.NoError(t, png.Encode(img, image.NewRGBA(image.Rect(0, 0, 2, 2))))
+	pdf := &bytes.Buffer{}
+	assert.NoError(t, api.ImportImages(nil, pdf, []io.Reader{img}, nil, nil))
+	return pdf.Bytes()
+}
+
+func sendIPPRequest(t *testing.T, url string, request *ipp.Message, document []byte) *ipp.Message {
+	body := &bytes.Buffer{}
+	assert.NoError(t, request.Encode(body))
+	body.Write(document)
+
+	resp, err := http.Post(url, "application/ipp", body)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/ipp", resp.Header.Get("Content-Type"))
+
+	response, err := ipp.Decode(resp.Body)
+	assert.NoError(t, err)
+	return response
+}
+
+func newTestIPPSource(t *testing.T, channel chan definitions.PrintInfo) (*IPPSource, string) {
+	s, err := NewIPPSource(config.IPPSourceConfig{
+		Name:     "Office",
+		Pipeline: "office",
+	}, t.TempDir(), channel)
+	assert.NoError(t, err)
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return s, server.URL + "/ipp/print"
+}
+
+func TestIPPSource_GetPrinterAttributes(t *testing.T) {
+	_, url := newTestIPPSource(t, nil)
+
+	request := ipp.NewRequest(ipp.OperationGetPrinterAttributes, 1, "ipp://localhost/ipp/print")
+	request.Groups[0].Add(ipp.Keyword("requested-attributes", "printer-name", "document-format-supported"))
+	response := sendIPPRequest(t, url, request, nil)
+
+	assert.Equal(t, ipp.StatusOK, response.Code)
+	assert.Equal(t, uint32(1), response.RequestID)
+	printer, ok := response.Group(ipp.TagPrinterGroup)
+	assert.True(t, ok)
+	assert.Len(t, printer.Attributes, 2)
+	name, _ := printer.Get("printer-name")
+	assert.Equal(t, "Office", name.String())
+	formats, _ := printer.Get("document-format-supported")
+	assert.Contains(t, formats.Strings(), "application/pdf")
+}
+
+func TestIPPSource_PrintJob(t *testing.T) {
+	channel := make(chan definitions.PrintInfo, 1)
+	_, url := newTestIPPSource(t, channel)
+
+	request := ipp.NewRequest(ipp.OperationPrintJob, 2, "ipp://localhost/ipp/print")
+	request.Groups[0].Add(
+		ipp.Name("requesting-user-name", "alice"),
+		ipp.Name("job-name", "report"),
+		ipp.MimeMediaType("document-format", "application/pdf"),
+	)
+	request.Groups = append(request.Groups, ipp.Group{Tag: ipp.TagJobGroup, Attributes: []ipp.Attribute{
+		ipp.Integer("copies", 3),
+		ipp.Keyword("media", "iso_a4_210x297mm"),
+	}})
+	response := sendIPPRequest(t, url, request, createPDF(t))
+
+	assert.Equal(t, ipp.StatusOK, response.Code)
+	job, ok := response.Group(ipp.TagJobGroup)
+	assert.True(t, ok)
+	jobID, _ := job.Get("job-id")
+	assert.Equal(t, 1, jobID.Int())
+
+	select {
+	case printInfo := <-channel:
+		assert.Equal(t, "office", printInfo.Pipeline)
+		assert.Equal(t, "ipp", printInfo.Source)
+		assert.Equal(t, "report", printInfo.Title)
+		assert.Equal(t, "alice", printInfo.User)
+		assert.Equal(t, 3, printInfo.Copies)
+		assert.Equal(t, 1, printInfo.Pages)
+		assert.Equal(t, "iso_a4_210x297mm", printInfo.Attributes["media"])
+		assert.FileExists(t, printInfo.Filepath)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the job")
+	}
+
+	request = ipp.NewRequest(ipp.OperationGetJobs, 3, "ipp://localhost/ipp/print")
+	request.Groups[0].Add(ipp.Keyword("which-jobs", "completed"))
+	response = sendIPPRequest(t, url, request, nil)
+	assert.Equal(t, ipp.StatusOK, response.Code)
+	assert.Len(t, response.Groups, 2)
+}
+
+func TestIPPSource_UnsupportedRequests(t *testing.T) {
+	_, url := newTestIPPSource(t, nil)
+
+	request := ipp.NewRequest(ipp.OperationValidateJob, 1, "ipp://localhost/ipp/print")
+	request.Groups[0].Add(ipp.MimeMediaType("document-format", "application/postscript"))
+	assert.Equal(t, ipp.StatusClientErrorDocumentFormatNotSupported, sendIPPRequest(t, url, request, nil).Code)
+
+	request = ipp.NewRequest(ipp.OperationPrintJob, 2, "ipp://localhost/ipp/print")
+	assert.Equal(t, ipp.StatusClientErrorDocumentFormatNotSupported, sendIPPRequest(t, url, request, []byte("hello")).Code)
+
+	request = ipp.NewRequest(ipp.OperationCancelJob, 3, "ipp://localhost/ipp/print")
+	assert.Equal(t, ipp.StatusServerErrorOperationNotSupported, sendIPPRequest(t, url, request, nil).Code)
+
+	resp, err := http.Post(strings.TrimSuffix(url, "/print"), "application/ipp", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+// The wire tests build the requests and parse the responses byte by byte, following RFC 8010,
+// so they don't share the ipp package's encoder and decoder with the source.
+
+// wireAttribute encodes an attribute with a single value, or an additional value when name is empty.
+func wireAttribute(tag byte, name string, value []byte) []byte {
+	encoded := []byte{tag, byte(len(name) >> 8), byte(len(name))}
+	encoded = append(encoded, name...)
+	encoded = append(encoded, byte(len(value)>>8), byte(len(value)))
+	return append(encoded, value...)
+}
+
+// wireRequest encodes an IPP/1.1 request with the required operation attributes, like ipptool sends them.
+func wireRequest(operation uint16, requestID uint32, attributes ...[]byte) []byte {
+	request := []byte{
+		0x01, 0x01,
+		byte(operation >> 8), byte(operation),
+		byte(requestID >> 24), byte(requestID >> 16), byte(requestID >> 8), byte(requestID),
+		// operation-attributes-tag
+		0x01,
+	}
+	request = append(request, wireAttribute(0x47, "attributes-charset", []byte("utf-8"))...)
+	request = append(request, wireAttribute(0x48, "attributes-natural-language", []byte("en-us"))...)
+	request = append(request, wireAttribute(0x45, "printer-uri", []byte("ipp://localhost/ipp/print"))...)
+	request = append(request, wireAttribute(0x42, "requesting-user-name", []byte("bob"))...)
+	for _, attribute := range attributes {
+		request = append(request, attribute...)
+	}
+	// end-of-attributes-tag
+	return append(request, 0x03)
+}
+
+type wireGroup struct {
+	tag        byte
+	names      []string
+	attributes map[string][][]byte
+}
+
+type wireResponse struct {
+	version   [2]byte
+	status    uint16
+	requestID uint32
+	groups    []wireGroup
+}
+
+func (r wireResponse) groupsOf(tag byte) []wireGroup {
+	var groups []wireGroup
+	for _, group := range r.groups {
+		if group.tag == tag {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+func parseWireResponse(t *testing.T, body []byte) wireResponse {
+	if !assert.GreaterOrEqual(t, len(body), 9) {
+		t.FailNow()
+	}
+	response := wireResponse{
+		version:   [2]byte{body[0], body[1]},
+		status:    uint16(body[2])<<8 | uint16(body[3]),
+		requestID: uint32(body[4])<<24 | uint32(body[5])<<16 | uint32(body[6])<<8 | uint32(body[7]),
+	}
+	i := 8
+	last := ""
+	for i < len(body) {
+		tag := body[i]
+		i++
+		if tag == 0x03 {
+			assert.Equal(t, len(body), i, "nothing follows the end of the attributes")
+			return response
+		}
+		if tag < 0x10 {
+			response.groups = append(response.groups, wireGroup{tag: tag, attributes: map[string][][]byte{}})
+			continue
+		}
+		if !assert.NotEmpty(t, response.groups, "an attribute outside of a group") || !assert.LessOrEqual(t, i+2, len(body)) {
+			t.FailNow()
+		}
+		group := &response.groups[len(response.groups)-1]
+		nameLength := int(body[i])<<8 | int(body[i+1])
+		name := string(body[i+2 : i+2+nameLength])
+		i += 2 + nameLength
+		valueLength := int(body[i])<<8 | int(body[i+1])
+		value := body[i+2 : i+2+valueLength]
+		i += 2 + valueLength
+		if name == "" {
+			name = last
+		} else {
+			group.names = append(group.names, name)
+		}
+		group.attributes[name] = append(group.attributes[name], value)
+		last = name
+	}
+	t.Fatal("the response has no end of attributes tag")
+	return response
+}
+
+func postWireRequest(t *testing.T, url string, request []byte, document []byte) wireResponse {
+	resp, err := http.Post(url, "application/ipp", bytes.NewReader(append(request, document...)))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/ipp", resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	response := parseWireResponse(t, body)
+	assert.Equal(t, [2]byte{1, 1}, response.version, "the response has the request's version")
+	operation := response.groupsOf(0x01)
+	if assert.Len(t, operation, 1) {
+		// the charset and natural language come first, in this order
+		assert.Equal(t, []string{"attributes-charset", "attributes-natural-language"}, operation[0].names[:2])
+		assert.Equal(t, [][]byte{[]byte("utf-8")}, operation[0].attributes["attributes-charset"])
+	}
+	return response
+}
+
+func TestIPPSource_WireGetPrinterAttributes(t *testing.T) {
+	_, url := newTestIPPSource(t, nil)
+
+	response := postWireRequest(t, url, wireRequest(0x000b, 7,
+		// requested-attributes is a 1setOf keyword, its additional values have no name
+		wireAttribute(0x44, "requested-attributes", []byte("printer-name")),
+		wireAttribute(0x44, "", []byte("document-format-supported")),
+		wireAttribute(0x44, "", []byte("printer-state")),
+	), nil)
+
+	assert.Equal(t, uint16(0x0000), response.status)
+	assert.Equal(t, uint32(7), response.requestID)
+	printer := response.groupsOf(0x04)
+	if !assert.Len(t, printer, 1) {
+		return
+	}
+	assert.ElementsMatch(t, []string{"printer-name", "document-format-supported", "printer-state"}, printer[0].names)
+	assert.Equal(t, [][]byte{[]byte("Office")}, printer[0].attributes["printer-name"])
+	assert.Equal(t, [][]byte{[]byte("application/pdf"), []byte("application/octet-stream")}, printer[0].attributes["document-format-supported"])
+	// idle, as a 4 byte enum
+	assert.Equal(t, [][]byte{{0, 0, 0, 3}}, printer[0].attributes["printer-state"])
+}
+
+func TestIPPSource_WireValidateAndPrintJob(t *testing.T) {
+	channel := make(chan definitions.PrintInfo, 1)
+	_, url := newTestIPPSource(t, channel)
+
+	response := postWireRequest(t, url, wireRequest(0x0004, 1,
+		wireAttribute(0x42, "job-name", []byte("wire test")),
+		wireAttribute(0x49, "document-format", []byte("application/pdf")),
+	), nil)
+	assert.Equal(t, uint16(0x0000), response.status)
+	assert.Equal(t, uint32(1), response.requestID)
+
+	request := wireRequest(0x0002, 2,
+		wireAttribute(0x42, "job-name", []byte("wire test")),
+		wireAttribute(0x49, "document-format", []byte("application/pdf")),
+	)
+	// the job attributes group goes before the end of the attributes
+	request = append(request[:len(request)-1], 0x02)
+	request = append(request, wireAttribute(0x21, "copies", []byte{0, 0, 0, 2})...)
+	request = append(request, wireAttribute(0x44, "sides", []byte("two-sided-long-edge"))...)
+	request = append(request, 0x03)
+	response = postWireRequest(t, url, request, createPDF(t))
+
+	assert.Equal(t, uint16(0x0000), response.status)
+	assert.Equal(t, uint32(2), response.requestID)
+	job := response.groupsOf(0x02)
+	if assert.Len(t, job, 1) {
+		assert.Equal(t, [][]byte{{0, 0, 0, 1}}, job[0].attributes["job-id"])
+		// completed, as a 4 byte enum
+		assert.Equal(t, [][]byte{{0, 0, 0, 9}}, job[0].attributes["job-state"])
+	}
+	select {
+	case printInfo := <-channel:
+		assert.Equal(t, "wire test", printInfo.Title)
+		assert.Equal(t, "bob", printInfo.User)
+		assert.Equal(t, 2, printInfo.Copies)
+		assert.Equal(t, "two-sided-long-edge", printInfo.Attributes["sides"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the job")
+	}
+
+	response = postWireRequest(t, url, wireRequest(0x000a, 3,
+		wireAttribute(0x44, "which-jobs", []byte("completed")),
+	), nil)
+	assert.Equal(t, uint16(0x0000), response.status)
+	jobs := response.groupsOf(0x02)
+	if assert.Len(t, jobs, 1) {
+		// without requested-attributes, Get-Jobs returns the job's id and URI
+		assert.ElementsMatch(t, []string{"job-id", "job-uri"}, jobs[0].names)
+		assert.Equal(t, [][]byte{{0, 0, 0, 1}}, jobs[0].attributes["job-id"])
+	}
+}
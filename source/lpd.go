@@ -0,0 +1,372 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/utils"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LPD daemon commands, see RFC 1179
+const (
+	lpdPrintWaitingJobs byte = 0x01
+	lpdReceiveJob       byte = 0x02
+	lpdShortQueueState  byte = 0x03
+	lpdLongQueueState   byte = 0x04
+	lpdRemoveJobs       byte = 0x05
+)
+
+// LPD receive job subcommands
+const (
+	lpdAbortJob        byte = 0x01
+	lpdReceiveControl  byte = 0x02
+	lpdReceiveDataFile byte = 0x03
+)
+
+const (
+	lpdAcknowledge         byte = 0x00
+	lpdNegativeAcknowledge byte = 0x01
+)
+
+// lpdPrintCommands are the control file commands that print a data file, the rest of the line is the data file name
+const lpdPrintCommands = "cdfglnoprtv"
+
+// LPDSource is a line printer daemon, as used by lpr on older Unix hosts.
+type LPDSource struct {
+	conf        config.LPDSourceConfig
+	jobsDir     string
+	channel     chan definitions.PrintInfo
+	idleTimeout time.Duration
+	maxJobSize  int64
+}
+
+type lpdJob struct {
+	queue       string
+	host        string
+	controlFile string
+	// dataFiles maps the data file names to their spooled paths
+	dataFiles map[string]string
+	// size is the number of bytes received for the job so far
+	size int64
+}
+
+func NewLPDSource(conf config.LPDSourceConfig, jobsDir string, channel chan definitions.PrintInfo) (*LPDSource, error) {
+	if conf.Address == "" {
+		conf.Address = ":515"
+	}
+	if conf.Name == "" {
+		conf.Name = conf.Address
+	}
+	if conf.IdleTimeoutMs == 0 {
+		conf.IdleTimeoutMs = 30000
+	}
+	if conf.MaxJobSizeMB == 0 {
+		conf.MaxJobSizeMB = 100
+	}
+	if conf.IdleTimeoutMs < 0 || conf.MaxJobSizeMB < 0 {
+		return nil, fmt.Errorf("LPD source %s has a negative idle timeout or max job size", conf.Name)
+	}
+
+	return &LPDSource{
+		conf:        conf,
+		jobsDir:     jobsDir,
+		channel:     channel,
+		idleTimeout: time.Duration(conf.IdleTimeoutMs) * time.Millisecond,
+		maxJobSize:  int64(conf.MaxJobSizeMB) * 1024 * 1024,
+	}, nil
+}
+
+func (s *LPDSource) Name() string {
+	return "lpd:" + s.conf.Name
+}
+
+func (s *LPDSource) Run(ctx context.Context) error {
+	return serveTCP(ctx, s.conf.Address, s.Name(), func(conn net.Conn) {
+		err := s.handleConnection(ctx, conn)
+		if err != nil {
+			log.WithError(err).Errorf("failed to handle LPD connection from %s", conn.RemoteAddr())
+		}
+	})
+}
+
+// getPipeline returns the pipeline for the queue.
+func (s *LPDSource) getPipeline(queue string) string {
+	if pipeline, ok := s.conf.Queues[queue]; ok {
+		return pipeline
+	}
+	return s.conf.Pipeline
+}
+
+func (s *LPDSource) handleConnection(ctx context.Context, conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	command, operand, err := s.readCommand(conn, reader)
+	if err != nil {
+		return err
+	}
+	queue := strings.Fields(operand + " ")[0]
+	log.Debugf("received LPD command 0x%02x for queue %s from %s", command, queue, conn.RemoteAddr())
+
+	switch command {
+	case lpdReceiveJob:
+		return s.receiveJob(ctx, conn, reader, queue)
+	case lpdShortQueueState, lpdLongQueueState:
+		// jobs are handed to the engine as soon as they are received, so the queue is always empty
+		_, err = conn.Write([]byte("no entries\n"))
+		return err
+	case lpdPrintWaitingJobs, lpdRemoveJobs:
+		_, err = conn.Write([]byte{lpdAcknowledge})
+		return err
+	}
+	return fmt.Errorf("unknown LPD command 0x%02x", command)
+}
+
+// readCommand reads a command line, which is a command byte followed by its operands.
+func (s *LPDSource) readCommand(conn net.Conn, reader *bufio.Reader) (byte, string, error) {
+	err := conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+	if err != nil {
+		return 0, "", err
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return 0, "", err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	if len(line) == 0 {
+		return 0, "", errors.New("empty LPD command")
+	}
+	return line[0], line[1:], nil
+}
+
+func (s *LPDSource) receiveJob(ctx context.Context, conn net.Conn, reader *bufio.Reader, queue string) error {
+	_, err := conn.Write([]byte{lpdAcknowledge})
+	if err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		host = conn.RemoteAddr().String()
+	}
+	job := &lpdJob{queue: queue, host: host, dataFiles: map[string]string{}}
+	defer job.removeDataFiles()
+
+	for {
+		command, operand, err := s.readCommand(conn, reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch command {
+		case lpdAbortJob:
+			log.Infof("LPD job from %s was aborted", conn.RemoteAddr())
+			return nil
+		case lpdReceiveControl, lpdReceiveDataFile:
+			err = s.receiveFile(conn, reader, job, command, operand)
+			if err != nil {
+				conn.Write([]byte{lpdNegativeAcknowledge})
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown LPD receive job subcommand 0x%02x", command)
+		}
+	}
+
+	if job.controlFile == "" {
+		return errors.New("LPD job has no control file")
+	}
+	return s.submitJob(ctx, job)
+}
+
+func (s *LPDSource) receiveFile(conn net.Conn, reader *bufio.Reader, job *lpdJob, command byte, operand string) error {
+	fields := strings.Fields(operand)
+	if len(fields) != 2 {
+		return fmt.Errorf("invalid LPD receive file operands %q", operand)
+	}
+	count, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || count < 0 {
+		return fmt.Errorf("invalid LPD file size %q", fields[0])
+	}
+	if job.size+count > s.maxJobSize {
+		return fmt.Errorf("%w, the limit is %d MB", errJobTooLarge, s.conf.MaxJobSizeMB)
+	}
+	name := fields[1]
+	// a data file of 0 bytes is streamed until the client closes the connection, as LPRng and Windows do
+	streamed := count == 0 && command == lpdReceiveDataFile
+	if count == 0 && command == lpdReceiveControl {
+		return fmt.Errorf("LPD control file %s has no size", name)
+	}
+
+	_, err = conn.Write([]byte{lpdAcknowledge})
+	if err != nil {
+		return err
+	}
+
+	var destination io.Writer
+	controlFile := &strings.Builder{}
+	if command == lpdReceiveControl {
+		destination = controlFile
+	} else {
+		outputPath := filepath.Join(s.jobsDir, fmt.Sprintf("lpd_%s", uuid.New().String()[0:8]))
+		file, err := os.Create(outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to create job file: %w", err)
+		}
+		defer file.Close()
+		job.dataFiles[name] = outputPath
+		destination = file
+	}
+
+	source := &idleTimeoutReader{conn: conn, reader: reader, timeout: s.idleTimeout}
+	if streamed {
+		// one byte over the limit tells that the job is too large
+		count, err = io.Copy(destination, io.LimitReader(source, s.maxJobSize-job.size+1))
+		if err != nil {
+			return fmt.Errorf("failed to receive file %s: %w", name, err)
+		}
+		if job.size+count > s.maxJobSize {
+			return fmt.Errorf("%w, the limit is %d MB", errJobTooLarge, s.conf.MaxJobSizeMB)
+		}
+		job.size += count
+		log.Debugf("received streamed LPD file %s of %d bytes", name, count)
+		return nil
+	}
+	_, err = io.CopyN(destination, source, count)
+	if err != nil {
+		return fmt.Errorf("failed to receive file %s: %w", name, err)
+	}
+	// the file is followed by a zero byte
+	terminator, err := reader.ReadByte()
+	if err != nil || terminator != 0 {
+		return fmt.Errorf("file %s isn't followed by a zero byte", name)
+	}
+	if command == lpdReceiveControl {
+		job.controlFile = controlFile.String()
+	}
+	job.size += count
+	log.Debugf("received LPD file %s of %d bytes", name, count)
+
+	_, err = conn.Write([]byte{lpdAcknowledge})
+	return err
+}
+
+func (s *LPDSource) submitJob(ctx context.Context, job *lpdJob) error {
+	controlFields := map[byte]string{}
+	var printedFiles []string
+	copies := map[string]int{}
+	filenames := map[string]string{}
+	lastPrintedFile := ""
+	for _, line := range strings.Split(job.controlFile, "\n") {
+		if len(line) < 2 {
+			continue
+		}
+		command, value := line[0], line[1:]
+		switch {
+		case command == 'N':
+			// the source file name follows the print command of its data file
+			if lastPrintedFile != "" && filenames[lastPrintedFile] == "" {
+				filenames[lastPrintedFile] = value
+			}
+		case strings.IndexByte(lpdPrintCommands, command) >= 0:
+			if copies[value] == 0 {
+				printedFiles = append(printedFiles, value)
+			}
+			copies[value]++
+			lastPrintedFile = value
+		default:
+			controlFields[command] = value
+		}
+	}
+	if len(printedFiles) == 0 {
+		return errors.New("LPD control file doesn't print any data file")
+	}
+
+	host := controlFields['H']
+	if host == "" {
+		host = job.host
+	}
+	for _, name := range printedFiles {
+		path, ok := job.dataFiles[name]
+		if !ok {
+			return fmt.Errorf("LPD data file %s wasn't received", name)
+		}
+		printInfo, err := s.getPrintInfo(path)
+		if err != nil {
+			return fmt.Errorf("LPD data file %s: %w", name, err)
+		}
+		delete(job.dataFiles, name)
+
+		printInfo.Pipeline = s.getPipeline(job.queue)
+		printInfo.Title = controlFields['J']
+		printInfo.User = controlFields['P']
+		printInfo.Host = host
+		printInfo.Copies = copies[name]
+		printInfo.OriginalFilename = filenames[name]
+		printInfo.Attributes["Queue"] = job.queue
+		printInfo.Attributes["Class"] = controlFields['C']
+		printInfo.Attributes["SourceName"] = s.conf.Name
+
+		log.Infof("received LPD job %s from %s on queue %s as %s", printInfo.Title, host, job.queue, printInfo.Filepath)
+		err = submit(ctx, s.channel, printInfo)
+		if err != nil {
+			os.Remove(printInfo.Filepath)
+			return err
+		}
+	}
+	return nil
+}
+
+// getPrintInfo detects the type of the spooled data file, and moves it to a path with the matching extension.
+func (s *LPDSource) getPrintInfo(path string) (definitions.PrintInfo, error) {
+	documentType, err := utils.DetectFileDocumentType(path)
+	if err != nil {
+		return definitions.PrintInfo{}, fmt.Errorf("failed to detect document type: %w", err)
+	}
+	switch documentType {
+	case utils.DocumentPDF, utils.DocumentPostScript, utils.DocumentPCL, utils.DocumentText:
+	default:
+		return definitions.PrintInfo{}, fmt.Errorf("unsupported document type %s", documentType)
+	}
+
+	pages, err := utils.CountPages(path, documentType)
+	if err != nil {
+		return definitions.PrintInfo{}, fmt.Errorf("failed to count pages: %w", err)
+	}
+
+	typedPath := path + documentType.Extension()
+	err = os.Rename(path, typedPath)
+	if err != nil {
+		return definitions.PrintInfo{}, fmt.Errorf("failed to rename job file: %w", err)
+	}
+
+	return definitions.PrintInfo{
+		Filepath:    typedPath,
+		Pages:       pages,
+		Source:      "lpd",
+		SubmittedAt: time.Now(),
+		Attributes: map[string]string{
+			"DocumentType": string(documentType),
+		},
+	}, nil
+}
+
+// removeDataFiles removes the data files that weren't submitted.
+func (j *lpdJob) removeDataFiles() {
+	for _, path := range j.dataFiles {
+		os.Remove(path)
+	}
+}
@@ -0,0 +1,140 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/stretchr/testify/assert"
+)
+
+func expectAck(t *testing.T, conn net.Conn) {
+	ack := make([]byte, 1)
+	_, err := conn.Read(ack)
+	assert.NoError(t, err)
+	assert.Equal(t, lpdAcknowledge, ack[0])
+}
+
+func sendLPDFile(t *testing.T, conn net.Conn, command byte, name string, data string) {
+	_, err := fmt.Fprintf(conn, "%c%d %s\n", command, len(data), name)
+	assert.NoError(t, err)
+	expectAck(t, conn)
+	_, err = conn.Write(append([]byte(data), 0))
+	assert.NoError(t, err)
+	expectAck(t, conn)
+}
+
+// connectLPD connects to the source, the connection's result is sent to the returned channel once it's closed.
+func connectLPD(t *testing.T, s *LPDSource) (net.Conn, chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	result := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		assert.NoError(t, err)
+		defer conn.Close()
+		result <- s.handleConnection(context.Background(), conn)
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn, result
+}
+
+func TestLPDSource(t *testing.T) {
+	jobsDir := t.TempDir()
+	channel := make(chan definitions.PrintInfo, 1)
+	s, err := NewLPDSource(config.LPDSourceConfig{
+		Pipeline: "default",
+		Queues:   map[string]string{"invoices": "erp"},
+	}, jobsDir, channel)
+	assert.NoError(t, err)
+
+	conn, result := connectLPD(t, s)
+	_, err = conn.Write([]byte("\x02invoices\n"))
+	assert.NoError(t, err)
+	expectAck(t, conn)
+	sendLPDFile(t, conn, lpdReceiveDataFile, "dfA123erp01", "%!PS-Adobe-3.0\nshowpage\n")
+	sendLPDFile(t, conn, lpdReceiveControl, "cfA123erp01",
+		"Herp01\nPbilling\nJInvoice 42\nCA\nldfA123erp01\nldfA123erp01\nUdfA123erp01\nNinvoice42.ps\n")
+	conn.Close()
+
+	assert.NoError(t, <-result)
+	printInfo := <-channel
+	assert.Equal(t, "lpd", printInfo.Source)
+	assert.Equal(t, "erp", printInfo.Pipeline)
+	assert.Equal(t, "Invoice 42", printInfo.Title)
+	assert.Equal(t, "billing", printInfo.User)
+	assert.Equal(t, "erp01", printInfo.Host)
+	assert.Equal(t, "invoice42.ps", printInfo.OriginalFilename)
+	assert.Equal(t, 2, printInfo.Copies)
+	assert.Equal(t, "invoices", printInfo.Attributes["Queue"])
+	assert.Equal(t, "A", printInfo.Attributes["Class"])
+	contents, err := os.ReadFile(printInfo.Filepath)
+	assert.NoError(t, err)
+	assert.Equal(t, "%!PS-Adobe-3.0\nshowpage\n", string(contents))
+}
+
+func TestLPDSource_getPipeline(t *testing.T) {
+	s, err := NewLPDSource(config.LPDSourceConfig{
+		Pipeline: "fallback",
+		Queues:   map[string]string{"invoices": "erp"},
+	}, t.TempDir(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "erp", s.getPipeline("invoices"))
+	assert.Equal(t, "fallback", s.getPipeline("lp"))
+}
+
+func TestLPDSource_StreamedDataFile(t *testing.T) {
+	channel := make(chan definitions.PrintInfo, 1)
+	s, err := NewLPDSource(config.LPDSourceConfig{}, t.TempDir(), channel)
+	assert.NoError(t, err)
+
+	conn, result := connectLPD(t, s)
+	_, err = conn.Write([]byte("\x02lp\n"))
+	assert.NoError(t, err)
+	expectAck(t, conn)
+	sendLPDFile(t, conn, lpdReceiveControl, "cfA001unix", "Hunix\nProot\nldfA001unix\n")
+	_, err = conn.Write([]byte("\x030 dfA001unix\n"))
+	assert.NoError(t, err)
+	expectAck(t, conn)
+	_, err = conn.Write([]byte("%!PS-Adobe-3.0\nshowpage\n"))
+	assert.NoError(t, err)
+	conn.(*net.TCPConn).CloseWrite()
+
+	assert.NoError(t, <-result)
+	printInfo := <-channel
+	contents, err := os.ReadFile(printInfo.Filepath)
+	assert.NoError(t, err)
+	assert.Equal(t, "%!PS-Adobe-3.0\nshowpage\n", string(contents))
+}
+
+func TestLPDSource_JobTooLarge(t *testing.T) {
+	channel := make(chan definitions.PrintInfo, 1)
+	s, err := NewLPDSource(config.LPDSourceConfig{MaxJobSizeMB: 1}, t.TempDir(), channel)
+	assert.NoError(t, err)
+
+	conn, result := connectLPD(t, s)
+	_, err = conn.Write([]byte("\x02lp\n"))
+	assert.NoError(t, err)
+	expectAck(t, conn)
+	// every data file is below the limit, but together they're above it
+	data := strings.Repeat("x", 700*1024)
+	sendLPDFile(t, conn, lpdReceiveDataFile, "dfA001unix", data)
+	_, err = fmt.Fprintf(conn, "%c%d %s\n", lpdReceiveDataFile, len(data), "dfB001unix")
+	assert.NoError(t, err)
+	nak := make([]byte, 1)
+	_, err = conn.Read(nak)
+	assert.NoError(t, err)
+	assert.Equal(t, lpdNegativeAcknowledge, nak[0])
+
+	assert.ErrorIs(t, <-result, errJobTooLarge)
+	assert.Empty(t, channel)
+}
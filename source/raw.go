@@ -0,0 +1,170 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/benyaa/virtual-printer-process-engine/utils"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var errJobTooLarge = errors.New("job is too large")
+
+// RawSource is a raw socket(JetDirect) printer, where every connection is a single job.
+type RawSource struct {
+	conf        config.RawSourceConfig
+	jobsDir     string
+	channel     chan definitions.PrintInfo
+	idleTimeout time.Duration
+	maxJobSize  int64
+}
+
+func NewRawSource(conf config.RawSourceConfig, jobsDir string, channel chan definitions.PrintInfo) (*RawSource, error) {
+	if conf.Address == "" {
+		conf.Address = ":9100"
+	}
+	if conf.Name == "" {
+		conf.Name = conf.Address
+	}
+	if conf.IdleTimeoutMs == 0 {
+		conf.IdleTimeoutMs = 30000
+	}
+	if conf.MaxJobSizeMB == 0 {
+		conf.MaxJobSizeMB = 100
+	}
+	if conf.IdleTimeoutMs < 0 || conf.MaxJobSizeMB < 0 {
+		return nil, fmt.Errorf("raw source %s has a negative idle timeout or max job size", conf.Name)
+	}
+
+	return &RawSource{
+		conf:        conf,
+		jobsDir:     jobsDir,
+		channel:     channel,
+		idleTimeout: time.Duration(conf.IdleTimeoutMs) * time.Millisecond,
+		maxJobSize:  int64(conf.MaxJobSizeMB) * 1024 * 1024,
+	}, nil
+}
+
+func (s *RawSource) Name() string {
+	return "raw:" + s.conf.Name
+}
+
+func (s *RawSource) Run(ctx context.Context) error {
+	return serveTCP(ctx, s.conf.Address, s.Name(), func(conn net.Conn) {
+		err := s.handleConnection(ctx, conn)
+		if err != nil {
+			log.WithError(err).Errorf("failed to receive raw job from %s", conn.RemoteAddr())
+		}
+	})
+}
+
+func (s *RawSource) handleConnection(ctx context.Context, conn net.Conn) error {
+	outputPath := filepath.Join(s.jobsDir, fmt.Sprintf("raw_%s", uuid.New().String()[0:8]))
+	written, err := s.spool(conn, outputPath)
+	if err != nil {
+		os.Remove(outputPath)
+		return err
+	}
+	if written == 0 {
+		log.Debugf("raw connection from %s closed without data", conn.RemoteAddr())
+		os.Remove(outputPath)
+		return nil
+	}
+
+	documentType, err := utils.DetectFileDocumentType(outputPath)
+	if err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("failed to detect document type: %w", err)
+	}
+	switch documentType {
+	case utils.DocumentPDF, utils.DocumentPostScript, utils.DocumentPCL, utils.DocumentText:
+	default:
+		os.Remove(outputPath)
+		return fmt.Errorf("unsupported document type %s", documentType)
+	}
+
+	typedPath := outputPath + documentType.Extension()
+	err = os.Rename(outputPath, typedPath)
+	if err != nil {
+		os.Remove(outputPath)
+		return fmt.Errorf("failed to rename job file: %w", err)
+	}
+
+	pages, err := utils.CountPages(typedPath, documentType)
+	if err != nil {
+		os.Remove(typedPath)
+		return fmt.Errorf("failed to count pages: %w", err)
+	}
+
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		host = conn.RemoteAddr().String()
+	}
+	printInfo := definitions.PrintInfo{
+		Filepath:    typedPath,
+		Pages:       pages,
+		Pipeline:    s.conf.Pipeline,
+		Source:      "raw",
+		Host:        host,
+		Copies:      1,
+		SubmittedAt: time.Now(),
+		Attributes: map[string]string{
+			"SourceName":   s.conf.Name,
+			"DocumentType": string(documentType),
+		},
+	}
+	log.Infof("received %d bytes of %s from %s as %s", written, documentType, conn.RemoteAddr(), typedPath)
+	err = submit(ctx, s.channel, printInfo)
+	if err != nil {
+		os.Remove(typedPath)
+	}
+	return err
+}
+
+// spool writes the connection's data to outputPath, until the client closes the connection or stays idle for too long.
+func (s *RawSource) spool(conn net.Conn, outputPath string) (int64, error) {
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create job file: %w", err)
+	}
+	defer file.Close()
+
+	reader := &idleTimeoutReader{conn: conn, reader: conn, timeout: s.idleTimeout}
+	written, err := io.Copy(file, io.LimitReader(reader, s.maxJobSize+1))
+	if err != nil {
+		return written, fmt.Errorf("failed to receive job: %w", err)
+	}
+	if written > s.maxJobSize {
+		return written, fmt.Errorf("%w, the limit is %d MB", errJobTooLarge, s.conf.MaxJobSizeMB)
+	}
+	return written, nil
+}
+
+// idleTimeoutReader reads from a connection, and ends the stream once no data arrived for the timeout.
+type idleTimeoutReader struct {
+	conn net.Conn
+	// reader reads from conn, possibly buffered
+	reader  io.Reader
+	timeout time.Duration
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	err := r.conn.SetReadDeadline(time.Now().Add(r.timeout))
+	if err != nil {
+		return 0, err
+	}
+	n, err := r.reader.Read(p)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		log.Debugf("connection from %s idle for %s, ending the job", r.conn.RemoteAddr(), r.timeout)
+		return n, io.EOF
+	}
+	return n, err
+}
@@ -0,0 +1,126 @@
+package source
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/benyaa/virtual-printer-process-engine/definitions"
+	"github.com/stretchr/testify/assert"
+)
+
+// sendRawJob sends data to the source over a local connection, and returns the error of handling it.
+func sendRawJob(t *testing.T, s *RawSource, data []byte, closeAfterWrite bool) error {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		assert.NoError(t, err)
+		conn.Write(data)
+		if closeAfterWrite {
+			conn.Close()
+			return
+		}
+		time.Sleep(time.Second)
+		conn.Close()
+	}()
+
+	conn, err := listener.Accept()
+	assert.NoError(t, err)
+	defer conn.Close()
+	return s.handleConnection(context.Background(), conn)
+}
+
+func TestRawSource(t *testing.T) {
+	jobsDir := t.TempDir()
+	channel := make(chan definitions.PrintInfo, 1)
+	s, err := NewRawSource(config.RawSourceConfig{Pipeline: "legacy", IdleTimeoutMs: 100}, jobsDir, channel)
+	assert.NoError(t, err)
+
+	assert.NoError(t, sendRawJob(t, s, []byte("%!PS-Adobe-3.0\nshowpage\n"), true))
+	printInfo := <-channel
+	assert.Equal(t, "raw", printInfo.Source)
+	assert.Equal(t, "legacy", printInfo.Pipeline)
+	assert.Equal(t, "127.0.0.1", printInfo.Host)
+	assert.Equal(t, "postscript", printInfo.Attributes["DocumentType"])
+	assert.Equal(t, ".ps", filepath.Ext(printInfo.Filepath))
+	contents, err := os.ReadFile(printInfo.Filepath)
+	assert.NoError(t, err)
+	assert.Equal(t, "%!PS-Adobe-3.0\nshowpage\n", string(contents))
+
+	// the client keeps the connection open, so the job ends after the idle timeout
+	start := time.Now()
+	assert.NoError(t, sendRawJob(t, s, []byte("hello world\n"), false))
+	assert.Less(t, time.Since(start), time.Second)
+	printInfo = <-channel
+	assert.Equal(t, ".txt", filepath.Ext(printInfo.Filepath))
+}
+
+func TestRawSource_Rejected(t *testing.T) {
+	jobsDir := t.TempDir()
+	s, err := NewRawSource(config.RawSourceConfig{MaxJobSizeMB: 1}, jobsDir, nil)
+	assert.NoError(t, err)
+
+	err = sendRawJob(t, s, []byte(strings.Repeat("a", 1024*1024+1)), true)
+	assert.ErrorIs(t, err, errJobTooLarge)
+
+	err = sendRawJob(t, s, []byte{0, 1, 2, 3}, true)
+	assert.ErrorContains(t, err, "unsupported document type")
+
+	entries, err := os.ReadDir(jobsDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+// flakyListener fails to accept with EMFILE a few times, then accepts one connection, then is closed.
+type flakyListener struct {
+	net.Listener
+	failures int
+	accepted bool
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.failures > 0 {
+		l.failures--
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", syscall.EMFILE)}
+	}
+	if !l.accepted {
+		l.accepted = true
+		server, client := net.Pipe()
+		client.Close()
+		return server, nil
+	}
+	return nil, net.ErrClosed
+}
+
+func TestAcceptConnections_RetriesTemporaryErrors(t *testing.T) {
+	listener := &flakyListener{failures: 3}
+	handled := make(chan bool, 1)
+
+	err := acceptConnections(context.Background(), listener, "test", func(conn net.Conn) {
+		handled <- true
+	})
+
+	assert.ErrorIs(t, err, net.ErrClosed)
+	select {
+	case <-handled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the connection after the failures wasn't handled")
+	}
+}
+
+func TestAcceptConnections_StopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := acceptConnections(ctx, &flakyListener{failures: 1}, "test", func(conn net.Conn) {})
+	assert.NoError(t, err)
+}
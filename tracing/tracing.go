@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"os"
+)
+
+const defaultServiceName = "virtual-printer-process-engine"
+
+// Setup sets the global tracer provider to export the spans as configured, and the W3C trace context propagator.
+// The returned function flushes the remaining spans and stops the exporter.
+func Setup(ctx context.Context, conf config.TracingConfig) (func(context.Context) error, error) {
+	exporter, closeExporter, err := newExporter(ctx, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := conf.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	hostname, _ := os.Hostname()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+			attribute.String("host.name", hostname),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	log.Infof("exporting traces with the %s exporter", conf.Exporter)
+
+	return func(ctx context.Context) error {
+		return errors.Join(provider.Shutdown(ctx), closeExporter())
+	}, nil
+}
+
+func newExporter(ctx context.Context, conf config.TracingConfig) (sdktrace.SpanExporter, func() error, error) {
+	noClose := func() error { return nil }
+	switch conf.Exporter {
+	case "", config.TracingExporterOTLP:
+		var options []otlptracehttp.Option
+		if conf.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(conf.Endpoint))
+		}
+		if conf.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		if len(conf.Headers) > 0 {
+			options = append(options, otlptracehttp.WithHeaders(conf.Headers))
+		}
+		exporter, err := otlptracehttp.New(ctx, options...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		return exporter, noClose, nil
+	case config.TracingExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+		return exporter, noClose, nil
+	case config.TracingExporterFile:
+		if conf.File == "" {
+			return nil, nil, errors.New("the file exporter requires tracing.file")
+		}
+		file, err := os.OpenFile(conf.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open traces file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("failed to create file exporter: %w", err)
+		}
+		return exporter, file.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown tracing exporter %s", conf.Exporter)
+	}
+}
@@ -0,0 +1,38 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/benyaa/virtual-printer-process-engine/config"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestSetup_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := Setup(context.Background(), config.TracingConfig{Enabled: true, Exporter: config.TracingExporterFile, File: path})
+	assert.NoError(t, err)
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "session")
+	header := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, header)
+	span.End()
+	assert.NoError(t, shutdown(context.Background()))
+
+	assert.Contains(t, header.Get("traceparent"), span.SpanContext().TraceID().String())
+	contents, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(contents), `"Name":"session"`)
+	assert.Contains(t, string(contents), span.SpanContext().TraceID().String())
+}
+
+func TestSetup_Invalid(t *testing.T) {
+	_, err := Setup(context.Background(), config.TracingConfig{Enabled: true, Exporter: "zipkin"})
+	assert.Error(t, err)
+	_, err = Setup(context.Background(), config.TracingConfig{Enabled: true, Exporter: config.TracingExporterFile})
+	assert.Error(t, err)
+}
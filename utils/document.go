@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+type DocumentType string
+
+const (
+	DocumentPDF        DocumentType = "pdf"
+	DocumentPostScript DocumentType = "postscript"
+	DocumentPCL        DocumentType = "pcl"
+	DocumentXPS        DocumentType = "xps"
+	DocumentPNG        DocumentType = "png"
+	DocumentJPEG       DocumentType = "jpeg"
+	DocumentGIF        DocumentType = "gif"
+	DocumentBMP        DocumentType = "bmp"
+	DocumentTIFF       DocumentType = "tiff"
+	DocumentText       DocumentType = "text"
+	DocumentUnknown    DocumentType = "unknown"
+)
+
+var documentExtensions = map[DocumentType]string{
+	DocumentPDF:        ".pdf",
+	DocumentPostScript: ".ps",
+	DocumentPCL:        ".pcl",
+	DocumentXPS:        ".xps",
+	DocumentPNG:        ".png",
+	DocumentJPEG:       ".jpg",
+	DocumentGIF:        ".gif",
+	DocumentBMP:        ".bmp",
+	DocumentTIFF:       ".tiff",
+	DocumentText:       ".txt",
+}
+
+// DocumentHeaderSize is the number of bytes DetectDocumentType needs to detect any of the types.
+const DocumentHeaderSize = 512
+
+// Extension returns the file extension for the document type, including the dot.
+func (d DocumentType) Extension() string {
+	return documentExtensions[d]
+}
+
+func (d DocumentType) IsImage() bool {
+	switch d {
+	case DocumentPNG, DocumentJPEG, DocumentGIF, DocumentBMP, DocumentTIFF:
+		return true
+	}
+	return false
+}
+
+// DetectDocumentType detects the document type from the magic bytes at the beginning of the document.
+// XPS documents are ZIP archives, so they are detected as XPS only by DetectFileDocumentType.
+func DetectDocumentType(header []byte) DocumentType {
+	// PJL wraps PCL and PostScript jobs, the language is in the ENTER LANGUAGE command
+	if bytes.HasPrefix(header, []byte("\x1b%-12345X")) {
+		upperHeader := bytes.ToUpper(header)
+		switch {
+		case bytes.Contains(upperHeader, []byte("LANGUAGE=PDF")):
+			return DocumentPDF
+		case bytes.Contains(upperHeader, []byte("LANGUAGE=POSTSCRIPT")):
+			return DocumentPostScript
+		default:
+			return DocumentPCL
+		}
+	}
+
+	switch {
+	case bytes.HasPrefix(header, []byte("%PDF-")):
+		return DocumentPDF
+	case bytes.HasPrefix(header, []byte("%!")), bytes.HasPrefix(header, []byte("\x04%!")):
+		return DocumentPostScript
+	case bytes.HasPrefix(header, []byte("\x1bE")), bytes.HasPrefix(header, []byte("\x1b&")), bytes.HasPrefix(header, []byte("\x1b*")):
+		return DocumentPCL
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return DocumentPNG
+	case bytes.HasPrefix(header, []byte("\xff\xd8\xff")):
+		return DocumentJPEG
+	case bytes.HasPrefix(header, []byte("GIF87a")), bytes.HasPrefix(header, []byte("GIF89a")):
+		return DocumentGIF
+	case bytes.HasPrefix(header, []byte("BM")) && len(header) >= 10 && bytes.Equal(header[6:10], []byte{0, 0, 0, 0}):
+		return DocumentBMP
+	case bytes.HasPrefix(header, []byte("II*\x00")), bytes.HasPrefix(header, []byte("MM\x00*")):
+		return DocumentTIFF
+	case isText(header):
+		return DocumentText
+	}
+	return DocumentUnknown
+}
+
+func isText(header []byte) bool {
+	if len(header) == 0 {
+		return false
+	}
+	for _, b := range header {
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f' {
+			return false
+		}
+	}
+	return true
+}
+
+func DetectFileDocumentType(filePath string) (DocumentType, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return DocumentUnknown, err
+	}
+	defer file.Close()
+
+	header := make([]byte, DocumentHeaderSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return DocumentUnknown, err
+	}
+	header = header[:n]
+
+	if bytes.HasPrefix(header, []byte("PK\x03\x04")) {
+		ext := strings.ToLower(path.Ext(filePath))
+		if ext == ".xps" || ext == ".oxps" {
+			return DocumentXPS, nil
+		}
+		return DocumentUnknown, nil
+	}
+
+	return DetectDocumentType(header), nil
+}
+
+// CountPages counts the pages of a document where possible, and returns 0 otherwise.
+func CountPages(filePath string, documentType DocumentType) (int, error) {
+	switch documentType {
+	case DocumentPDF:
+		return api.PageCountFile(filePath)
+	case DocumentXPS:
+		return countXPSPages(filePath)
+	case DocumentTIFF:
+		return countTIFFPages(filePath)
+	case DocumentPNG, DocumentJPEG, DocumentGIF, DocumentBMP:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+func countXPSPages(filePath string) (int, error) {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open XPS file: %w", err)
+	}
+	defer reader.Close()
+
+	pages := 0
+	for _, file := range reader.File {
+		if strings.HasSuffix(strings.ToLower(file.Name), ".fpage") {
+			pages++
+		}
+	}
+	return pages, nil
+}
+
+// countTIFFPages counts the image file directories, as each page of a TIFF file has one.
+func countTIFFPages(filePath string) (int, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return 0, fmt.Errorf("failed to read TIFF header: %w", err)
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if header[0] == 'M' {
+		order = binary.BigEndian
+	}
+
+	pages := 0
+	offset := int64(order.Uint32(header[4:]))
+	seen := map[int64]bool{}
+	for offset != 0 && !seen[offset] {
+		seen[offset] = true
+		pages++
+		entryCount := make([]byte, 2)
+		if _, err := file.ReadAt(entryCount, offset); err != nil {
+			return 0, fmt.Errorf("failed to read TIFF directory: %w", err)
+		}
+		next := make([]byte, 4)
+		if _, err := file.ReadAt(next, offset+2+int64(order.Uint16(entryCount))*12); err != nil {
+			return 0, fmt.Errorf("failed to read TIFF directory: %w", err)
+		}
+		offset = int64(order.Uint32(next))
+	}
+	return pages, nil
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectDocumentType(t *testing.T) {
+	tests := map[string]DocumentType{
+		"%PDF-1.7\n":       DocumentPDF,
+		"%!PS-Adobe-3.0\n": DocumentPostScript,
+		"\x1bE\x1b&l0O":    DocumentPCL,
+		"\x1b%-12345X@PJL ENTER LANGUAGE=POSTSCRIPT\n": DocumentPostScript,
+		"\x1b%-12345X@PJL ENTER LANGUAGE=PCL\n":        DocumentPCL,
+		"\x89PNG\r\n\x1a\n\x00":                        DocumentPNG,
+		"\xff\xd8\xff\xe0":                             DocumentJPEG,
+		"GIF89a":                                       DocumentGIF,
+		"II*\x00\x08\x00\x00\x00":                      DocumentTIFF,
+		"Hello\r\nWorld\f":                             DocumentText,
+		"\x00\x01\x02":                                 DocumentUnknown,
+	}
+	for header, expected := range tests {
+		assert.Equal(t, expected, DetectDocumentType([]byte(header)), "header %q", header)
+	}
+}
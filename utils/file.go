@@ -1,8 +1,12 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 )
 
 var CopyFile = copyFile
@@ -27,3 +31,53 @@ func copyFile(src, dst string) error {
 
 	return nil
 }
+
+var MoveFile = moveFile
+
+// moveFile renames src to dst, and falls back to copying when they are on different file systems.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	err := CopyFile(src, dst)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(src)
+}
+
+// HashFile returns the hex SHA-256 hash of the file's contents.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// WriteFiles writes each of the contents to its path, and removes the files it wrote if one of them fails,
+// so a handler that writes several files doesn't leave some of them behind.
+func WriteFiles(paths []string, contents [][]byte) error {
+	for i, path := range paths {
+		err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		if err == nil {
+			err = os.WriteFile(path, contents[i], 0644)
+		}
+		if err != nil {
+			for _, written := range paths[:i] {
+				os.Remove(written)
+			}
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	return nil
+}
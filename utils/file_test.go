@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFiles(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "out", "a.txt"), filepath.Join(dir, "out", "b.txt")}
+	assert.NoError(t, WriteFiles(paths, [][]byte{[]byte("a"), []byte("b")}))
+	contents, err := os.ReadFile(paths[1])
+	assert.NoError(t, err)
+	assert.Equal(t, "b", string(contents))
+
+	// the second file can't be written, since its directory is a file
+	paths = []string{filepath.Join(dir, "c.txt"), filepath.Join(paths[0], "d.txt")}
+	assert.Error(t, WriteFiles(paths, [][]byte{[]byte("c"), []byte("d")}))
+	assert.NoFileExists(t, paths[0])
+}
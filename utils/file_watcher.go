@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type FileWatcherConfig struct {
+	Dirs []string
+	// StableFor is how long a file's size and modification time must not change before it's considered ready
+	StableFor time.Duration
+	// PollInterval is the interval for scanning the directories when polling is used
+	PollInterval time.Duration
+	// UsePolling forces polling instead of file system notifications
+	UsePolling bool
+	// Filter decides which files are watched, all files are watched if it's nil
+	Filter func(path string) bool
+}
+
+type pendingFile struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+type fileWatcher struct {
+	conf    FileWatcherConfig
+	onReady func(path string)
+	pending map[string]*pendingFile
+	handled map[string]time.Time
+}
+
+// WatchFiles calls onReady for every file in the watched directories, once the file stopped changing.
+// It uses file system notifications when possible and falls back to polling otherwise.
+// onReady is expected to move the file away, a file that stays in place is handled again only if it changes.
+// WatchFiles blocks until ctx is done.
+func WatchFiles(ctx context.Context, conf FileWatcherConfig, onReady func(path string)) {
+	if conf.StableFor <= 0 {
+		conf.StableFor = time.Second
+	}
+	if conf.PollInterval <= 0 {
+		conf.PollInterval = time.Second
+	}
+	w := &fileWatcher{
+		conf:    conf,
+		onReady: onReady,
+		pending: map[string]*pendingFile{},
+		handled: map[string]time.Time{},
+	}
+	w.run(ctx)
+}
+
+func (w *fileWatcher) run(ctx context.Context) {
+	var events chan fsnotify.Event
+	var watchErrors chan error
+	if !w.conf.UsePolling {
+		notifier, err := w.newNotifier()
+		if err != nil {
+			log.WithError(err).Warnf("failed to watch %v for changes, falling back to polling", w.conf.Dirs)
+		} else {
+			defer notifier.Close()
+			events = notifier.Events
+			watchErrors = notifier.Errors
+		}
+	}
+	polling := events == nil
+
+	w.scan()
+
+	checkInterval := w.conf.StableFor / 2
+	if polling && w.conf.PollInterval < checkInterval {
+		checkInterval = w.conf.PollInterval
+	}
+	checkTicker := time.NewTicker(checkInterval)
+	defer checkTicker.Stop()
+	lastScan := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("context canceled, stopping watching %v", w.conf.Dirs)
+			return
+		case event := <-events:
+			if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) {
+				w.track(event.Name)
+			}
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				delete(w.handled, event.Name)
+			}
+		case err := <-watchErrors:
+			log.WithError(err).Errorf("error while watching %v", w.conf.Dirs)
+		case <-checkTicker.C:
+			if polling && time.Since(lastScan) >= w.conf.PollInterval {
+				w.scan()
+				lastScan = time.Now()
+			}
+			w.checkPending()
+		}
+	}
+}
+
+func (w *fileWatcher) newNotifier() (*fsnotify.Watcher, error) {
+	notifier, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range w.conf.Dirs {
+		err = notifier.Add(dir)
+		if err != nil {
+			notifier.Close()
+			return nil, err
+		}
+	}
+	return notifier, nil
+}
+
+// scan tracks the files in the directories, and forgets the handled files that are gone.
+func (w *fileWatcher) scan() {
+	for path := range w.handled {
+		if _, err := os.Stat(path); err != nil {
+			delete(w.handled, path)
+		}
+	}
+	for _, dir := range w.conf.Dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			log.WithError(err).Errorf("failed to read directory %s", dir)
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			w.track(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+func (w *fileWatcher) track(path string) {
+	if w.conf.Filter != nil && !w.conf.Filter(path) {
+		return
+	}
+	stat, err := os.Stat(path)
+	if err != nil || stat.IsDir() {
+		return
+	}
+	if handledModTime, ok := w.handled[path]; ok && handledModTime.Equal(stat.ModTime()) {
+		return
+	}
+	pending, ok := w.pending[path]
+	if !ok {
+		log.Debugf("tracking file %s", path)
+		w.pending[path] = &pendingFile{size: stat.Size(), modTime: stat.ModTime(), since: time.Now()}
+		return
+	}
+	if pending.size != stat.Size() || !pending.modTime.Equal(stat.ModTime()) {
+		pending.size = stat.Size()
+		pending.modTime = stat.ModTime()
+		pending.since = time.Now()
+	}
+}
+
+func (w *fileWatcher) checkPending() {
+	for path, pending := range w.pending {
+		stat, err := os.Stat(path)
+		if err != nil {
+			log.Debugf("file %s is gone, not tracking it anymore", path)
+			delete(w.pending, path)
+			continue
+		}
+		if pending.size != stat.Size() || !pending.modTime.Equal(stat.ModTime()) {
+			pending.size = stat.Size()
+			pending.modTime = stat.ModTime()
+			pending.since = time.Now()
+			continue
+		}
+		if time.Since(pending.since) < w.conf.StableFor {
+			continue
+		}
+
+		delete(w.pending, path)
+		log.Debugf("file %s is ready", path)
+		w.onReady(path)
+		if stat, err := os.Stat(path); err == nil {
+			w.handled[path] = stat.ModTime()
+		} else {
+			delete(w.handled, path)
+		}
+	}
+}
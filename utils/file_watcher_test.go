@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func watchFilesForTest(t *testing.T, conf FileWatcherConfig) chan string {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ready := make(chan string, 10)
+	go WatchFiles(ctx, conf, func(path string) {
+		ready <- path
+		os.Remove(path)
+	})
+	return ready
+}
+
+func TestWatchFiles_Notifications(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.pdf")
+	assert.NoError(t, os.WriteFile(existing, []byte("existing"), 0644))
+
+	ready := watchFilesForTest(t, FileWatcherConfig{
+		Dirs:      []string{dir},
+		StableFor: 50 * time.Millisecond,
+	})
+
+	assert.Equal(t, existing, waitForFile(t, ready))
+
+	created := filepath.Join(dir, "created.pdf")
+	assert.NoError(t, os.WriteFile(created, []byte("created"), 0644))
+	assert.Equal(t, created, waitForFile(t, ready))
+}
+
+func TestWatchFiles_PollingWithFilter(t *testing.T) {
+	dir := t.TempDir()
+	ready := watchFilesForTest(t, FileWatcherConfig{
+		Dirs:         []string{dir},
+		StableFor:    50 * time.Millisecond,
+		PollInterval: 10 * time.Millisecond,
+		UsePolling:   true,
+		Filter: func(path string) bool {
+			return strings.HasSuffix(path, ".pdf")
+		},
+	})
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "ignored.tmp"), []byte("ignored"), 0644))
+	created := filepath.Join(dir, "created.pdf")
+	assert.NoError(t, os.WriteFile(created, []byte("created"), 0644))
+
+	assert.Equal(t, created, waitForFile(t, ready))
+	select {
+	case path := <-ready:
+		t.Fatalf("unexpected file %s", path)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestWatchFiles_WaitsForStableSize(t *testing.T) {
+	dir := t.TempDir()
+	ready := watchFilesForTest(t, FileWatcherConfig{
+		Dirs:      []string{dir},
+		StableFor: 300 * time.Millisecond,
+	})
+
+	path := filepath.Join(dir, "growing.pdf")
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		_, err = file.WriteString("chunk")
+		assert.NoError(t, err)
+		time.Sleep(100 * time.Millisecond)
+		select {
+		case <-ready:
+			t.Fatalf("file was handed off while it was still written")
+		default:
+		}
+	}
+	assert.NoError(t, file.Close())
+
+	assert.Equal(t, path, waitForFile(t, ready))
+}
+
+func waitForFile(t *testing.T, ready chan string) string {
+	select {
+	case path := <-ready:
+		return path
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for file")
+		return ""
+	}
+}
+
+func TestFileWatcher_ScanForgetsHandledFilesThatAreGone(t *testing.T) {
+	dir := t.TempDir()
+	kept := filepath.Join(dir, "failed.pdf")
+	assert.NoError(t, os.WriteFile(kept, []byte("failed"), 0644))
+	stat, err := os.Stat(kept)
+	assert.NoError(t, err)
+	w := &fileWatcher{
+		conf:    FileWatcherConfig{Dirs: []string{dir}},
+		pending: map[string]*pendingFile{},
+		handled: map[string]time.Time{
+			kept:                           stat.ModTime(),
+			filepath.Join(dir, "gone.pdf"): time.Now(),
+		},
+	}
+
+	w.scan()
+
+	assert.Equal(t, map[string]time.Time{kept: stat.ModTime()}, w.handled)
+	assert.Empty(t, w.pending)
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+// FilesConfig are the options of the handlers that take other files than the session's contents, e.g. the pages an
+// executable rendered. Handlers embed it with `mapstructure:",squash"`.
+type FilesConfig struct {
+	// Files are the paths of the files, in order
+	Files []string `mapstructure:"files,omitempty"`
+	// FilesMetadataKey is a metadata key holding more files, as a list or separated by commas, e.g. `PDFSplit.Files`
+	FilesMetadataKey string `mapstructure:"files_metadata_key,omitempty"`
+}
+
+// IsSet returns whether files are configured, the metadata key can still hold none.
+func (c FilesConfig) IsSet() bool {
+	return len(c.Files) > 0 || c.FilesMetadataKey != ""
+}
+
+// GetFiles returns the configured files, evaluated with the metadata, followed by the ones in the metadata key.
+func (c FilesConfig) GetFiles(metadata map[string]interface{}) ([]string, error) {
+	var files []string
+	for _, file := range c.Files {
+		file, err := EvaluateExpression(file, metadata)
+		if err != nil {
+			log.WithError(err).Errorf("failed to evaluate file")
+			return nil, fmt.Errorf("failed to evaluate file: %w", err)
+		}
+		files = append(files, file)
+	}
+	if c.FilesMetadataKey == "" {
+		return files, nil
+	}
+
+	switch value := metadata[c.FilesMetadataKey].(type) {
+	case nil:
+		return nil, fmt.Errorf("metadata key %s is not set", c.FilesMetadataKey)
+	case string:
+		for _, file := range strings.Split(value, ",") {
+			if file = strings.TrimSpace(file); file != "" {
+				files = append(files, file)
+			}
+		}
+	case []string:
+		files = append(files, value...)
+	case []interface{}:
+		for _, file := range value {
+			files = append(files, fmt.Sprint(file))
+		}
+	default:
+		return nil, fmt.Errorf("metadata key %s is not a list of files", c.FilesMetadataKey)
+	}
+	return files, nil
+}
@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFilesConfig_GetFiles(t *testing.T) {
+	c := FilesConfig{Files: []string{"/tmp/${name}.pdf"}, FilesMetadataKey: "PDFSplit.Files"}
+	for _, value := range []interface{}{
+		"/tmp/a.pdf, /tmp/b.pdf,",
+		[]string{"/tmp/a.pdf", "/tmp/b.pdf"},
+		[]interface{}{"/tmp/a.pdf", "/tmp/b.pdf"},
+	} {
+		files, err := c.GetFiles(map[string]interface{}{"name": "cover", "PDFSplit.Files": value})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/tmp/cover.pdf", "/tmp/a.pdf", "/tmp/b.pdf"}, files)
+	}
+
+	_, err := c.GetFiles(map[string]interface{}{"name": "cover"})
+	assert.EqualError(t, err, "metadata key PDFSplit.Files is not set")
+	_, err = c.GetFiles(map[string]interface{}{"name": "cover", "PDFSplit.Files": 3})
+	assert.Error(t, err)
+	assert.False(t, FilesConfig{}.IsSet())
+}